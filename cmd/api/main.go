@@ -11,13 +11,18 @@ import (
 	database "go-boilerplate/internal/pkg/db"
 	"go-boilerplate/internal/pkg/helper"
 	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/metrics"
 	midtransPkg "go-boilerplate/internal/pkg/midtrans"
 	"go-boilerplate/internal/pkg/rabbitmq"
 	"go-boilerplate/internal/pkg/redis"
+	"go-boilerplate/internal/pkg/redisstream"
 	"go-boilerplate/internal/pkg/validation"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
 	serverApp "go-boilerplate/internal/server"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -54,12 +59,18 @@ func main() {
 		return
 	}
 
-	// Setup RabbitMQ
-	rabbit, err := setupRabbitMQ(ctx, env)
-	if err != nil {
-		logger.Error.Println("Error setting up RabbitMQ", err)
-		cancel()
-		return
+	// Setup the event transport, RabbitMQ or Redis Streams
+	var rabbit *rabbitmq.ConnectionManager
+	var streams *redisstream.Broker
+	if env.EventTransport == "redis" {
+		streams = redisstream.NewBroker(ctx, redisClient, nil)
+	} else {
+		rabbit, err = setupRabbitMQ(ctx, env)
+		if err != nil {
+			logger.Error.Println("Error setting up RabbitMQ", err)
+			cancel()
+			return
+		}
 	}
 
 	// Setup Database
@@ -76,6 +87,9 @@ func main() {
 	// Setup Midtrans Client
 	mtClient := setupMidtrans(env)
 
+	// Setup WhatsApp Cloud API Client (optional)
+	waClient := setupWhatsApp(env)
+
 	// Setup Server
 	setupServer(&config.SetupServerDto{
 		Rds:    redisClient,
@@ -85,19 +99,37 @@ func main() {
 		Db:     db,
 		Wg:     &wg,
 		Rb:     rabbit,
+		Rs:     streams,
 		Ai:     aiClient,
 		Mt:     mtClient,
+		Wa:     waClient,
 	})
 }
 
-func setupRedis(ctx context.Context, env *config.Config) (redis.IRedis, error) {
-	return redis.Setup(ctx, &redis.Config{
-		Host:     env.RedisHost,
-		Username: env.RedisUser,
-		Port:     env.RedisPort,
-		Password: env.RedisPass,
-		PoolSize: env.RedisPoolSize,
-	})
+func setupRedis(ctx context.Context, env *config.Config) (*redis.Client, error) {
+	cfg := &redis.Config{
+		Mode:             redis.Mode(env.RedisMode),
+		Host:             env.RedisHost,
+		Username:         env.RedisUser,
+		Port:             env.RedisPort,
+		Password:         env.RedisPass,
+		PoolSize:         env.RedisPoolSize,
+		DB:               env.RedisDB,
+		Addrs:            redis.ParseAddrs(env.RedisAddrs),
+		MasterName:       env.RedisMasterName,
+		SentinelUsername: env.RedisSentinelUser,
+		SentinelPassword: env.RedisSentinelPass,
+	}
+	if env.RedisTLS {
+		cfg.TLS = &redis.TLSConfig{
+			ServerName:         env.RedisTLSServerName,
+			CAFile:             env.RedisTLSCAFile,
+			CertFile:           env.RedisTLSCertFile,
+			KeyFile:            env.RedisTLSKeyFile,
+			InsecureSkipVerify: env.RedisTLSSkipVerify,
+		}
+	}
+	return redis.Setup(ctx, cfg)
 }
 
 func setupRabbitMQ(ctx context.Context, env *config.Config) (*rabbitmq.ConnectionManager, error) {
@@ -111,13 +143,15 @@ func setupRabbitMQ(ctx context.Context, env *config.Config) (*rabbitmq.Connectio
 
 func setupDB(env *config.Config) (*database.Database, error) {
 	return database.Setup(&database.Config{
-		Host:     env.DBHost,
-		Port:     env.DBPort,
-		User:     env.DBUser,
-		Password: env.DBPass,
-		Database: env.DBName,
-		SSLMode:  "disable",
-		Driver:   "postgres",
+		Host:         env.DBHost,
+		Port:         env.DBPort,
+		User:         env.DBUser,
+		Password:     env.DBPass,
+		Database:     env.DBName,
+		SSLMode:      env.DBSSLMode,
+		Driver:       database.DriverEnum(env.DBDriver),
+		MaxOpenConns: env.DBMaxOpenConns,
+		MaxIdleConns: env.DBMaxIdleConns,
 	})
 }
 
@@ -145,6 +179,19 @@ func setupMidtrans(env *config.Config) *midtransPkg.MidtransClient {
 	})
 }
 
+func setupWhatsApp(env *config.Config) *whatsappPkg.Client {
+	return whatsappPkg.Setup(&whatsappPkg.Config{
+		BaseURL:            env.WAAPIBaseURL,
+		APIVersion:         env.WAAPIVersion,
+		PhoneNumberID:      env.WAPhoneNumberID,
+		AccessToken:        env.WAAccessToken,
+		AppSecret:          env.WAAppSecret,
+		VerifyToken:        env.WAWebhookVerifyToken,
+		DefaultCountryCode: env.WACountryCode,
+		TemplateLanguage:   env.WATemplateLanguage,
+	})
+}
+
 func setupServer(payload *config.SetupServerDto) {
 	rds := payload.Rds
 	env := payload.Env
@@ -152,10 +199,12 @@ func setupServer(payload *config.SetupServerDto) {
 	cancel := payload.Cancel
 	wg := payload.Wg
 	rb := payload.Rb
+	rs := payload.Rs
 	db := payload.Db
 	s3 := payload.S3
 	ai := payload.Ai
 	mt := payload.Mt
+	wa := payload.Wa
 
 	defer func() {
 		if rds != nil {
@@ -172,20 +221,59 @@ func setupServer(payload *config.SetupServerDto) {
 	}
 
 	e := gin.Default()
+	// rate limits key on the client IP, X-Forwarded-For is only believed
+	// from TRUSTED_PROXIES
+	if err := e.SetTrustedProxies(splitList(env.TrustedProxies)); err != nil {
+		logger.Error.Println("Invalid TRUSTED_PROXIES")
+		panic(err)
+	}
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", env.AppPort),
 		Handler: e,
 	}
 
-	publisher, err := rabbitmq.NewPublisher(*ctx, rb)
-	if err != nil {
-		panic(err)
+	var broker rabbitmq.Broker
+	var publisher rabbitmq.MessagePublisher
+	if rs != nil {
+		broker, publisher = rs, rs
+	} else {
+		rabbitPublisher, err := rabbitmq.NewPublisher(*ctx, rb)
+		if err != nil {
+			panic(err)
+		}
+		broker, publisher = rb, rabbitPublisher
+	}
+
+	serverApp.Setup(e, *ctx, wg, db, rds, rb, broker, publisher, s3, ai, mt, wa, env.AppBaseURL, env.WAPrivateKeyPath, env.WAPrivateKeyPassphrase, env.WAPaidTemplate)
+
+	// Consumers normally run in cmd/worker, see APP_RUN_WORKERS
+	var registry *rabbitmq.Registry
+	if env.AppRunWorkers {
+		registry, err = serverApp.InitWorker(*ctx, rds, db, rb, publisher, s3, mt, wa, env.AppBaseURL, env.WAPaidTemplate)
+		if err != nil {
+			panic(err)
+		}
+		if err := registry.Start(*ctx, broker); err != nil {
+			panic(err)
+		}
 	}
 
-	serverApp.Setup(e, *ctx, wg, db, rds, rb, publisher, s3, ai, mt, env.AppBaseURL, env.WAPrivateKeyPath)
-	if payload.Env.AppEnv != "development" {
-		serverApp.InitWorker(*ctx, rds, db, rb, publisher, s3)
+	// Metrics stay off the public port, see METRICS_PORT
+	var metricsServer *http.Server
+	if env.MetricsPort > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:              fmt.Sprintf(":%d", env.MetricsPort),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error.Println("Metrics server error:", err)
+			}
+		}()
 	}
 
 	go func() {
@@ -201,4 +289,23 @@ func setupServer(payload *config.SetupServerDto) {
 	<-sigChan
 	logger.HTTP.Println("========= Server Shutting Down =========")
 	_ = server.Shutdown(*ctx)
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(*ctx)
+	}
+	if registry != nil {
+		if err := registry.Stop(); err != nil {
+			logger.Error.Println("Failed to stop consumers:", err)
+		}
+	}
+}
+
+// splitList splits a comma separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
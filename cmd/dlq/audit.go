@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	Action    string    `json:"action"`
+	Queue     string    `json:"queue"`
+	DLQ       string    `json:"dlq"`
+	MessageID string    `json:"message_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Retries   int       `json:"retries,omitempty"`
+	Count     int       `json:"count,omitempty"`
+}
+
+// auditLog appends JSON lines, it is opened before anything is changed so a
+// replay never happens without being recorded
+type auditLog struct {
+	file *os.File
+	user string
+	host string
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+
+	return &auditLog{file: file, user: name, host: host}, nil
+}
+
+func (a *auditLog) record(entry auditEntry) {
+	entry.Time = time.Now()
+	entry.User = a.user
+	entry.Host = a.host
+
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = a.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write audit log: %v\n", err)
+	}
+}
+
+func (a *auditLog) Close() error {
+	return a.file.Close()
+}
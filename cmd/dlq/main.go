@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"go-boilerplate/internal/pkg/helper"
+	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/rabbitmq"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: dlq <command> -queue <work queue> [flags]
+
+Commands:
+  list     Show the dead-lettered messages without removing them
+  show     Print one message with its headers and body
+  replay   Send messages back to the queue they failed on with a fresh retry count
+  purge    Delete every message in the dead letter queue
+  export   Write the messages as JSON
+
+The dead letter queue of <work queue> is fail:<work queue>. Replays and purges
+are appended to the audit log (-audit, DLQ_AUDIT_LOG, default dlq-audit.log).
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	_ = godotenv.Load()
+
+	// Keep stdout for the command output, export writes JSON there
+	logger.Setup()
+	for _, l := range []*log.Logger{logger.HTTP, logger.Info, logger.Warning, logger.Debug, logger.Error} {
+		l.SetOutput(os.Stderr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = runList(ctx, os.Args[2:])
+	case "show":
+		err = runShow(ctx, os.Args[2:])
+	case "replay":
+		err = runReplay(ctx, os.Args[2:])
+	case "purge":
+		err = runPurge(ctx, os.Args[2:])
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// commonFlags are shared by every command
+type commonFlags struct {
+	queue *string
+	uri   *string
+	audit *string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return fs, &commonFlags{
+		queue: fs.String("queue", "", "work queue whose dead letter queue to use (required)"),
+		uri:   fs.String("uri", "", "amqp URI, defaults to RABBIT_HOST/PORT/USER/PASS"),
+		audit: fs.String("audit", helper.GetEnv("DLQ_AUDIT_LOG", "dlq-audit.log"), "audit log file"),
+	}
+}
+
+func open(ctx context.Context, flags *commonFlags) (*rabbitmq.DeadLetterQueue, func(), error) {
+	if *flags.queue == "" {
+		return nil, nil, errors.New("-queue is required")
+	}
+
+	cm, err := rabbitmq.NewConnectionManager(ctx, &rabbitmq.Config{
+		URI:      *flags.uri,
+		Username: helper.GetEnv("RABBIT_USER", "guest"),
+		Password: helper.GetEnv("RABBIT_PASS", "guest"),
+		Host:     helper.GetEnv("RABBIT_HOST", "localhost"),
+		Port:     helper.GetEnvAsIntWithDefault("RABBIT_PORT", 5672),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q, err := rabbitmq.OpenDeadLetterQueue(cm, *flags.queue)
+	if err != nil {
+		_ = cm.Close()
+		return nil, nil, err
+	}
+
+	return q, func() {
+		_ = q.Close()
+		_ = cm.Close()
+	}, nil
+}
+
+func runList(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("list")
+	limit := fs.Int("limit", 50, "number of messages to show, 0 shows all")
+	_ = fs.Parse(args)
+
+	q, closeQueue, err := open(ctx, flags)
+	if err != nil {
+		return err
+	}
+	defer closeQueue()
+
+	count, err := q.Count()
+	if err != nil {
+		return err
+	}
+	letters, err := q.Peek(*limit)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d messages\n\n", q.Name, count)
+	if len(letters) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tMESSAGE ID\tQUEUE\tRETRIES\tAGE\tREASON")
+	for i, letter := range letters {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", i+1, letter.MessageID, letter.Queue, letter.Retries, formatAge(letter.Age()), truncate(letter.Reason, 80))
+	}
+	return w.Flush()
+}
+
+func runShow(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("show")
+	id := fs.String("id", "", "message id")
+	index := fs.Int("n", 0, "position shown by list, used when -id is empty")
+	_ = fs.Parse(args)
+
+	if *id == "" && *index <= 0 {
+		return errors.New("-id or -n is required")
+	}
+
+	q, closeQueue, err := open(ctx, flags)
+	if err != nil {
+		return err
+	}
+	defer closeQueue()
+
+	letters, err := q.Peek(max(*index, 0))
+	if err != nil {
+		return err
+	}
+
+	letter := findLetter(letters, *id, *index)
+	if letter == nil {
+		return fmt.Errorf("message not found in %s", q.Name)
+	}
+
+	fmt.Printf("Message ID : %s\n", letter.MessageID)
+	fmt.Printf("Queue      : %s\n", letter.Queue)
+	fmt.Printf("Retries    : %d\n", letter.Retries)
+	fmt.Printf("Age        : %s\n", formatAge(letter.Age()))
+	fmt.Printf("Reason     : %s\n", letter.Reason)
+	fmt.Printf("Type       : %s\n", letter.ContentType)
+	fmt.Println("Headers    :")
+	for key, value := range letter.Headers {
+		fmt.Printf("  %s: %v\n", key, value)
+	}
+	fmt.Println()
+	fmt.Println(formatBody(letter.Body))
+	return nil
+}
+
+func runReplay(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("replay")
+	id := fs.String("id", "", "replay the message with this id")
+	all := fs.Bool("all", false, "replay every message")
+	reason := fs.String("reason", "", "only replay messages whose reason contains this text (with -all)")
+	_ = fs.Parse(args)
+
+	if (*id == "") == !*all {
+		return errors.New("pass either -id or -all")
+	}
+
+	audit, err := openAuditLog(*flags.audit)
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+
+	q, closeQueue, err := open(ctx, flags)
+	if err != nil {
+		return err
+	}
+	defer closeQueue()
+
+	match := func(letter *rabbitmq.DeadLetter) bool {
+		if *id != "" {
+			return letter.MessageID == *id
+		}
+		return *reason == "" || strings.Contains(letter.Reason, *reason)
+	}
+
+	replayed, err := q.Replay(ctx, match, func(letter *rabbitmq.DeadLetter) {
+		audit.record(auditEntry{
+			Action:    "replay",
+			Queue:     letter.Queue,
+			DLQ:       q.Name,
+			MessageID: letter.MessageID,
+			Reason:    letter.Reason,
+			Retries:   letter.Retries,
+		})
+		fmt.Printf("Replayed %s to %s\n", letter.MessageID, letter.Queue)
+	})
+	if err != nil {
+		return fmt.Errorf("replayed %d messages before failing: %w", replayed, err)
+	}
+
+	if *id != "" && replayed == 0 {
+		return fmt.Errorf("message %s not found in %s", *id, q.Name)
+	}
+	fmt.Printf("Replayed %d messages\n", replayed)
+	return nil
+}
+
+func runPurge(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("purge")
+	yes := fs.Bool("yes", false, "confirm deleting every message")
+	_ = fs.Parse(args)
+
+	if !*yes {
+		return errors.New("purge deletes every message, pass -yes to confirm (export them first)")
+	}
+
+	audit, err := openAuditLog(*flags.audit)
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+
+	q, closeQueue, err := open(ctx, flags)
+	if err != nil {
+		return err
+	}
+	defer closeQueue()
+
+	purged, err := q.Purge()
+	if err != nil {
+		return err
+	}
+
+	audit.record(auditEntry{
+		Action: "purge",
+		Queue:  q.Source,
+		DLQ:    q.Name,
+		Count:  purged,
+	})
+	fmt.Printf("Purged %d messages from %s\n", purged, q.Name)
+	return nil
+}
+
+// exportedLetter keeps JSON bodies readable in the export
+type exportedLetter struct {
+	MessageID   string          `json:"message_id"`
+	Queue       string          `json:"queue"`
+	Reason      string          `json:"reason"`
+	Retries     int             `json:"retries"`
+	DiedAt      *time.Time      `json:"died_at,omitempty"`
+	Timestamp   *time.Time      `json:"timestamp,omitempty"`
+	ContentType string          `json:"content_type"`
+	Headers     map[string]any  `json:"headers"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	BodyText    string          `json:"body_text,omitempty"`
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("export")
+	output := fs.String("o", "-", "output file, - writes to stdout")
+	limit := fs.Int("limit", 0, "number of messages to export, 0 exports all")
+	_ = fs.Parse(args)
+
+	q, closeQueue, err := open(ctx, flags)
+	if err != nil {
+		return err
+	}
+	defer closeQueue()
+
+	letters, err := q.Peek(*limit)
+	if err != nil {
+		return err
+	}
+
+	exported := make([]exportedLetter, 0, len(letters))
+	for _, letter := range letters {
+		e := exportedLetter{
+			MessageID:   letter.MessageID,
+			Queue:       letter.Queue,
+			Reason:      letter.Reason,
+			Retries:     letter.Retries,
+			ContentType: letter.ContentType,
+			Headers:     letter.Headers,
+		}
+		if !letter.DiedAt.IsZero() {
+			e.DiedAt = &letter.DiedAt
+		}
+		if !letter.Timestamp.IsZero() {
+			e.Timestamp = &letter.Timestamp
+		}
+		if json.Valid(letter.Body) {
+			e.Body = letter.Body
+		} else {
+			e.BodyText = string(letter.Body)
+		}
+		exported = append(exported, e)
+	}
+
+	body, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal messages: %w", err)
+	}
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(append(body, '\n'))
+		return err
+	}
+
+	if err := os.WriteFile(*output, body, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d messages from %s to %s\n", len(exported), q.Name, *output)
+	return nil
+}
+
+func findLetter(letters []*rabbitmq.DeadLetter, id string, index int) *rabbitmq.DeadLetter {
+	if id == "" {
+		if index > 0 && index <= len(letters) {
+			return letters[index-1]
+		}
+		return nil
+	}
+
+	for _, letter := range letters {
+		if letter.MessageID == id {
+			return letter
+		}
+	}
+	return nil
+}
+
+func formatBody(body []byte) string {
+	var value any
+	if err := json.Unmarshal(body, &value); err == nil {
+		if pretty, err := json.MarshalIndent(value, "", "  "); err == nil {
+			return string(pretty)
+		}
+	}
+	return string(body)
+}
+
+func formatAge(age time.Duration) string {
+	switch {
+	case age <= 0:
+		return "-"
+	case age < time.Hour:
+		return age.Truncate(time.Second).String()
+	case age < 48*time.Hour:
+		return age.Truncate(time.Minute).String()
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
+
+func truncate(value string, length int) string {
+	value = strings.ReplaceAll(value, "\n", " ")
+	if len(value) <= length {
+		return value
+	}
+	return value[:length-3] + "..."
+}
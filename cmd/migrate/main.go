@@ -2,61 +2,210 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
 	config "go-boilerplate/configs"
 	database "go-boilerplate/internal/pkg/db"
 	"go-boilerplate/internal/pkg/logger"
-	"go-boilerplate/internal/pkg/rabbitmq"
+	"go-boilerplate/migrations"
 )
 
+const usage = `Usage: migrate <command> [args]
+
+Commands:
+  up             Apply every pending migration
+  down [N]       Revert the last N applied migrations (default 1)
+  status         List the migrations and whether they are applied
+  create <name>  Write empty up and down files for the next version in every driver
+                 directory of migrations/ (-dir to use another root)
+  force <V>      Record the database as migrated up to version V without running SQL,
+                 after repairing a failed migration by hand (0 forgets every migration)
+
+Migrations are the SQL files embedded from migrations/<DB_DRIVER>, rebuild after
+adding one. A migration whose first line is "-- migrate:no-transaction" runs
+outside a transaction and leaves the database dirty for force if it fails. MySQL
+commits DDL at once, so there every migration runs that way.
+`
+
 func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
 	logger.Setup()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "up":
+		err = withMigrator(ctx, runUp)
+	case "down":
+		err = withMigrator(ctx, func(ctx context.Context, m *database.Migrator) error {
+			return runDown(ctx, m, os.Args[2:])
+		})
+	case "status":
+		err = withMigrator(ctx, runStatus)
+	case "force":
+		err = withMigrator(ctx, func(ctx context.Context, m *database.Migrator) error {
+			return runForce(ctx, m, os.Args[2:])
+		})
+	case "create":
+		err = runCreate(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		logger.Error.Println(err)
+		os.Exit(1)
+	}
+}
+
+func withMigrator(ctx context.Context, fn func(ctx context.Context, m *database.Migrator) error) error {
 	env, err := config.GetEnv()
 	if err != nil {
-		logger.Error.Println("Error getting environment", err)
-		panic(err)
+		return fmt.Errorf("error getting environment: %w", err)
 	}
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel() // Ensure context is canceled when done
 
-	// Setup Database
 	db, err := setupDB(env)
 	if err != nil {
-		logger.Error.Println("Error setting up Database", err)
-		return
+		return fmt.Errorf("error setting up database: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	fsys, err := migrations.For(env.DBDriver)
+	if err != nil {
+		return err
+	}
+	migrator, err := database.NewMigrator(db, fsys)
+	if err != nil {
+		return err
 	}
+	return fn(ctx, migrator)
+}
+
+func runUp(ctx context.Context, m *database.Migrator) error {
+	applied, err := m.Up(ctx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		logger.Info.Println("No pending migrations")
+		return nil
+	}
+	logger.Info.Printf("Applied %d migrations", len(applied))
+	return nil
+}
 
-	defer func() {
-		if db != nil {
-			db.Close()
+func runDown(ctx context.Context, m *database.Migrator, args []string) error {
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations %q", args[0])
 		}
-	}()
+	}
 
-	err = db.RunMigrations()
+	reverted, err := m.Down(ctx, n)
 	if err != nil {
-		logger.Error.Println("Error running migrations", err)
-		return
+		return err
 	}
+	logger.Info.Printf("Reverted %d migrations", len(reverted))
+	return nil
+}
 
-	logger.Info.Println("Migrations completed successfully")
+func runStatus(ctx context.Context, m *database.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state = "applied"
+			appliedAt = status.AppliedAt.Local().Format(time.DateTime)
+		}
+		switch {
+		case status.Dirty:
+			state = "dirty"
+		case status.Missing:
+			state = "applied, file missing"
+		case status.Modified:
+			state = "applied, file modified"
+		}
+		fmt.Fprintf(w, "%06d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	return w.Flush()
 }
 
-func setupDB(env *config.Config) (*database.Database, error) {
-	return database.Setup(&database.Config{
-		Host:     env.DBHost,
-		Port:     env.DBPort,
-		User:     env.DBUser,
-		Password: env.DBPass,
-		Database: env.DBName,
-		SSLMode:  "disable",
-		Driver:   "postgres",
-	})
+func runForce(ctx context.Context, m *database.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New("force needs a version")
+	}
+	version, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || version < 0 {
+		return fmt.Errorf("invalid version %q", args[0])
+	}
+
+	if err := m.Force(ctx, version); err != nil {
+		return err
+	}
+	logger.Info.Printf("Forced version %d", version)
+	return nil
 }
 
-func setupRabbitMQ(ctx context.Context, env *config.Config) (*rabbitmq.ConnectionManager, error) {
-	return rabbitmq.NewConnectionManager(ctx, &rabbitmq.Config{
-		Username: env.RabbitUser,
-		Password: env.RabbitPass,
-		Host:     env.RabbitHost,
-		Port:     env.RabbitPort,
+func runCreate(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	root := fs.String("dir", "migrations", "migrations directory")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("create needs a name")
+	}
+
+	dirs := make([]string, len(migrations.Dirs))
+	for i, dir := range migrations.Dirs {
+		dirs[i] = filepath.Join(*root, dir)
+	}
+	paths, err := database.CreateMigration(fs.Arg(0), dirs...)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func setupDB(env *config.Config) (*database.Database, error) {
+	return database.Setup(&database.Config{
+		Host:            env.DBHost,
+		Port:            env.DBPort,
+		User:            env.DBUser,
+		Password:        env.DBPass,
+		Database:        env.DBName,
+		SSLMode:         env.DBSSLMode,
+		Driver:          database.DriverEnum(env.DBDriver),
+		MaxOpenConns:    env.DBMaxOpenConns,
+		MaxIdleConns:    env.DBMaxIdleConns,
+		MultiStatements: true,
 	})
 }
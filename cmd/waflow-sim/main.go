@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-boilerplate/internal/pkg/helper"
+	"go-boilerplate/internal/pkg/waflow"
+	"go-boilerplate/internal/pkg/waflow/schema"
+
+	"github.com/joho/godotenv"
+)
+
+// formFlag collects repeated -form key=value flags
+type formFlag map[string]string
+
+func (f formFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f formFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[key] = val
+	return nil
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	form := formFlag{}
+	endpoint := flag.String("url", helper.GetEnv("APP_BASE_URL", "http://localhost:8080")+"/api/v1/payments/wa-flow-endpoint", "flow endpoint URL")
+	keyPath := flag.String("key", defaultKeyPath(), "public key PEM, or the private key whose public half is used (defaults to the first WA_PRIVATE_KEY_PATH)")
+	passphrase := flag.String("passphrase", helper.GetEnv("WA_PRIVATE_KEY_PASSPHRASE"), "passphrase of an encrypted private key")
+	flowPath := flag.String("flow", "flow.json", "flow json played by the simulator")
+	flowToken := flag.String("token", "", "flow_token sent with every request")
+	initData := flag.String("init", "", "INIT data as JSON, defaults to the first screen's __example__ values")
+	scenarioPath := flag.String("scenario", "", "run the scripted scenarios of a YAML file instead of playing the flow")
+	verbose := flag.Bool("v", false, "print request data for ping as well")
+	flag.Var(form, "form", "form value used when pressing a Footer, repeatable (key=value)")
+	flag.Parse()
+
+	if *keyPath == "" {
+		exit(fmt.Errorf("no key given: set WA_PRIVATE_KEY_PATH or pass -key"))
+	}
+
+	publicKey, err := waflow.LoadPublicKey(*keyPath, *passphrase)
+	if err != nil {
+		exit(err)
+	}
+
+	body, err := os.ReadFile(*flowPath)
+	if err != nil {
+		exit(fmt.Errorf("failed to read %s: %w", *flowPath, err))
+	}
+	flow, err := schema.Parse(body)
+	if err != nil {
+		exit(err)
+	}
+	if len(flow.Screens) == 0 {
+		exit(fmt.Errorf("%s has no screens", *flowPath))
+	}
+
+	newSessionFor := func(token string) *session {
+		s := newSession(*endpoint, publicKey, flow, token)
+		s.verbose = *verbose
+		return s
+	}
+
+	if *scenarioPath != "" {
+		file, err := loadScenarios(*scenarioPath)
+		if err != nil {
+			exit(err)
+		}
+		if *flowToken != "" {
+			file.FlowToken = *flowToken
+		}
+		if failed := runScenarios(file, newSessionFor); failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	data := examples(&flow.Screens[0])
+	if *initData != "" {
+		data = map[string]interface{}{}
+		if err := json.Unmarshal([]byte(*initData), &data); err != nil {
+			exit(fmt.Errorf("invalid -init JSON: %w", err))
+		}
+	}
+
+	token := *flowToken
+	if token == "" {
+		id, err := helper.GenerateID()
+		if err != nil {
+			exit(err)
+		}
+		token = "sim-" + id
+	}
+
+	fmt.Printf("Playing %s against %s (flow_token=%s)\n\n", *flowPath, *endpoint, token)
+	if err := newSessionFor(token).play(data, form); err != nil {
+		exit(err)
+	}
+}
+
+// defaultKeyPath is the active key, the first one of WA_PRIVATE_KEY_PATH
+func defaultKeyPath() string {
+	if paths := waflow.ParseKeyPaths(helper.GetEnv("WA_PRIVATE_KEY_PATH")); len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// scenarioFile is the YAML document accepted by -scenario
+//
+//	flow_token: sim-token
+//	scenarios:
+//	  - name: order summary
+//	    steps:
+//	      - action: ping
+//	        expect: {data: {status: active}}
+//	      - action: INIT
+//	        expect: {screen: ORDER_FORM}
+//	      - action: data_exchange
+//	        form: {nama_penerima: Budi}
+//	        expect:
+//	          screen: SUMMARY_ORDER
+//	          data: {nama_penerima: Budi}
+//	      - action: BACK
+type scenarioFile struct {
+	FlowToken string     `yaml:"flow_token"`
+	Scenarios []scenario `yaml:"scenarios"`
+}
+
+type scenario struct {
+	Name      string `yaml:"name"`
+	FlowToken string `yaml:"flow_token"`
+	Steps     []step `yaml:"steps"`
+}
+
+type step struct {
+	Action string                 `yaml:"action"`
+	Screen string                 `yaml:"screen"` // defaults to the current screen
+	Data   map[string]interface{} `yaml:"data"`   // sent as-is when set
+	Form   map[string]string      `yaml:"form"`   // used to resolve the screen's Footer payload
+	Expect *expectation           `yaml:"expect"`
+}
+
+type expectation struct {
+	Screen string                 `yaml:"screen"`
+	Data   map[string]interface{} `yaml:"data"` // subset of the response data
+	Error  bool                   `yaml:"error"`
+}
+
+func loadScenarios(path string) (*scenarioFile, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario file: %w", err)
+	}
+
+	var file scenarioFile
+	if err := yaml.Unmarshal(body, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file: %w", err)
+	}
+	if len(file.Scenarios) == 0 {
+		return nil, fmt.Errorf("scenario file %s has no scenarios", path)
+	}
+	return &file, nil
+}
+
+// runScenarios runs every scenario in a fresh session and returns the number of failures
+func runScenarios(file *scenarioFile, newSession func(flowToken string) *session) int {
+	failed := 0
+	for i, sc := range file.Scenarios {
+		name := sc.Name
+		if name == "" {
+			name = fmt.Sprintf("scenario #%d", i+1)
+		}
+
+		flowToken := sc.FlowToken
+		if flowToken == "" {
+			flowToken = file.FlowToken
+		}
+		if flowToken == "" {
+			flowToken = fmt.Sprintf("sim-%d", i+1)
+		}
+
+		fmt.Printf("=== %s\n", name)
+		if err := runScenario(newSession(flowToken), sc); err != nil {
+			failed++
+			fmt.Printf("--- FAIL %s: %v\n\n", name, err)
+			continue
+		}
+		fmt.Printf("--- PASS %s\n\n", name)
+	}
+
+	fmt.Printf("%d passed, %d failed\n", len(file.Scenarios)-failed, failed)
+	return failed
+}
+
+func runScenario(s *session, sc scenario) error {
+	for i, st := range sc.Steps {
+		if err := runStep(s, st); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, st.Action, err)
+		}
+	}
+	return nil
+}
+
+func runStep(s *session, st step) error {
+	screenID := st.Screen
+	if screenID == "" {
+		screenID = s.screen
+	}
+
+	data := st.Data
+	switch st.Action {
+	case "ping":
+		screenID = ""
+	case "INIT":
+		screenID = ""
+		if data == nil && len(s.flow.Screens) > 0 {
+			data = examples(&s.flow.Screens[0])
+		}
+	case "data_exchange":
+		if data == nil {
+			screen := s.flow.Screen(screenID)
+			if screen == nil {
+				return fmt.Errorf("unknown screen %q", screenID)
+			}
+			action := footerAction(screen)
+			if action == nil {
+				return fmt.Errorf("screen %s has no Footer action", screenID)
+			}
+			resolved, err := s.resolvePayload(screen, action.Payload, st.Form)
+			if err != nil {
+				return err
+			}
+			data = resolved
+		}
+	case "BACK":
+	default:
+		return fmt.Errorf("unsupported action %q, expected ping, INIT, data_exchange or BACK", st.Action)
+	}
+
+	response, err := s.send(st.Action, screenID, data)
+	if st.Expect != nil && st.Expect.Error {
+		if err == nil {
+			return fmt.Errorf("expected the endpoint to reject the request")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if st.Expect == nil {
+		return nil
+	}
+	if st.Expect.Screen != "" && response.Screen != st.Expect.Screen {
+		return fmt.Errorf("expected screen %s, got %q", st.Expect.Screen, response.Screen)
+	}
+	return matchData("data", st.Expect.Data, response.Data)
+}
+
+// matchData checks that every expected key is present with an equal value
+func matchData(path string, expected, actual map[string]interface{}) error {
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		want := expected[k]
+		got, ok := actual[k]
+		if !ok {
+			return fmt.Errorf("%s.%s is missing", path, k)
+		}
+
+		if wantMap, ok := want.(map[string]interface{}); ok {
+			gotMap, ok := got.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.%s: expected an object, got %v", path, k, got)
+			}
+			if err := matchData(path+"."+k, wantMap, gotMap); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if fmt.Sprint(want) != fmt.Sprint(got) && !reflect.DeepEqual(want, got) {
+			return fmt.Errorf("%s.%s: expected %v, got %v", path, k, want, got)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-boilerplate/internal/pkg/waflow"
+	"go-boilerplate/internal/pkg/waflow/schema"
+)
+
+// session plays a flow against the endpoint the way the WhatsApp client does
+type session struct {
+	endpoint  string
+	publicKey *rsa.PublicKey
+	flow      *schema.Flow
+	flowToken string
+	version   string
+	client    *http.Client
+	verbose   bool
+
+	// current screen and the data the endpoint returned for it
+	screen string
+	data   map[string]interface{}
+}
+
+func newSession(endpoint string, publicKey *rsa.PublicKey, flow *schema.Flow, flowToken string) *session {
+	return &session{
+		endpoint:  endpoint,
+		publicKey: publicKey,
+		flow:      flow,
+		flowToken: flowToken,
+		version:   schema.DataAPIVersion,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		data:      map[string]interface{}{},
+	}
+}
+
+// send encrypts one request, posts it and decrypts the flipped-IV response
+func (s *session) send(action, screen string, data map[string]interface{}) (*waflow.FlowResponse, error) {
+	request := waflow.DecryptedRequest{
+		Version:   s.version,
+		Action:    action,
+		Screen:    screen,
+		Data:      data,
+		FlowToken: s.flowToken,
+	}
+
+	encrypted, aesKey, iv, err := waflow.EncryptRequest(s.publicKey, request)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal encrypted request: %w", err)
+	}
+
+	printJSON("→ "+describe(action, screen), data, s.verbose || action != "ping")
+
+	started := time.Now()
+	resp, err := s.client.Post(s.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	response, err := waflow.DecryptResponse(aesKey, iv, string(respBody))
+	if err != nil {
+		return nil, err
+	}
+
+	label := fmt.Sprintf("← %s (%s)", describe("", response.Screen), time.Since(started).Round(time.Millisecond))
+	printJSON(label, response.Data, true)
+
+	if response.Screen != "" {
+		s.screen = response.Screen
+		s.data = response.Data
+		if s.data == nil {
+			s.data = map[string]interface{}{}
+		}
+	}
+	return response, nil
+}
+
+// play walks the flow from INIT until a terminal screen completes, pressing
+// the Footer of every screen with the given form values
+func (s *session) play(initData map[string]interface{}, form map[string]string) error {
+	if _, err := s.send("ping", "", nil); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+
+	if _, err := s.send("INIT", "", initData); err != nil {
+		return fmt.Errorf("INIT: %w", err)
+	}
+
+	for step := 0; step < 50; step++ {
+		screen := s.flow.Screen(s.screen)
+		if screen == nil {
+			return fmt.Errorf("endpoint returned unknown screen %q", s.screen)
+		}
+
+		action := footerAction(screen)
+		if action == nil {
+			return fmt.Errorf("screen %s has no Footer action", screen.ID)
+		}
+
+		payload, err := s.resolvePayload(screen, action.Payload, form)
+		if err != nil {
+			return err
+		}
+
+		switch action.Name {
+		case schema.ActionDataExchange:
+			if _, err := s.send(string(schema.ActionDataExchange), screen.ID, payload); err != nil {
+				return fmt.Errorf("data_exchange on %s: %w", screen.ID, err)
+			}
+		case schema.ActionNavigate:
+			// navigate is handled by the client, no request is sent
+			fmt.Printf("⇢ navigate %s → %s\n", screen.ID, action.Next.Name)
+			s.screen = action.Next.Name
+			s.data = payload
+		case schema.ActionComplete:
+			printJSON("✔ complete "+screen.ID, payload, true)
+			return nil
+		default:
+			return fmt.Errorf("screen %s: action %s is not supported by the simulator", screen.ID, action.Name)
+		}
+	}
+
+	return fmt.Errorf("flow did not complete after 50 screens")
+}
+
+// resolvePayload replaces ${data.x} and ${form.x} bindings with values
+func (s *session) resolvePayload(screen *schema.Screen, payload schema.Payload, form map[string]string) (map[string]interface{}, error) {
+	values := formValues(s.flow, screen, form)
+
+	out := make(map[string]interface{}, len(payload))
+	for _, field := range payload {
+		str, ok := field.Value.(string)
+		if !ok {
+			out[field.Key] = field.Value
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(str, "${data.") && strings.HasSuffix(str, "}"):
+			out[field.Key] = s.data[strings.TrimSuffix(strings.TrimPrefix(str, "${data."), "}")]
+		case strings.HasPrefix(str, "${form.") && strings.HasSuffix(str, "}"):
+			name := strings.TrimSuffix(strings.TrimPrefix(str, "${form."), "}")
+			value, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("screen %s: no value for form field %q", screen.ID, name)
+			}
+			out[field.Key] = value
+		default:
+			out[field.Key] = str
+		}
+	}
+	return out, nil
+}
+
+// formValues fills every input of the screen. Explicit values win, then the
+// `__example__` of a data field with the same name on any screen, then a
+// placeholder
+func formValues(flow *schema.Flow, screen *schema.Screen, form map[string]string) map[string]string {
+	values := make(map[string]string)
+	for _, child := range screen.Layout.Children {
+		input, ok := child.(schema.InputComponent)
+		if !ok {
+			continue
+		}
+		name := input.FieldName()
+
+		if value, ok := form[name]; ok {
+			values[name] = value
+			continue
+		}
+
+		values[name] = "sim-" + name
+		for _, other := range flow.Screens {
+			if field := other.Data.Field(name); field != nil {
+				if example, ok := field.Example.(string); ok {
+					values[name] = example
+					break
+				}
+			}
+		}
+	}
+	return values
+}
+
+func footerAction(screen *schema.Screen) *schema.Action {
+	for _, child := range screen.Layout.Children {
+		if footer, ok := child.(schema.Footer); ok {
+			return footer.ClickAction()
+		}
+	}
+	return nil
+}
+
+// examples returns the `__example__` values declared on a screen
+func examples(screen *schema.Screen) map[string]interface{} {
+	data := make(map[string]interface{}, len(screen.Data))
+	for _, field := range screen.Data {
+		data[field.Name] = field.Example
+	}
+	return data
+}
+
+func describe(action, screen string) string {
+	parts := make([]string, 0, 2)
+	if action != "" {
+		parts = append(parts, action)
+	}
+	if screen != "" {
+		parts = append(parts, "screen="+screen)
+	}
+	if len(parts) == 0 {
+		return "response"
+	}
+	return strings.Join(parts, " ")
+}
+
+func printJSON(label string, data map[string]interface{}, withData bool) {
+	fmt.Println(label)
+	if !withData || len(data) == 0 {
+		return
+	}
+	body, err := json.MarshalIndent(data, "    ", "  ")
+	if err != nil {
+		fmt.Printf("    %v\n", data)
+		return
+	}
+	fmt.Printf("    %s\n", body)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	paymentHandler "go-boilerplate/internal/handler/payment"
+	"go-boilerplate/internal/pkg/helper"
+	"go-boilerplate/internal/pkg/waflow"
+	"go-boilerplate/internal/pkg/waflow/schema"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: waflow <command> [flags]
+
+Commands:
+  generate   Write flow.json from the Go flow definition
+  lint       Validate flow.json and check it matches the Go flow definition
+  keygen     Create a WhatsApp Flows key pair and print the public key for Meta
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = runGenerate(os.Args[2:])
+	case "lint":
+		err = runLint(os.Args[2:])
+	case "keygen":
+		err = runKeygen(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	output := fs.String("o", "flow.json", "output file, use - for stdout")
+	_ = fs.Parse(args)
+
+	flow := paymentHandler.WAFlowDefinition()
+	if err := paymentHandler.ValidateWAFlow(flow); err != nil {
+		return fmt.Errorf("flow definition is invalid: %w", err)
+	}
+
+	body, err := flow.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal flow: %w", err)
+	}
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(append(body, '\n'))
+		return err
+	}
+
+	if err := os.WriteFile(*output, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	fmt.Printf("Wrote %s\n", *output)
+	return nil
+}
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	file := fs.String("f", "flow.json", "flow json file to lint")
+	skipDrift := fs.Bool("no-drift", false, "skip comparing the file with the Go flow definition")
+	_ = fs.Parse(args)
+
+	body, err := os.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", *file, err)
+	}
+
+	flow, err := schema.Parse(body)
+	if err != nil {
+		return err
+	}
+
+	if err := paymentHandler.ValidateWAFlow(flow); err != nil {
+		return fmt.Errorf("%s is invalid:\n%w", *file, err)
+	}
+
+	if !*skipDrift {
+		expected, err := paymentHandler.WAFlowDefinition().Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal flow definition: %w", err)
+		}
+		if !bytes.Equal(bytes.TrimSpace(body), expected) {
+			return fmt.Errorf("%s is out of date with the Go flow definition, run `make waflow-generate`", *file)
+		}
+	}
+
+	fmt.Printf("%s OK\n", *file)
+	return nil
+}
+
+func runKeygen(args []string) error {
+	_ = godotenv.Load()
+
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "wa_private_key", "output prefix, writes <out>.pem and <out>.pub.pem")
+	bits := fs.Int("bits", 2048, "RSA key size")
+	passphrase := fs.String("passphrase", helper.GetEnv("WA_PRIVATE_KEY_PASSPHRASE"), "encrypt the private key (defaults to WA_PRIVATE_KEY_PASSPHRASE, empty writes it unencrypted)")
+	force := fs.Bool("force", false, "overwrite existing files")
+	_ = fs.Parse(args)
+
+	privatePath, publicPath := *out+".pem", *out+".pub.pem"
+	if !*force {
+		for _, path := range []string{privatePath, publicPath} {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists, pass -force to overwrite", path)
+			}
+		}
+	}
+
+	privatePEM, publicPEM, err := waflow.GenerateKeyPair(*bits, *passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(privatePath, privatePEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", privatePath, err)
+	}
+	if err := os.WriteFile(publicPath, publicPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", publicPath, err)
+	}
+
+	encrypted := "unencrypted"
+	if *passphrase != "" {
+		encrypted = "encrypted with the passphrase"
+	}
+	fmt.Printf("Wrote %s (%s) and %s\n\n", privatePath, encrypted, publicPath)
+	fmt.Printf("Upload the public key to Meta (POST /<PHONE_NUMBER_ID>/whatsapp_business_encryption, field business_public_key):\n\n%s\n", publicPEM)
+	fmt.Printf("To rotate without downtime, put the new key first in WA_PRIVATE_KEY_PATH, e.g.\n\n    WA_PRIVATE_KEY_PATH=%s,<current key>\n\nthen send SIGHUP to the API (or restart), upload the public key, and drop the old path once clients have switched.\n", privatePath)
+	return nil
+}
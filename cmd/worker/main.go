@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	config "go-boilerplate/configs"
+	database "go-boilerplate/internal/pkg/db"
+	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/metrics"
+	midtransPkg "go-boilerplate/internal/pkg/midtrans"
+	"go-boilerplate/internal/pkg/rabbitmq"
+	"go-boilerplate/internal/pkg/redis"
+	"go-boilerplate/internal/pkg/redisstream"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
+	serverApp "go-boilerplate/internal/server"
+)
+
+// Worker runs the queue consumers apart from the API so both scale on their
+// own. On WORKER_PORT, GET /health reports every consumer and GET /metrics
+// serves the queue metrics for Prometheus. SIGTERM stops consuming and lets
+// in-flight messages finish before exiting.
+func main() {
+	logger.Setup()
+
+	env, err := config.GetEnv()
+	if err != nil {
+		logger.Error.Println("Error getting environment", err)
+		panic(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	redisClient, err := setupRedis(ctx, env)
+	if err != nil {
+		logger.Error.Println("Error setting up Redis", err)
+		return
+	}
+	defer func() { _ = redisClient.Close() }()
+
+	db, err := setupDB(env)
+	if err != nil {
+		logger.Error.Println("Error setting up Database", err)
+		return
+	}
+	defer db.Close()
+
+	// Events go over RabbitMQ, or over Redis Streams with EVENT_TRANSPORT=redis
+	var rabbit *rabbitmq.ConnectionManager
+	var broker rabbitmq.Broker
+	var publisher rabbitmq.MessagePublisher
+	var connected func() bool
+	if env.EventTransport == "redis" {
+		streams := redisstream.NewBroker(ctx, redisClient, nil)
+		defer func() { _ = streams.Close() }()
+		broker, publisher, connected = streams, streams, streams.Healthy
+	} else {
+		rabbit, err = setupRabbitMQ(ctx, env)
+		if err != nil {
+			logger.Error.Println("Error setting up RabbitMQ", err)
+			return
+		}
+		defer func() { _ = rabbit.Close() }()
+
+		rabbitPublisher, err := rabbitmq.NewPublisher(ctx, rabbit)
+		if err != nil {
+			logger.Error.Println("Error setting up publisher", err)
+			return
+		}
+		defer func() { _ = rabbitPublisher.Close() }()
+
+		broker, publisher = rabbit, rabbitPublisher
+		connected = func() bool {
+			conn := rabbit.GetConnection()
+			return conn != nil && !conn.IsClosed()
+		}
+	}
+
+	registry, err := serverApp.InitWorker(ctx, redisClient, db, rabbit, publisher, nil, setupMidtrans(env), setupWhatsApp(env), env.AppBaseURL, env.WAPaidTemplate)
+	if err != nil {
+		logger.Error.Println("Error registering consumers", err)
+		return
+	}
+
+	if err := registry.Start(ctx, broker, parseConsumers(env.WorkerConsumers)...); err != nil {
+		logger.Error.Println("Error starting consumers", err)
+		_ = registry.Stop()
+		return
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", env.WorkerPort),
+		Handler:           healthHandler(registry, connected),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Info.Printf("========= Worker Started (health on %d) =========", env.WorkerPort)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error.Println("Health server error:", err)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	logger.Info.Println("========= Worker Draining =========")
+	if err := registry.Stop(); err != nil {
+		logger.Error.Println("Failed to drain consumers:", err)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	_ = server.Shutdown(shutdownCtx)
+	logger.Info.Println("========= Worker Stopped =========")
+}
+
+// healthHandler reports the consumers and the event transport, connected
+// tells whether RabbitMQ or Redis is reachable
+func healthHandler(registry *rabbitmq.Registry, connected func() bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		up := connected()
+
+		status := http.StatusOK
+		if !up || !registry.Healthy() {
+			status = http.StatusServiceUnavailable
+		}
+
+		transportHealth := "unhealthy"
+		if up {
+			transportHealth = "healthy"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"status":    status,
+			"transport": transportHealth,
+			"consumers": registry.Health(),
+		})
+	})
+	return mux
+}
+
+func parseConsumers(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func setupRedis(ctx context.Context, env *config.Config) (*redis.Client, error) {
+	cfg := &redis.Config{
+		Mode:             redis.Mode(env.RedisMode),
+		Host:             env.RedisHost,
+		Username:         env.RedisUser,
+		Port:             env.RedisPort,
+		Password:         env.RedisPass,
+		PoolSize:         env.RedisPoolSize,
+		DB:               env.RedisDB,
+		Addrs:            redis.ParseAddrs(env.RedisAddrs),
+		MasterName:       env.RedisMasterName,
+		SentinelUsername: env.RedisSentinelUser,
+		SentinelPassword: env.RedisSentinelPass,
+	}
+	if env.RedisTLS {
+		cfg.TLS = &redis.TLSConfig{
+			ServerName:         env.RedisTLSServerName,
+			CAFile:             env.RedisTLSCAFile,
+			CertFile:           env.RedisTLSCertFile,
+			KeyFile:            env.RedisTLSKeyFile,
+			InsecureSkipVerify: env.RedisTLSSkipVerify,
+		}
+	}
+	return redis.Setup(ctx, cfg)
+}
+
+func setupRabbitMQ(ctx context.Context, env *config.Config) (*rabbitmq.ConnectionManager, error) {
+	return rabbitmq.NewConnectionManager(ctx, &rabbitmq.Config{
+		Username: env.RabbitUser,
+		Password: env.RabbitPass,
+		Host:     env.RabbitHost,
+		Port:     env.RabbitPort,
+	})
+}
+
+func setupDB(env *config.Config) (*database.Database, error) {
+	return database.Setup(&database.Config{
+		Host:         env.DBHost,
+		Port:         env.DBPort,
+		User:         env.DBUser,
+		Password:     env.DBPass,
+		Database:     env.DBName,
+		SSLMode:      env.DBSSLMode,
+		Driver:       database.DriverEnum(env.DBDriver),
+		MaxOpenConns: env.DBMaxOpenConns,
+		MaxIdleConns: env.DBMaxIdleConns,
+	})
+}
+
+func setupMidtrans(env *config.Config) *midtransPkg.MidtransClient {
+	return midtransPkg.Setup(&midtransPkg.Config{
+		ServerKey:   env.MidtransServerKey,
+		ClientKey:   env.MidtransClientKey,
+		Environment: env.MidtransEnvironment,
+	})
+}
+
+func setupWhatsApp(env *config.Config) *whatsappPkg.Client {
+	return whatsappPkg.Setup(&whatsappPkg.Config{
+		BaseURL:            env.WAAPIBaseURL,
+		APIVersion:         env.WAAPIVersion,
+		PhoneNumberID:      env.WAPhoneNumberID,
+		AccessToken:        env.WAAccessToken,
+		AppSecret:          env.WAAppSecret,
+		VerifyToken:        env.WAWebhookVerifyToken,
+		DefaultCountryCode: env.WACountryCode,
+		TemplateLanguage:   env.WATemplateLanguage,
+	})
+}
@@ -27,8 +27,13 @@ func GetEnv() (config *Config, er error) {
 		if envTag != "" {
 			value, exists := os.LookupEnv(envTag)
 			if !exists {
-				er = fmt.Errorf("environment variable %s not set", envTag)
-				return nil, er
+				// Optional settings declare an envDefault, everything else is required
+				defaultValue, hasDefault := field.Tag.Lookup("envDefault")
+				if !hasDefault {
+					er = fmt.Errorf("environment variable %s not set", envTag)
+					return nil, er
+				}
+				value = defaultValue
 			}
 
 			switch field.Type.Kind() {
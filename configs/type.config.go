@@ -8,7 +8,9 @@ import (
 	midtransPkg "go-boilerplate/internal/pkg/midtrans"
 	"go-boilerplate/internal/pkg/rabbitmq"
 	"go-boilerplate/internal/pkg/redis"
+	"go-boilerplate/internal/pkg/redisstream"
 	s3aws "go-boilerplate/internal/pkg/storage/s3"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
 	"sync"
 )
 
@@ -41,8 +43,61 @@ type Config struct {
 	// App Base URL (for payment redirect URLs)
 	AppBaseURL string `env:"APP_BASE_URL" envDefault:"http://localhost:8080"`
 
-	// WhatsApp Flows private key path
-	WAPrivateKeyPath string `env:"WA_PRIVATE_KEY_PATH" envDefault:""`
+	// Proxies whose X-Forwarded-For is believed, comma separated IPs or
+	// CIDRs. Empty trusts none, the client IP is then the peer address.
+	TrustedProxies string `env:"TRUSTED_PROXIES" envDefault:""`
+
+	// WhatsApp Flows private key paths, comma separated with the active key first
+	WAPrivateKeyPath       string `env:"WA_PRIVATE_KEY_PATH" envDefault:""`
+	WAPrivateKeyPassphrase string `env:"WA_PRIVATE_KEY_PASSPHRASE" envDefault:""`
+
+	// WhatsApp Cloud API (WA_API_BASE_URL can point to a local stub)
+	WAAPIBaseURL         string `env:"WA_API_BASE_URL" envDefault:"https://graph.facebook.com"`
+	WAAPIVersion         string `env:"WA_API_VERSION" envDefault:"v21.0"`
+	WAPhoneNumberID      string `env:"WA_PHONE_NUMBER_ID" envDefault:""`
+	WAAccessToken        string `env:"WA_ACCESS_TOKEN" envDefault:""`
+	WAAppSecret          string `env:"WA_APP_SECRET" envDefault:""`
+	WAWebhookVerifyToken string `env:"WA_WEBHOOK_VERIFY_TOKEN" envDefault:""`
+	WACountryCode        string `env:"WA_DEFAULT_COUNTRY_CODE" envDefault:"62"`
+	WATemplateLanguage   string `env:"WA_TEMPLATE_LANGUAGE" envDefault:"id"`
+	WAPaidTemplate       string `env:"WA_PAID_TEMPLATE" envDefault:""`
+
+	// Database driver, postgres or mysql. DB_SSL_MODE takes the PostgreSQL
+	// values and is mapped for MySQL.
+	DBDriver       string `env:"DB_DRIVER" envDefault:"postgres"`
+	DBSSLMode      string `env:"DB_SSL_MODE" envDefault:"disable"`
+	DBMaxOpenConns int    `env:"DB_MAX_OPEN_CONNS" envDefault:"20"`
+	DBMaxIdleConns int    `env:"DB_MAX_IDLE_CONNS" envDefault:"10"`
+
+	// Redis topology, REDIS_MODE is single, sentinel or cluster. Sentinel and
+	// cluster connect to the comma separated REDIS_ADDRS instead of
+	// REDIS_HOST and REDIS_PORT. REDIS_TLS_CA_FILE trusts a private CA.
+	RedisMode          string `env:"REDIS_MODE" envDefault:"single"`
+	RedisAddrs         string `env:"REDIS_ADDRS" envDefault:""`
+	RedisMasterName    string `env:"REDIS_MASTER_NAME" envDefault:""`
+	RedisSentinelUser  string `env:"REDIS_SENTINEL_USER" envDefault:""`
+	RedisSentinelPass  string `env:"REDIS_SENTINEL_PASS" envDefault:""`
+	RedisDB            int    `env:"REDIS_DB" envDefault:"0"`
+	RedisTLS           bool   `env:"REDIS_TLS" envDefault:"false"`
+	RedisTLSServerName string `env:"REDIS_TLS_SERVER_NAME" envDefault:""`
+	RedisTLSCAFile     string `env:"REDIS_TLS_CA_FILE" envDefault:""`
+	RedisTLSCertFile   string `env:"REDIS_TLS_CERT_FILE" envDefault:""`
+	RedisTLSKeyFile    string `env:"REDIS_TLS_KEY_FILE" envDefault:""`
+	RedisTLSSkipVerify bool   `env:"REDIS_TLS_SKIP_VERIFY" envDefault:"false"`
+
+	// Events go over RabbitMQ, or with "redis" over Redis Streams so a
+	// deployment can run without a RabbitMQ server
+	EventTransport string `env:"EVENT_TRANSPORT" envDefault:"rabbitmq"`
+
+	// Queue consumers run in cmd/worker, the API runs them too only with
+	// APP_RUN_WORKERS. WORKER_CONSUMERS limits a worker to some consumers.
+	AppRunWorkers   bool   `env:"APP_RUN_WORKERS" envDefault:"false"`
+	WorkerPort      int    `env:"WORKER_PORT" envDefault:"8081"`
+	WorkerConsumers string `env:"WORKER_CONSUMERS" envDefault:""`
+
+	// The API serves GET /metrics only on METRICS_PORT, away from the public
+	// port. 0 turns it off, the worker always serves it on WORKER_PORT.
+	MetricsPort int `env:"METRICS_PORT" envDefault:"0"`
 
 	// AWS S3 Configuration (optional, uncomment if needed)
 	// AWSACCESSKEYID     string       `env:"AWS_ACCESS_KEY_ID" envDefault:""`
@@ -60,7 +115,9 @@ type SetupServerDto struct {
 	Db     *database.Database
 	Rds    redis.IRedis
 	Rb     *rabbitmq.ConnectionManager
+	Rs     *redisstream.Broker
 	S3     *s3aws.Is3
 	Ai     *ai.AiClient
 	Mt     *midtransPkg.MidtransClient
+	Wa     *whatsappPkg.Client
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FlowEvent is one WhatsApp Flow endpoint request/response, or the completion
+// reported by the webhook. Data and Response hold PII-masked form data.
+type FlowEvent struct {
+	ID         string    `json:"id" gorm:"primaryKey;size:36"`
+	Flow       string    `json:"flow" gorm:"type:varchar(100);not null;index:idx_flow_events_flow_created"`
+	FlowToken  string    `json:"flow_token" gorm:"type:varchar(255);index"`
+	Action     string    `json:"action" gorm:"type:varchar(50);not null"`
+	Screen     string    `json:"screen" gorm:"type:varchar(100)"`
+	NextScreen string    `json:"next_screen" gorm:"type:varchar(100)"`
+	Data       JSONB     `json:"data"`
+	Response   JSONB     `json:"response"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `json:"error" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime;index:idx_flow_events_flow_created"`
+}
+
+func (FlowEvent) TableName() string {
+	return "flow_events"
+}
+
+// BeforeCreate sets the id in Go, MySQL has no UUID default
+func (e *FlowEvent) BeforeCreate(*gorm.DB) error {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	return nil
+}
@@ -4,12 +4,25 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	database "go-boilerplate/internal/pkg/db"
 	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
-// JSONB is a custom type for GORM to handle JSONB columns
+// JSONB is a custom type for GORM to handle JSON columns, jsonb on
+// PostgreSQL and json on MySQL
 type JSONB json.RawMessage
 
+func (JSONB) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "mysql" {
+		return "json"
+	}
+	return "jsonb"
+}
+
 func (j JSONB) Value() (driver.Value, error) {
 	if len(j) == 0 {
 		return nil, nil
@@ -49,15 +62,15 @@ func (j *JSONB) UnmarshalJSON(data []byte) error {
 }
 
 type Transaction struct {
-	ID            string     `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ID            string     `json:"id" gorm:"primaryKey;size:36"`
 	OrderID       string     `json:"order_id" gorm:"type:varchar(100);uniqueIndex;not null"`
 	CustomerName  string     `json:"customer_name" gorm:"type:varchar(255)"`
 	CustomerPhone string     `json:"customer_phone" gorm:"type:varchar(50)"`
 	CustomerEmail string     `json:"customer_email" gorm:"type:varchar(255)"`
 	GrossAmount   int64      `json:"gross_amount" gorm:"not null"`
 	PaymentType   string     `json:"payment_type" gorm:"type:varchar(50)"`
-	Items         JSONB      `json:"items" gorm:"type:jsonb;not null"`
-	Metadata      JSONB      `json:"metadata" gorm:"type:jsonb"`
+	Items         JSONB      `json:"items" gorm:"not null"`
+	Metadata      JSONB      `json:"metadata"`
 	SnapToken     string     `json:"snap_token" gorm:"type:varchar(255)"`
 	SnapURL       string     `json:"snap_url" gorm:"type:text"`
 	TransactionID string     `json:"transaction_id" gorm:"type:varchar(255)"`
@@ -73,3 +86,23 @@ type Transaction struct {
 func (Transaction) TableName() string {
 	return "transactions"
 }
+
+// FilterFields whitelists the filters of transaction lists
+func (Transaction) FilterFields() database.FilterFields {
+	return database.FilterFields{
+		"order_id":     {database.EQ, database.IN, database.LIKE},
+		"status":       {database.EQ, database.NE, database.IN, database.NIN},
+		"payment_type": {database.EQ, database.IN, database.NIN},
+		"gross_amount": database.RangeOperators,
+		"created_at":   database.RangeOperators,
+		"paid_at":      append([]database.FilterOperatorEnum{database.NULL}, database.RangeOperators...),
+	}
+}
+
+// BeforeCreate sets the id in Go, MySQL has no UUID default
+func (t *Transaction) BeforeCreate(*gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.NewString()
+	}
+	return nil
+}
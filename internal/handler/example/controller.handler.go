@@ -11,7 +11,7 @@ import (
 
 type Handler struct {
 	ctx           context.Context
-	rabbitmq      *rabbitmq.ConnectionManager
+	rabbitmq      rabbitmq.Broker
 	xampleService xampleService.IService
 }
 
@@ -19,7 +19,7 @@ type IHandler interface {
 	NewRoutes(e *gin.RouterGroup)
 }
 
-func NewHandler(ctx context.Context, rabbitmq *rabbitmq.ConnectionManager, xampleService xampleService.IService) IHandler {
+func NewHandler(ctx context.Context, rabbitmq rabbitmq.Broker, xampleService xampleService.IService) IHandler {
 	return &Handler{
 		ctx:           ctx,
 		rabbitmq:      rabbitmq,
@@ -0,0 +1,34 @@
+package payment
+
+import (
+	"time"
+
+	"go-boilerplate/internal/pkg/rabbitmq"
+	paymentService "go-boilerplate/internal/service/payment"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RegisterConsumers declares the payment queues consumed by the worker
+func RegisterConsumers(registry *rabbitmq.Registry, service paymentService.IService) error {
+	router := rabbitmq.NewRouter().
+		Use(
+			rabbitmq.LoggingMiddleware(),
+			rabbitmq.RecoveryMiddleware(),
+			rabbitmq.TracingMiddleware(),
+			rabbitmq.IdempotencyMiddleware(rabbitmq.NewMemoryIdempotencyStore(), 24*time.Hour),
+		).
+		Handle(paymentService.PaidPattern, rabbitmq.Handle(func(event paymentService.PaidEvent, msg *amqp.Delivery) (interface{}, error) {
+			return nil, service.NotifyPaid(event.OrderID)
+		}))
+
+	opts := rabbitmq.DefaultSubscribeOptions(paymentService.PaidQueue, false)
+	opts.QueueOpts = paymentService.PaidQueueConfig()
+	opts.RetryStrategy = rabbitmq.ExponentialRetry
+
+	return registry.Register(rabbitmq.Consumer{
+		Name:    "payment-paid",
+		Options: opts,
+		Handler: router.Handler(),
+	})
+}
@@ -2,15 +2,19 @@ package payment
 
 import (
 	"context"
-	"crypto/rsa"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/common/models"
 	types "go-boilerplate/internal/common/type"
 	"go-boilerplate/internal/pkg/helper"
 	"go-boilerplate/internal/pkg/logger"
 	midtransPkg "go-boilerplate/internal/pkg/midtrans"
+	"go-boilerplate/internal/pkg/redis"
 	"go-boilerplate/internal/pkg/waflow"
 	paymentService "go-boilerplate/internal/service/payment"
+	waflowService "go-boilerplate/internal/service/waflow"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,7 +24,9 @@ type Handler struct {
 	paymentService paymentService.IService
 	midtrans       *midtransPkg.MidtransClient
 	baseURL        string
-	waPrivateKey   *rsa.PrivateKey
+	waflowService  waflowService.IService
+	waKeys         *waflow.KeyRing
+	redis          redis.IRedis
 }
 
 type IHandler interface {
@@ -28,13 +34,15 @@ type IHandler interface {
 	NewPageRoutes(e *gin.Engine)
 }
 
-func NewHandler(ctx context.Context, paymentService paymentService.IService, midtrans *midtransPkg.MidtransClient, baseURL string, waPrivateKey *rsa.PrivateKey) IHandler {
+func NewHandler(ctx context.Context, redis redis.IRedis, paymentService paymentService.IService, waflowService waflowService.IService, midtrans *midtransPkg.MidtransClient, baseURL string, waKeys *waflow.KeyRing) IHandler {
 	return &Handler{
 		ctx:            ctx,
 		paymentService: paymentService,
+		waflowService:  waflowService,
 		midtrans:       midtrans,
 		baseURL:        baseURL,
-		waPrivateKey:   waPrivateKey,
+		waKeys:         waKeys,
+		redis:          redis,
 	}
 }
 
@@ -150,10 +158,11 @@ func (h *Handler) MidtransCallback(c *gin.Context) {
 // @Param        request  body      waflow.EncryptedRequest  true  "Encrypted WhatsApp Flow request"
 // @Success      200      {string}  string  "Base64 encrypted response"
 // @Failure      400      {object}  map[string]string
+// @Failure      421      {object}  map[string]string  "Encrypted with an unknown public key"
 // @Failure      500      {object}  map[string]string
 // @Router       /v1/payments/wa-flow-endpoint [post]
 func (h *Handler) WAFlowEndpoint(c *gin.Context) {
-	if h.waPrivateKey == nil {
+	if h.waKeys == nil {
 		logger.Error.Printf("WhatsApp Flow private key not configured")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "endpoint not configured"})
 		return
@@ -167,14 +176,35 @@ func (h *Handler) WAFlowEndpoint(c *gin.Context) {
 	}
 
 	// Decrypt the request
-	decrypted, aesKey, iv, err := waflow.DecryptRequest(h.waPrivateKey, encReq)
+	started := time.Now()
+	decrypted, aesKey, iv, err := h.waKeys.DecryptRequest(encReq)
 	if err != nil {
 		logger.Error.Printf("Failed to decrypt WA Flow request: %v", err)
+		h.waflowService.RecordEvent(&models.FlowEvent{
+			Flow:      WAFlowName,
+			Action:    "decrypt",
+			LatencyMs: time.Since(started).Milliseconds(),
+			Error:     err.Error(),
+		})
+		// 421 makes the WhatsApp client re-download the public key and retry
+		if errors.Is(err, waflow.ErrKeyMismatch) {
+			c.JSON(http.StatusMisdirectedRequest, gin.H{"error": "decryption failed"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "decryption failed"})
 		return
 	}
 
-	logger.Info.Printf("WA Flow action=%s screen=%s data=%v", decrypted.Action, decrypted.Screen, decrypted.Data)
+	maskedData := waflow.MaskData(decrypted.Data)
+	logger.Info.Printf("WA Flow action=%s screen=%s data=%v", decrypted.Action, decrypted.Screen, maskedData)
+
+	event := &models.FlowEvent{
+		Flow:      WAFlowName,
+		FlowToken: decrypted.FlowToken,
+		Action:    decrypted.Action,
+		Screen:    decrypted.Screen,
+		Data:      toJSONB(maskedData),
+	}
 
 	// Process action
 	var response waflow.FlowResponse
@@ -190,7 +220,7 @@ func (h *Handler) WAFlowEndpoint(c *gin.Context) {
 	case "INIT":
 		// Return ORDER_FORM screen with items data from flow message
 		response = waflow.FlowResponse{
-			Screen: "ORDER_FORM",
+			Screen: WAFlowScreenOrderForm,
 			Data:   decrypted.Data,
 		}
 
@@ -205,6 +235,7 @@ func (h *Handler) WAFlowEndpoint(c *gin.Context) {
 
 	default:
 		logger.Error.Printf("Unsupported WA Flow action: %s", decrypted.Action)
+		event.Error = "unsupported action"
 		response = waflow.FlowResponse{
 			Data: map[string]interface{}{
 				"error": "unsupported action",
@@ -213,52 +244,49 @@ func (h *Handler) WAFlowEndpoint(c *gin.Context) {
 	}
 
 	// Log response before encrypting
-	respJSON, _ := json.Marshal(response)
-	logger.Info.Printf("WA Flow response: %s", string(respJSON))
+	maskedResponse := waflow.MaskData(response.Data)
+	logger.Info.Printf("WA Flow response: screen=%s data=%v", response.Screen, maskedResponse)
+
+	event.NextScreen = response.Screen
+	event.Response = toJSONB(maskedResponse)
 
 	// Encrypt the response
 	encrypted, err := waflow.EncryptResponse(aesKey, iv, response)
 	if err != nil {
 		logger.Error.Printf("Failed to encrypt WA Flow response: %v", err)
+		event.Error = fmt.Sprintf("failed to encrypt response: %v", err)
+		event.LatencyMs = time.Since(started).Milliseconds()
+		h.waflowService.RecordEvent(event)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "encryption failed"})
 		return
 	}
 
+	event.LatencyMs = time.Since(started).Milliseconds()
+	h.waflowService.RecordEvent(event)
+
 	c.String(http.StatusOK, encrypted)
 }
 
 // handleDataExchange processes data_exchange action based on screen
 func (h *Handler) handleDataExchange(req *waflow.DecryptedRequest) waflow.FlowResponse {
-	getData := func(key string) string {
-		if v, ok := req.Data[key]; ok {
-			if s, ok := v.(string); ok {
-				return s
-			}
-		}
-		return ""
+	order, err := helper.JSONToStruct[WAFlowOrderData](req.Data)
+	if err != nil {
+		logger.Error.Printf("Failed to decode WA Flow order data: %v", err)
+		order = &WAFlowOrderData{}
 	}
 
-	shippingDetails := "Name : " + getData("nama_penerima") +
-		"\nPhone : " + getData("nomor_handphone") +
-		"\nAddress : " + getData("alamat_lengkap") +
-		"\n" + getData("kota_kecamatan") + ", " + getData("provinsi") +
-		"\n" + getData("kode_pos")
+	data, err := helper.JSONToStruct[map[string]interface{}](WAFlowSummaryData{
+		WAFlowOrderData: *order,
+		ShippingDetails: order.FormatShippingDetails(),
+	})
+	if err != nil {
+		logger.Error.Printf("Failed to encode WA Flow summary data: %v", err)
+		data = &map[string]interface{}{}
+	}
 
 	return waflow.FlowResponse{
-		Screen: "SUMMARY_ORDER",
-		Data: map[string]interface{}{
-			"nama_penerima":    getData("nama_penerima"),
-			"nomor_handphone":  getData("nomor_handphone"),
-			"alamat_lengkap":   getData("alamat_lengkap"),
-			"provinsi":         getData("provinsi"),
-			"kota_kecamatan":   getData("kota_kecamatan"),
-			"kode_pos":         getData("kode_pos"),
-			"shipping_details": shippingDetails,
-			"items_text":       getData("items_text"),
-			"total_barang":     getData("total_barang"),
-			"total_pengiriman": getData("total_pengiriman"),
-			"total_biaya":      getData("total_biaya"),
-		},
+		Screen: WAFlowScreenSummaryOrder,
+		Data:   *data,
 	}
 }
 
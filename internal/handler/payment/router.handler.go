@@ -1,20 +1,50 @@
 package payment
 
 import (
+	"go-boilerplate/internal/pkg/middleware"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	// createLimits bounds the Midtrans transactions one client, or one
+	// customer phone across clients, can open
+	createLimits = []*middleware.RateLimitPolicy{
+		{Name: "payment-create", Limit: 10, Window: time.Minute, Key: middleware.KeyByIP()},
+		{Name: "payment-create-phone", Limit: 5, Window: 10 * time.Minute, Key: middleware.KeyByJSONField("customer.phone")},
+	}
+	// statusLimit lets the status page poll steadily, every check asks Midtrans
+	statusLimit = &middleware.RateLimitPolicy{Name: "payment-status", Limit: 30, Window: time.Minute, Algorithm: middleware.TokenBucket, Key: middleware.KeyByIP()}
+	// pageLimit covers the public payment and status pages
+	pageLimit = &middleware.RateLimitPolicy{Name: "payment-page", Limit: 60, Window: time.Minute, Algorithm: middleware.TokenBucket, Key: middleware.KeyByIP()}
+)
+
 func (h *Handler) NewRoutes(e *gin.RouterGroup) {
 	payments := e.Group("/v1/payments")
 
-	payments.POST("/create", h.CreatePayment)
-	payments.GET("/status/:order_id", h.CheckStatus)
-	payments.POST("/process", h.HandlePaymentResult)
+	payments.POST("/create", h.limited(h.CreatePayment, createLimits...)...)
+	payments.GET("/status/:order_id", h.limited(h.CheckStatus, statusLimit)...)
+	payments.POST("/process", h.limited(h.HandlePaymentResult, statusLimit)...)
 	payments.POST("/callback", h.MidtransCallback)
 	payments.POST("/wa-flow-endpoint", h.WAFlowEndpoint)
 }
 
 func (h *Handler) NewPageRoutes(e *gin.Engine) {
-	e.GET("/pay/:token", h.PaymentPage)
-	e.GET("/status/:order_id", h.StatusPage)
+	e.GET("/pay/:token", h.limited(h.PaymentPage, pageLimit)...)
+	e.GET("/status/:order_id", h.limited(h.StatusPage, pageLimit)...)
+}
+
+// limited puts the policies in front of handler, routes stay open when there
+// is no Redis
+func (h *Handler) limited(handler gin.HandlerFunc, policies ...*middleware.RateLimitPolicy) []gin.HandlerFunc {
+	if h.redis == nil {
+		return []gin.HandlerFunc{handler}
+	}
+
+	handlers := make([]gin.HandlerFunc, 0, len(policies)+1)
+	for _, policy := range policies {
+		handlers = append(handlers, middleware.RateLimitMiddleware(h.redis, policy))
+	}
+	return append(handlers, handler)
 }
@@ -1,5 +1,27 @@
 package payment
 
+import (
+	"encoding/json"
+	"go-boilerplate/internal/common/models"
+)
+
+// WAFlowName identifies the order flow in flow_events
+const WAFlowName = "order"
+
+// WhatsApp Flow screen ids, shared by the endpoint and the flow definition
+const (
+	WAFlowScreenOrderForm    = "ORDER_FORM"
+	WAFlowScreenSummaryOrder = "SUMMARY_ORDER"
+)
+
+// WAFlowInitData is the initial data sent with the flow message and shown on ORDER_FORM
+type WAFlowInitData struct {
+	ItemsText       string `json:"items_text"`
+	TotalBarang     string `json:"total_barang"`
+	TotalPengiriman string `json:"total_pengiriman"`
+	TotalBiaya      string `json:"total_biaya"`
+}
+
 // WAFlowOrderData contains order form fields exchanged with WhatsApp Flow
 type WAFlowOrderData struct {
 	NamaPenerima    string `json:"nama_penerima"`
@@ -13,3 +35,30 @@ type WAFlowOrderData struct {
 	TotalPengiriman string `json:"total_pengiriman"`
 	TotalBiaya      string `json:"total_biaya"`
 }
+
+// WAFlowSummaryData is the data returned for the SUMMARY_ORDER screen
+type WAFlowSummaryData struct {
+	WAFlowOrderData
+	ShippingDetails string `json:"shipping_details"`
+}
+
+// FormatShippingDetails formats the recipient block shown on the summary screen
+func (d WAFlowOrderData) FormatShippingDetails() string {
+	return "Name : " + d.NamaPenerima +
+		"\nPhone : " + d.NomorHandphone +
+		"\nAddress : " + d.AlamatLengkap +
+		"\n" + d.KotaKecamatan + ", " + d.Provinsi +
+		"\n" + d.KodePos
+}
+
+// toJSONB encodes masked flow data for a flow_events column
+func toJSONB(data map[string]interface{}) models.JSONB {
+	if data == nil {
+		return nil
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	return models.JSONB(body)
+}
@@ -0,0 +1,127 @@
+package payment
+
+import (
+	"errors"
+
+	"go-boilerplate/internal/pkg/waflow/schema"
+)
+
+// WAFlowDefinition builds the order flow served by WAFlowEndpoint.
+// flow.json is generated from it with `go run ./cmd/waflow generate`.
+func WAFlowDefinition() *schema.Flow {
+	itemsText := "1x milkita permen susu mix\n1x Super Zuper Permen Asem"
+	examples := WAFlowSummaryData{
+		WAFlowOrderData: WAFlowOrderData{
+			NamaPenerima:    "Muh Silmi",
+			NomorHandphone:  "+62812-9992-9993",
+			AlamatLengkap:   "Jl rs fatmawati no 77-81",
+			Provinsi:        "DKI Jakarta",
+			KotaKecamatan:   "Cipete, Jakarta Selatan",
+			KodePos:         "125127",
+			ItemsText:       itemsText,
+			TotalBarang:     "Rp 28.800",
+			TotalPengiriman: "Rp 10.000",
+			TotalBiaya:      "Rp 38.800",
+		},
+	}
+	examples.ShippingDetails = examples.FormatShippingDetails()
+
+	orderForm := schema.Screen{
+		ID:    WAFlowScreenOrderForm,
+		Title: "Formulir Pemesanan",
+		Data: schema.Data{
+			schema.String("items_text", examples.ItemsText),
+			schema.String("total_barang", examples.TotalBarang),
+			schema.String("total_pengiriman", examples.TotalPengiriman),
+			schema.String("total_biaya", examples.TotalBiaya),
+		},
+		Layout: schema.Layout{
+			Type: schema.SingleColumnLayout,
+			Children: []schema.Component{
+				schema.TextInput{Name: "nama_penerima", Label: "Nama Penerima", InputType: schema.InputText, Required: true},
+				schema.TextInput{Name: "nomor_handphone", Label: "Nomor (+62)", InputType: schema.InputPhone, Required: true},
+				schema.TextInput{Name: "alamat_lengkap", Label: "Alamat Lengkap", InputType: schema.InputText, Required: true},
+				schema.TextInput{Name: "provinsi", Label: "Provinsi", InputType: schema.InputText, Required: true},
+				schema.TextInput{Name: "kota_kecamatan", Label: "Kota / Kecamatan", InputType: schema.InputText, Required: true},
+				schema.TextInput{Name: "kode_pos", Label: "Kode Pos", InputType: schema.InputText, Required: true},
+				schema.Footer{
+					Label: "Next",
+					OnClickAction: schema.DataExchange(
+						schema.Field("nama_penerima", schema.FormRef("nama_penerima")),
+						schema.Field("nomor_handphone", schema.FormRef("nomor_handphone")),
+						schema.Field("alamat_lengkap", schema.FormRef("alamat_lengkap")),
+						schema.Field("provinsi", schema.FormRef("provinsi")),
+						schema.Field("kota_kecamatan", schema.FormRef("kota_kecamatan")),
+						schema.Field("kode_pos", schema.FormRef("kode_pos")),
+						schema.Field("items_text", schema.DataRef("items_text")),
+						schema.Field("total_barang", schema.DataRef("total_barang")),
+						schema.Field("total_pengiriman", schema.DataRef("total_pengiriman")),
+						schema.Field("total_biaya", schema.DataRef("total_biaya")),
+					),
+				},
+			},
+		},
+	}
+
+	summaryOrder := schema.Screen{
+		ID:       WAFlowScreenSummaryOrder,
+		Title:    "Summary Order",
+		Terminal: true,
+		Success:  true,
+		Data: schema.Data{
+			schema.String("nama_penerima", examples.NamaPenerima),
+			schema.String("nomor_handphone", examples.NomorHandphone),
+			schema.String("alamat_lengkap", examples.AlamatLengkap),
+			schema.String("provinsi", examples.Provinsi),
+			schema.String("kota_kecamatan", examples.KotaKecamatan),
+			schema.String("kode_pos", examples.KodePos),
+			schema.String("shipping_details", examples.ShippingDetails),
+			schema.String("items_text", examples.ItemsText),
+			schema.String("total_barang", examples.TotalBarang),
+			schema.String("total_pengiriman", examples.TotalPengiriman),
+			schema.String("total_biaya", examples.TotalBiaya),
+		},
+		Layout: schema.Layout{
+			Type: schema.SingleColumnLayout,
+			Children: []schema.Component{
+				schema.TextHeading{Text: "Shipping Details"},
+				schema.TextBody{Text: schema.DataRef("shipping_details")},
+				schema.TextHeading{Text: "Items"},
+				schema.TextBody{Text: schema.DataRef("items_text")},
+				schema.TextSubheading{Text: "Total Barang"},
+				schema.TextBody{Text: schema.DataRef("total_barang")},
+				schema.TextSubheading{Text: "Total Pengiriman"},
+				schema.TextBody{Text: schema.DataRef("total_pengiriman")},
+				schema.TextSubheading{Text: "Total Biaya"},
+				schema.TextBody{Text: schema.DataRef("total_biaya")},
+				schema.Footer{
+					Label: "Submit",
+					OnClickAction: schema.Complete(
+						schema.Field("nama_penerima", schema.DataRef("nama_penerima")),
+						schema.Field("nomor_handphone", schema.DataRef("nomor_handphone")),
+						schema.Field("alamat_lengkap", schema.DataRef("alamat_lengkap")),
+						schema.Field("provinsi", schema.DataRef("provinsi")),
+						schema.Field("kota_kecamatan", schema.DataRef("kota_kecamatan")),
+						schema.Field("kode_pos", schema.DataRef("kode_pos")),
+						schema.Field("total_biaya", schema.DataRef("total_biaya")),
+					),
+				},
+			},
+		},
+	}
+
+	return schema.NewFlow().
+		AddScreen(orderForm, WAFlowScreenSummaryOrder).
+		AddScreen(summaryOrder)
+}
+
+// ValidateWAFlow validates a flow and checks it against the structs the
+// endpoint exchanges with it, so field renames on either side are caught
+func ValidateWAFlow(flow *schema.Flow) error {
+	return errors.Join(
+		flow.Validate(),
+		flow.CheckData(WAFlowScreenOrderForm, WAFlowInitData{}),
+		flow.CheckPayload(WAFlowScreenOrderForm, schema.ActionDataExchange, WAFlowOrderData{}),
+		flow.CheckData(WAFlowScreenSummaryOrder, WAFlowSummaryData{}),
+	)
+}
@@ -0,0 +1,55 @@
+package waflow
+
+import (
+	"context"
+	types "go-boilerplate/internal/common/type"
+	"go-boilerplate/internal/pkg/helper"
+	waflowService "go-boilerplate/internal/service/waflow"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	ctx           context.Context
+	waflowService waflowService.IService
+}
+
+type IHandler interface {
+	NewRoutes(e *gin.RouterGroup)
+}
+
+func NewHandler(ctx context.Context, waflowService waflowService.IService) IHandler {
+	return &Handler{
+		ctx:           ctx,
+		waflowService: waflowService,
+	}
+}
+
+// Analytics godoc
+// @Summary      WhatsApp Flow funnel analytics
+// @Description  Starts, drop-off per screen, completion rate and median time per screen, computed from flow_events
+// @Tags         WhatsApp Flow
+// @Produce      json
+// @Param        flow  query     string  false  "Flow name, all flows when empty"
+// @Param        from  query     string  false  "RFC3339 or YYYY-MM-DD, defaults to 7 days before to"
+// @Param        to    query     string  false  "RFC3339 or YYYY-MM-DD (inclusive), defaults to now"
+// @Success      200   {object}  types.ResponseAPI{data=waflowService.AnalyticsResponse}
+// @Failure      400   {object}  types.ResponseAPI
+// @Failure      500   {object}  types.ResponseAPI
+// @Router       /v1/waflow/analytics [get]
+func (h *Handler) Analytics(c *gin.Context) {
+	send := c.MustGet("send").(func(r *types.Response))
+
+	var req waflowService.AnalyticsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		send(helper.ParseResponse(&types.Response{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid query parameters",
+			Error:   err,
+		}))
+		return
+	}
+
+	send(h.waflowService.Analytics(&req))
+}
@@ -0,0 +1,11 @@
+package waflow
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) NewRoutes(e *gin.RouterGroup) {
+	waflow := e.Group("/v1/waflow")
+
+	waflow.GET("/analytics", h.Analytics)
+}
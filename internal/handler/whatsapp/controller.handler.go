@@ -0,0 +1,148 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"go-boilerplate/internal/common/models"
+	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/waflow"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
+	waflowService "go-boilerplate/internal/service/waflow"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBody caps the webhook body read before the signature is checked
+const maxWebhookBody = 1 << 20
+
+type Handler struct {
+	ctx           context.Context
+	whatsapp      *whatsappPkg.Client
+	waflowService waflowService.IService
+}
+
+type IHandler interface {
+	NewRoutes(e *gin.RouterGroup)
+}
+
+func NewHandler(ctx context.Context, whatsapp *whatsappPkg.Client, waflowService waflowService.IService) IHandler {
+	return &Handler{
+		ctx:           ctx,
+		whatsapp:      whatsapp,
+		waflowService: waflowService,
+	}
+}
+
+// VerifyWebhook godoc
+// @Summary      WhatsApp webhook verification
+// @Description  Answers the subscription challenge sent by Meta when the webhook is configured
+// @Tags         WhatsApp
+// @Produce      plain
+// @Param        hub.mode          query     string  true  "Always subscribe"
+// @Param        hub.verify_token  query     string  true  "WA_WEBHOOK_VERIFY_TOKEN"
+// @Param        hub.challenge     query     string  true  "Echoed back on success"
+// @Success      200  {string}  string  "The challenge"
+// @Failure      403  {string}  string
+// @Router       /v1/whatsapp/webhook [get]
+func (h *Handler) VerifyWebhook(c *gin.Context) {
+	if !h.whatsapp.VerifyChallenge(c.Query("hub.mode"), c.Query("hub.verify_token")) {
+		logger.Warning.Printf("WhatsApp webhook verification rejected (mode=%s)", c.Query("hub.mode"))
+		c.String(http.StatusForbidden, "forbidden")
+		return
+	}
+
+	c.String(http.StatusOK, c.Query("hub.challenge"))
+}
+
+// ReceiveWebhook godoc
+// @Summary      WhatsApp webhook notifications
+// @Description  Receives inbound messages and delivery statuses, signed with X-Hub-Signature-256
+// @Tags         WhatsApp
+// @Accept       json
+// @Produce      json
+// @Param        X-Hub-Signature-256  header    string                       true  "sha256=<HMAC of the body with the app secret>"
+// @Param        request              body      whatsappPkg.WebhookPayload  true  "Webhook payload"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /v1/whatsapp/webhook [post]
+func (h *Handler) ReceiveWebhook(c *gin.Context) {
+	if !h.whatsapp.WebhookConfigured() {
+		logger.Error.Printf("WhatsApp webhook app secret not configured")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "endpoint not configured"})
+		return
+	}
+
+	// The signature covers the raw bytes, so read before decoding
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	if !h.whatsapp.VerifySignature(body, c.GetHeader(whatsappPkg.SignatureHeader)) {
+		logger.Warning.Printf("WhatsApp webhook rejected: invalid %s", whatsappPkg.SignatureHeader)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+		return
+	}
+
+	payload, err := whatsappPkg.ParseWebhook(body)
+	if err != nil {
+		logger.Error.Printf("Failed to parse WhatsApp webhook: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			if change.Field != "messages" {
+				continue
+			}
+			for _, msg := range change.Value.Messages {
+				h.handleMessage(msg)
+			}
+			for _, status := range change.Value.Statuses {
+				h.handleStatus(status)
+			}
+		}
+	}
+
+	// Meta retries anything but 200, acknowledge once the payload is verified
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (h *Handler) handleMessage(msg whatsappPkg.InboundMessage) {
+	switch {
+	case msg.Interactive != nil && msg.Interactive.NFMReply != nil:
+		response, err := msg.Interactive.NFMReply.FlowResponse()
+		if err != nil {
+			logger.Error.Printf("WhatsApp flow reply %s from %s: %v", msg.ID, waflow.MaskString(msg.From), err)
+			return
+		}
+		flowToken, _ := response["flow_token"].(string)
+		logger.Info.Printf("WhatsApp flow completed by %s (flow_token=%s)", waflow.MaskString(msg.From), flowToken)
+
+		// The endpoint never sees the complete action, record it for the funnel
+		delete(response, "flow_token")
+		data, _ := json.Marshal(waflow.MaskData(response))
+		h.waflowService.RecordCompletion(flowToken, models.JSONB(data))
+
+	case msg.Interactive != nil:
+		logger.Info.Printf("WhatsApp %s message %s from %s", msg.Interactive.Type, msg.ID, waflow.MaskString(msg.From))
+
+	default:
+		logger.Info.Printf("WhatsApp %s message %s from %s", msg.Type, msg.ID, waflow.MaskString(msg.From))
+	}
+}
+
+func (h *Handler) handleStatus(status whatsappPkg.MessageStatus) {
+	if status.Status == "failed" {
+		logger.Error.Printf("WhatsApp message %s to %s failed: %+v", status.ID, waflow.MaskString(status.RecipientID), status.Errors)
+		return
+	}
+	logger.Debug.Printf("WhatsApp message %s to %s %s", status.ID, waflow.MaskString(status.RecipientID), status.Status)
+}
@@ -0,0 +1,12 @@
+package whatsapp
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) NewRoutes(e *gin.RouterGroup) {
+	webhook := e.Group("/v1/whatsapp")
+
+	webhook.GET("/webhook", h.VerifyWebhook)
+	webhook.POST("/webhook", h.ReceiveWebhook)
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/redis"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound is returned by a loader when the value does not exist, it is
+// cached for NegativeTTL so lookups of missing keys skip the loader too
+var ErrNotFound = errors.New("cache: not found")
+
+type Options struct {
+	// Prefix is prepended to every key
+	Prefix string
+	// Jitter shortens each TTL by up to this fraction, keys written together
+	// then expire apart
+	Jitter float64
+	// NegativeTTL is how long ErrNotFound is cached, never when zero
+	NegativeTTL time.Duration
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Prefix:      "cache:",
+		Jitter:      0.1,
+		NegativeTTL: 30 * time.Second,
+	}
+}
+
+// Cache is a cache-aside layer over Redis. Concurrent misses of a key in one
+// instance share a single load. Without Redis every lookup loads, still
+// deduplicated.
+type Cache struct {
+	redis redis.IRedis
+	opts  *Options
+	group singleflight.Group
+
+	// loading holds the keys with a load running. A load overlapping an
+	// Invalidate of its key may have read the old value and is not stored.
+	mu      sync.Mutex
+	loading map[string]*loadState
+}
+
+// loadState counts the loads of a key, generation goes up on each Invalidate
+type loadState struct {
+	generation uint64
+	loads      int
+}
+
+// entry is what is stored, Missing marks a cached ErrNotFound
+type entry[T any] struct {
+	Value   T    `json:"value"`
+	Missing bool `json:"missing,omitempty"`
+}
+
+func New(r redis.IRedis, opts *Options) *Cache {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	return &Cache{redis: r, opts: opts, loading: make(map[string]*loadState)}
+}
+
+// GetOrLoad returns the cached value of key, or calls loader and caches its
+// result for ttl. Loader errors other than ErrNotFound are not cached. The
+// loader runs without the cancellation of ctx since other callers may wait
+// for it, a caller whose ctx ends stops waiting.
+func GetOrLoad[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	key = c.opts.Prefix + key
+
+	if cached, ok := get[T](ctx, c, key); ok {
+		if cached.Missing {
+			return zero, ErrNotFound
+		}
+		return cached.Value, nil
+	}
+
+	result := c.group.DoChan(key, func() (interface{}, error) {
+		loadCtx := context.WithoutCancel(ctx)
+		generation := c.startLoad(key)
+		value, err := loader(loadCtx)
+		if !c.endLoad(key, generation) {
+			return value, err
+		}
+		switch {
+		case errors.Is(err, ErrNotFound):
+			if c.opts.NegativeTTL > 0 {
+				c.set(loadCtx, key, entry[T]{Missing: true}, c.opts.NegativeTTL)
+			}
+		case err == nil:
+			c.set(loadCtx, key, entry[T]{Value: value}, c.jitter(ttl))
+		}
+		return value, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		value, _ := res.Val.(T)
+		return value, nil
+	}
+}
+
+// Invalidate removes keys after a write, the next lookup loads them again
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.opts.Prefix + key
+		c.invalidateLoad(prefixed[i])
+		// a load already running must not answer later lookups
+		c.group.Forget(prefixed[i])
+	}
+	if c.redis == nil {
+		return nil
+	}
+
+	if err := c.redis.DelWithContext(ctx, prefixed...); err != nil {
+		return fmt.Errorf("failed to invalidate cache: %w", err)
+	}
+	return nil
+}
+
+// startLoad registers a load of key and returns the generation it reads
+func (c *Cache) startLoad(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.loading[key]
+	if !ok {
+		state = &loadState{}
+		c.loading[key] = state
+	}
+	state.loads++
+	return state.generation
+}
+
+// endLoad reports whether key was not invalidated since startLoad
+func (c *Cache) endLoad(key string, generation uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.loading[key]
+	current := state.generation == generation
+	if state.loads--; state.loads == 0 {
+		delete(c.loading, key)
+	}
+	return current
+}
+
+// invalidateLoad marks the loads of key running now as stale, a load
+// starting later reads the new value
+func (c *Cache) invalidateLoad(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.loading[key]; ok {
+		state.generation++
+	}
+}
+
+// get reads a cached entry, Redis errors count as a miss so an outage only
+// costs the loads
+func get[T any](ctx context.Context, c *Cache, key string) (entry[T], bool) {
+	var cached entry[T]
+	if c.redis == nil {
+		return cached, false
+	}
+
+	data, err := c.redis.GetWithContext(ctx, key)
+	if err != nil {
+		logger.Warning.Printf("Cache read of %s failed: %v", key, err)
+		return cached, false
+	}
+	if data == "" {
+		return cached, false
+	}
+
+	if err := json.Unmarshal([]byte(data), &cached); err != nil {
+		logger.Warning.Printf("Cache entry %s is invalid: %v", key, err)
+		return cached, false
+	}
+	return cached, true
+}
+
+func (c *Cache) set(ctx context.Context, key string, value any, ttl time.Duration) {
+	if c.redis == nil || ttl <= 0 {
+		return
+	}
+	if err := c.redis.SetWithContext(ctx, key, value, ttl); err != nil {
+		logger.Warning.Printf("Cache write of %s failed: %v", key, err)
+	}
+}
+
+func (c *Cache) jitter(ttl time.Duration) time.Duration {
+	if c.opts.Jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl - time.Duration(rand.Float64()*c.opts.Jitter*float64(ttl))
+}
@@ -13,16 +13,26 @@ import (
 )
 
 type Config struct {
-	Host      string
-	Port      int
-	User      string
-	Password  string
-	Database  string
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+	// SSLMode takes the PostgreSQL values, disable, require, verify-ca and
+	// verify-full, and is mapped to the tls parameter on MySQL
 	SSLMode   string
 	Driver    DriverEnum
 	Cache     bool
 	Rds       *redis.Client
 	CacheTime time.Duration
+
+	// Pool sizes, 20 open and 10 idle connections when zero
+	MaxOpenConns int
+	MaxIdleConns int
+
+	// MultiStatements lets one Exec run several statements on MySQL, for
+	// migrations. PostgreSQL always allows it without arguments.
+	MultiStatements bool
 }
 
 type Database struct {
@@ -66,13 +76,17 @@ func Setup(cfg *Config) (*Database, error) {
 
 	case MYSQL:
 		dsn := fmt.Sprintf(
-			"%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			"%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local&tls=%s",
 			cfg.User,
 			cfg.Password,
 			cfg.Host,
 			cfg.Port,
 			cfg.Database,
+			mysqlTLS(cfg.SSLMode),
 		)
+		if cfg.MultiStatements {
+			dsn += "&multiStatements=true"
+		}
 		db, err = gorm.Open(mysql.Open(dsn), gormConfig)
 	default:
 		return nil, fmt.Errorf("unsupported database driver: %s (supported: postgres, mysql)", cfg.Driver)
@@ -105,8 +119,15 @@ func Setup(cfg *Config) (*Database, error) {
 		return nil, fmt.Errorf("failed to get database instance: %w", err)
 	}
 
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(20)
+	maxOpen, maxIdle := cfg.MaxOpenConns, cfg.MaxIdleConns
+	if maxOpen <= 0 {
+		maxOpen = 20
+	}
+	if maxIdle <= 0 {
+		maxIdle = 10
+	}
+	sqlDB.SetMaxIdleConns(maxIdle)
+	sqlDB.SetMaxOpenConns(maxOpen)
 
 	return &Database{
 		db,
@@ -115,6 +136,19 @@ func Setup(cfg *Config) (*Database, error) {
 	}, nil
 }
 
+// mysqlTLS is the tls parameter of the MySQL driver for a PostgreSQL sslmode
+func mysqlTLS(sslMode string) string {
+	switch sslMode {
+	case "require":
+		return "skip-verify"
+	case "verify-ca", "verify-full":
+		return "true"
+	case "prefer", "allow":
+		return "preferred"
+	}
+	return "false"
+}
+
 func (db *Database) Migrate() error {
 	err := db.AutoMigrate(
 	/* Add your entities here
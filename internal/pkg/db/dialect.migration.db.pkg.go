@@ -0,0 +1,105 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// migrationDialect is the SQL of the migrator that differs between drivers
+type migrationDialect struct {
+	// transactional drivers roll DDL back with its transaction. MySQL commits
+	// DDL at once, so there every migration stays dirty until it succeeds.
+	transactional bool
+	createTable   string
+	// tryLock, lock and unlock take lockKey, tryLock answers at once
+	tryLock string
+	lock    string
+	unlock  string
+	lockKey any
+	// onConflict starts the update of an insert hitting an existing version,
+	// excluded names a column of the inserted row
+	onConflict string
+	excluded   func(column string) string
+	// placeholders turns the ? of a query into the placeholders of the driver
+	placeholders func(query string) string
+}
+
+func migrationDialectOf(cfg *Config) (*migrationDialect, error) {
+	switch cfg.Driver {
+	case POSTGRES:
+		return &migrationDialect{
+			transactional: true,
+			createTable: `CREATE TABLE IF NOT EXISTS ` + schemaMigrationsTable + ` (
+				version    BIGINT PRIMARY KEY,
+				name       VARCHAR(255) NOT NULL,
+				checksum   VARCHAR(64) NOT NULL,
+				dirty      BOOLEAN NOT NULL DEFAULT FALSE,
+				applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			tryLock:      `SELECT pg_try_advisory_lock(?)`,
+			lock:         `SELECT pg_advisory_lock(?)`,
+			unlock:       `SELECT pg_advisory_unlock(?)`,
+			lockKey:      migrationLockKey,
+			onConflict:   `ON CONFLICT (version) DO UPDATE SET`,
+			excluded:     func(column string) string { return "EXCLUDED." + column },
+			placeholders: numberedPlaceholders,
+		}, nil
+
+	case MYSQL:
+		return &migrationDialect{
+			createTable: `CREATE TABLE IF NOT EXISTS ` + schemaMigrationsTable + ` (
+				version    BIGINT PRIMARY KEY,
+				name       VARCHAR(255) NOT NULL,
+				checksum   VARCHAR(64) NOT NULL,
+				dirty      BOOLEAN NOT NULL DEFAULT FALSE,
+				applied_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3)
+			)`,
+			tryLock: `SELECT GET_LOCK(?, 0)`,
+			lock:    `SELECT GET_LOCK(?, -1)`,
+			unlock:  `SELECT RELEASE_LOCK(?)`,
+			// lock names are global to the server, not to a database
+			lockKey:      schemaMigrationsTable + ":" + cfg.Database,
+			onConflict:   `ON DUPLICATE KEY UPDATE`,
+			excluded:     func(column string) string { return "VALUES(" + column + ")" },
+			placeholders: func(query string) string { return query },
+		}, nil
+	}
+
+	return nil, fmt.Errorf("migrations are not supported on %s", cfg.Driver)
+}
+
+// upsert inserts a migration row, or sets columns of the existing one from it
+func (d *migrationDialect) upsert(columns ...string) string {
+	set := make([]string, len(columns))
+	for i, column := range columns {
+		set[i] = column + " = " + d.excluded(column)
+	}
+	return d.placeholders(`INSERT INTO ` + schemaMigrationsTable + ` (version, name, checksum, dirty) VALUES (?, ?, ?, ?) ` +
+		d.onConflict + ` ` + strings.Join(set, ", "))
+}
+
+// locked reads the answer of tryLock, a boolean on PostgreSQL and 1 on MySQL
+func locked(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v == 1
+	}
+	return false
+}
+
+func numberedPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -65,3 +65,36 @@ func (e DriverEnum) IsValid() bool {
 	}
 	return false
 }
+
+/*----------- FilterOperatorEnum -----------*/
+
+type FilterOperatorEnum string
+
+const (
+	EQ      FilterOperatorEnum = "eq"
+	NE      FilterOperatorEnum = "ne"
+	GT      FilterOperatorEnum = "gt"
+	GTE     FilterOperatorEnum = "gte"
+	LT      FilterOperatorEnum = "lt"
+	LTE     FilterOperatorEnum = "lte"
+	IN      FilterOperatorEnum = "in"
+	NIN     FilterOperatorEnum = "nin"
+	BETWEEN FilterOperatorEnum = "between"
+	LIKE    FilterOperatorEnum = "like"
+	NULL    FilterOperatorEnum = "null"
+)
+
+func (e FilterOperatorEnum) ToString() string {
+	if e.IsValid() {
+		return string(e)
+	}
+	return ""
+}
+
+func (e FilterOperatorEnum) IsValid() bool {
+	switch e {
+	case EQ, NE, GT, GTE, LT, LTE, IN, NIN, BETWEEN, LIKE, NULL:
+		return true
+	}
+	return false
+}
@@ -13,3 +13,11 @@ func IsNotFound(err error) bool {
 func IsDuplicateKey(err error) bool {
 	return errors.Is(err, gorm.ErrDuplicatedKey)
 }
+
+// ErrInvalidQuery is wrapped by list query errors the client caused, like a
+// filter that is not whitelisted or a value of the wrong type
+var ErrInvalidQuery = errors.New("invalid query")
+
+func IsInvalidQuery(err error) bool {
+	return errors.Is(err, ErrInvalidQuery)
+}
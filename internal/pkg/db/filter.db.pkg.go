@@ -0,0 +1,312 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// maxFilterValues bounds the values of one in, nin filter
+const maxFilterValues = 100
+
+// RangeOperators are the operators of ordered fields, amounts and times
+var RangeOperators = []FilterOperatorEnum{EQ, NE, GT, GTE, LT, LTE, BETWEEN}
+
+// Filter is one filter[field][operator]=value of a query string. Values holds
+// every value given for it, in, nin and between also split them on commas.
+type Filter struct {
+	Field    string
+	Operator FilterOperatorEnum
+	Values   []string
+}
+
+// FilterFields whitelists the fields of a model a list can be filtered on,
+// by column name, and the operators allowed on each
+type FilterFields map[string][]FilterOperatorEnum
+
+// Filterable is implemented by models whose lists accept filters
+//
+// Example:
+//
+//	func (Transaction) FilterFields() database.FilterFields {
+//		return database.FilterFields{
+//			"status":       {database.EQ, database.IN, database.NIN},
+//			"gross_amount": database.RangeOperators,
+//		}
+//	}
+type Filterable interface {
+	FilterFields() FilterFields
+}
+
+// ParseFilters reads the filter parameters of a query string:
+//
+//	filter[status][in]=settlement,capture
+//	filter[gross_amount][gte]=10000
+//	filter[created_at][between]=2025-01-01,2025-02-01
+//	filter[order_id]=ORDER-1 (eq)
+//
+// It only parses, a malformed parameter is kept so FindWithPagination
+// rejects it instead of listing unfiltered rows.
+func ParseFilters(values url.Values) []Filter {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	filters := make([]Filter, 0, len(keys))
+	for _, key := range keys {
+		filter := Filter{Field: key, Values: values[key]}
+
+		name, rest, ok := strings.Cut(strings.TrimPrefix(key, "filter["), "]")
+		switch {
+		case !ok:
+		case rest == "":
+			filter.Field, filter.Operator = name, EQ
+		case strings.HasPrefix(rest, "[") && strings.HasSuffix(rest, "]"):
+			filter.Field = name
+			filter.Operator = FilterOperatorEnum(strings.ToLower(rest[1 : len(rest)-1]))
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+// clauses checks filters against the whitelist and builds their conditions
+// with values of the field types
+func (f FilterFields) clauses(s *schema.Schema, filters []Filter) ([]clause.Expression, error) {
+	exprs := make([]clause.Expression, 0, len(filters))
+	for _, filter := range filters {
+		operators, ok := f[filter.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot filter on %s", ErrInvalidQuery, filter.Field)
+		}
+		if !filter.Operator.IsValid() || !containsOperator(operators, filter.Operator) {
+			return nil, fmt.Errorf("%w: operator %q is not allowed on %s", ErrInvalidQuery, filter.Operator, filter.Field)
+		}
+
+		field := s.LookUpField(filter.Field)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%s has no column %s", s.Name, filter.Field)
+		}
+
+		expr, err := filterClause(field, filter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: filter %s[%s]: %v", ErrInvalidQuery, filter.Field, filter.Operator, err)
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+func filterClause(field *schema.Field, filter Filter) (clause.Expression, error) {
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+	values := filter.Values
+	switch filter.Operator {
+	case IN, NIN, BETWEEN:
+		values = splitValues(values)
+	}
+
+	switch filter.Operator {
+	case IN, NIN:
+		if len(values) == 0 || len(values) > maxFilterValues {
+			return nil, fmt.Errorf("needs 1 to %d values", maxFilterValues)
+		}
+		in := clause.IN{Column: column, Values: make([]interface{}, len(values))}
+		for i, raw := range values {
+			value, err := filterValue(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			in.Values[i] = value
+		}
+		if filter.Operator == NIN {
+			return clause.Not(in), nil
+		}
+		return in, nil
+
+	case BETWEEN:
+		if len(values) != 2 {
+			return nil, fmt.Errorf("needs 2 values")
+		}
+		var lower, upper clause.Expression
+		if dayStart, _, ok := dateRange(field, values[0]); ok {
+			lower = clause.Gte{Column: column, Value: dayStart}
+		} else {
+			from, err := filterValue(field, values[0])
+			if err != nil {
+				return nil, err
+			}
+			lower = clause.Gte{Column: column, Value: from}
+		}
+		// a date as upper bound includes the whole day
+		if _, dayEnd, ok := dateRange(field, values[1]); ok {
+			upper = clause.Lt{Column: column, Value: dayEnd}
+		} else {
+			to, err := filterValue(field, values[1])
+			if err != nil {
+				return nil, err
+			}
+			upper = clause.Lte{Column: column, Value: to}
+		}
+		return clause.And(lower, upper), nil
+	}
+
+	if len(values) != 1 {
+		return nil, fmt.Errorf("needs 1 value")
+	}
+	raw := values[0]
+
+	switch filter.Operator {
+	case NULL:
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("needs true or false")
+		}
+		if isNull {
+			return clause.Eq{Column: column, Value: nil}, nil
+		}
+		return clause.Neq{Column: column, Value: nil}, nil
+
+	case LIKE:
+		if valueType(field).Kind() != reflect.String {
+			return nil, fmt.Errorf("needs a text field")
+		}
+		return clause.Like{Column: column, Value: "%" + escapeLike(raw) + "%"}, nil
+	}
+
+	// a date compares as the whole day, lte 2025-02-01 includes February 1st
+	if dayStart, dayEnd, ok := dateRange(field, raw); ok {
+		switch filter.Operator {
+		case NE:
+			return clause.Or(clause.Lt{Column: column, Value: dayStart}, clause.Gte{Column: column, Value: dayEnd}), nil
+		case GT:
+			return clause.Gte{Column: column, Value: dayEnd}, nil
+		case GTE:
+			return clause.Gte{Column: column, Value: dayStart}, nil
+		case LT:
+			return clause.Lt{Column: column, Value: dayStart}, nil
+		case LTE:
+			return clause.Lt{Column: column, Value: dayEnd}, nil
+		}
+		return clause.And(clause.Gte{Column: column, Value: dayStart}, clause.Lt{Column: column, Value: dayEnd}), nil
+	}
+
+	value, err := filterValue(field, raw)
+	if err != nil {
+		return nil, err
+	}
+	switch filter.Operator {
+	case NE:
+		return clause.Neq{Column: column, Value: value}, nil
+	case GT:
+		return clause.Gt{Column: column, Value: value}, nil
+	case GTE:
+		return clause.Gte{Column: column, Value: value}, nil
+	case LT:
+		return clause.Lt{Column: column, Value: value}, nil
+	case LTE:
+		return clause.Lte{Column: column, Value: value}, nil
+	}
+	return clause.Eq{Column: column, Value: value}, nil
+}
+
+// filterValue converts a query string value to the type of field, times are
+// RFC 3339 or a local date. An unencoded + of a time offset reads as a space
+// in a query string, so a space is taken as +.
+func filterValue(field *schema.Field, raw string) (interface{}, error) {
+	fieldType := valueType(field)
+
+	var value interface{}
+	var err error
+	switch fieldType.Kind() {
+	case reflect.String:
+		value = raw
+	case reflect.Bool:
+		value, err = strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err = strconv.ParseInt(raw, 10, fieldType.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err = strconv.ParseUint(raw, 10, fieldType.Bits())
+	case reflect.Float32, reflect.Float64:
+		value, err = strconv.ParseFloat(raw, fieldType.Bits())
+	case reflect.Struct:
+		if fieldType != reflect.TypeOf(time.Time{}) {
+			return nil, fmt.Errorf("cannot filter on %s", fieldType)
+		}
+		if value, err = time.Parse(time.RFC3339, strings.ReplaceAll(raw, " ", "+")); err != nil {
+			value, err = time.ParseInLocation(time.DateOnly, raw, time.Local)
+		}
+	default:
+		return nil, fmt.Errorf("cannot filter on %s", fieldType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", raw)
+	}
+
+	// named types keep their Valuer, like an enum
+	return reflect.ValueOf(value).Convert(fieldType).Interface(), nil
+}
+
+// dateRange is the local day of raw when field holds times and raw is a
+// date like 2025-02-01: from its midnight to the next
+func dateRange(field *schema.Field, raw string) (time.Time, time.Time, bool) {
+	fieldType := valueType(field)
+	if fieldType != reflect.TypeOf(time.Time{}) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	day, err := time.ParseInLocation(time.DateOnly, raw, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return day, day.AddDate(0, 0, 1), true
+}
+
+// valueType is the type of field without pointers, *time.Time is filtered
+// like time.Time
+func valueType(field *schema.Field) reflect.Type {
+	fieldType := field.FieldType
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	return fieldType
+}
+
+// splitValues splits values on commas and drops empty ones
+func splitValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v != "" {
+				split = append(split, v)
+			}
+		}
+	}
+	return split
+}
+
+// escapeLike matches % and _ literally, backslash is the default escape of
+// PostgreSQL and MySQL
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+func containsOperator(operators []FilterOperatorEnum, operator FilterOperatorEnum) bool {
+	for _, o := range operators {
+		if o == operator {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+type filterRow struct {
+	ID        string
+	Status    string
+	Amount    int64
+	Note      *string
+	CreatedAt time.Time
+	PaidAt    *time.Time
+}
+
+func (filterRow) FilterFields() FilterFields {
+	return FilterFields{
+		"status":     {EQ, IN, NIN, LIKE},
+		"amount":     RangeOperators,
+		"note":       {NULL, LIKE},
+		"created_at": RangeOperators,
+		"paid_at":    {LTE, NULL},
+	}
+}
+
+// renderFilters renders the WHERE clause of filters on filterRow
+func renderFilters(t *testing.T, db *Database, filters ...Filter) (string, []interface{}, error) {
+	t.Helper()
+	s, err := db.schemaOf(&filterRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs, err := filterRow{}.FilterFields().clauses(s, filters)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var rows []filterRow
+	stmt := db.Model(&rows).Where(clause.And(exprs...)).Find(&rows).Statement
+	return stmt.SQL.String(), stmt.Vars, nil
+}
+
+func TestDateFilterCoversTheDay(t *testing.T) {
+	day := func(date string) time.Time {
+		d, err := time.ParseInLocation(time.DateOnly, date, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	jan1, feb1, feb2 := day("2025-01-01"), day("2025-02-01"), day("2025-02-02")
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		wantSQL  string
+		wantVars []interface{}
+	}{
+		{
+			name:     "lte includes the day",
+			filter:   Filter{Field: "created_at", Operator: LTE, Values: []string{"2025-02-01"}},
+			wantSQL:  `"filter_rows"."created_at" < $1`,
+			wantVars: []interface{}{feb2},
+		},
+		{
+			name:     "lt excludes the day",
+			filter:   Filter{Field: "created_at", Operator: LT, Values: []string{"2025-02-01"}},
+			wantSQL:  `"filter_rows"."created_at" < $1`,
+			wantVars: []interface{}{feb1},
+		},
+		{
+			name:     "gt starts after the day",
+			filter:   Filter{Field: "created_at", Operator: GT, Values: []string{"2025-02-01"}},
+			wantSQL:  `"filter_rows"."created_at" >= $1`,
+			wantVars: []interface{}{feb2},
+		},
+		{
+			name:     "gte includes the day",
+			filter:   Filter{Field: "created_at", Operator: GTE, Values: []string{"2025-02-01"}},
+			wantSQL:  `"filter_rows"."created_at" >= $1`,
+			wantVars: []interface{}{feb1},
+		},
+		{
+			name:     "eq is the whole day",
+			filter:   Filter{Field: "created_at", Operator: EQ, Values: []string{"2025-02-01"}},
+			wantSQL:  `"filter_rows"."created_at" >= $1 AND "filter_rows"."created_at" < $2`,
+			wantVars: []interface{}{feb1, feb2},
+		},
+		{
+			name:     "ne is outside the day",
+			filter:   Filter{Field: "created_at", Operator: NE, Values: []string{"2025-02-01"}},
+			wantSQL:  `("filter_rows"."created_at" < $1 OR "filter_rows"."created_at" >= $2)`,
+			wantVars: []interface{}{feb1, feb2},
+		},
+		{
+			name:     "between includes the last day",
+			filter:   Filter{Field: "created_at", Operator: BETWEEN, Values: []string{"2025-01-01,2025-02-01"}},
+			wantSQL:  `"filter_rows"."created_at" >= $1 AND "filter_rows"."created_at" < $2`,
+			wantVars: []interface{}{jan1, feb2},
+		},
+		{
+			name:     "pointer time field",
+			filter:   Filter{Field: "paid_at", Operator: LTE, Values: []string{"2025-02-01"}},
+			wantSQL:  `"filter_rows"."paid_at" < $1`,
+			wantVars: []interface{}{feb2},
+		},
+	}
+
+	db := newDryRunDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars, err := renderFilters(t, db, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `SELECT * FROM "filter_rows" WHERE ` + tt.wantSQL; sql != want {
+				t.Errorf("sql =\n%s\nwant\n%s", sql, want)
+			}
+			if !reflect.DeepEqual(vars, tt.wantVars) {
+				t.Errorf("vars = %v, want %v", vars, tt.wantVars)
+			}
+		})
+	}
+}
+
+func TestTimeFilterValues(t *testing.T) {
+	at := time.Date(2025, 2, 1, 10, 0, 0, 0, time.FixedZone("", 7*60*60))
+	db := newDryRunDB(t)
+
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"encoded offset", "2025-02-01T10:00:00+07:00"},
+		// url.ParseQuery decodes an unencoded + to a space
+		{"offset decoded to a space", "2025-02-01T10:00:00 07:00"},
+		{"utc", "2025-02-01T03:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars, err := renderFilters(t, db, Filter{Field: "created_at", Operator: LTE, Values: []string{tt.raw}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `SELECT * FROM "filter_rows" WHERE "filter_rows"."created_at" <= $1`; sql != want {
+				t.Errorf("sql =\n%s\nwant\n%s", sql, want)
+			}
+			if got, ok := vars[0].(time.Time); !ok || !got.Equal(at) {
+				t.Errorf("value = %v, want %s", vars[0], at)
+			}
+		})
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	values, err := url.ParseQuery("filter[status][IN]=settlement,capture&filter[order_id]=ORDER-1" +
+		"&filter[amount][gte]=10&filter[amount][gte]=20&filter[status=x&filter[x]y=1&page=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Filter{
+		{Field: "amount", Operator: GTE, Values: []string{"10", "20"}},
+		{Field: "order_id", Operator: EQ, Values: []string{"ORDER-1"}},
+		// malformed keys keep the raw key, so they match no field
+		{Field: "filter[status", Values: []string{"x"}},
+		{Field: "status", Operator: IN, Values: []string{"settlement,capture"}},
+		{Field: "filter[x]y", Values: []string{"1"}},
+	}
+	if got := ParseFilters(values); !reflect.DeepEqual(got, want) {
+		t.Errorf("filters =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestFiltersRejectInvalidQueries(t *testing.T) {
+	tooMany := strings.TrimSuffix(strings.Repeat("s,", maxFilterValues+1), ",")
+
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{"field not whitelisted", Filter{Field: "id", Operator: EQ, Values: []string{"1"}}},
+		{"operator not allowed on the field", Filter{Field: "status", Operator: GT, Values: []string{"a"}}},
+		{"unknown operator", Filter{Field: "status", Operator: "regex", Values: []string{"a"}}},
+		{"malformed key", Filter{Field: "filter[status", Values: []string{"a"}}},
+		{"in without values", Filter{Field: "status", Operator: IN, Values: []string{","}}},
+		{"in over the cap", Filter{Field: "status", Operator: IN, Values: []string{tooMany}}},
+		{"nin over the cap", Filter{Field: "status", Operator: NIN, Values: []string{tooMany}}},
+		{"between with one value", Filter{Field: "amount", Operator: BETWEEN, Values: []string{"1"}}},
+		{"two values", Filter{Field: "amount", Operator: GTE, Values: []string{"1", "2"}}},
+		{"value of another type", Filter{Field: "amount", Operator: EQ, Values: []string{"ten"}}},
+		{"invalid time", Filter{Field: "created_at", Operator: GTE, Values: []string{"yesterday"}}},
+		{"null not a boolean", Filter{Field: "note", Operator: NULL, Values: []string{"maybe"}}},
+	}
+
+	db := newDryRunDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := renderFilters(t, db, tt.filter); !IsInvalidQuery(err) {
+				t.Errorf("err = %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}
+
+func TestFilterClauses(t *testing.T) {
+	atCap := strings.TrimSuffix(strings.Repeat("s,", maxFilterValues), ",")
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		wantSQL  string
+		wantVars []interface{}
+	}{
+		{
+			name:     "eq",
+			filter:   Filter{Field: "status", Operator: EQ, Values: []string{"settlement"}},
+			wantSQL:  `"filter_rows"."status" = $1`,
+			wantVars: []interface{}{"settlement"},
+		},
+		{
+			name:     "in drops empty values",
+			filter:   Filter{Field: "status", Operator: IN, Values: []string{"settlement,,capture"}},
+			wantSQL:  `"filter_rows"."status" IN ($1,$2)`,
+			wantVars: []interface{}{"settlement", "capture"},
+		},
+		{
+			name:     "nin",
+			filter:   Filter{Field: "status", Operator: NIN, Values: []string{"expire", "cancel"}},
+			wantSQL:  `"filter_rows"."status" NOT IN ($1,$2)`,
+			wantVars: []interface{}{"expire", "cancel"},
+		},
+		{
+			name:     "typed range",
+			filter:   Filter{Field: "amount", Operator: BETWEEN, Values: []string{"100,200"}},
+			wantSQL:  `"filter_rows"."amount" >= $1 AND "filter_rows"."amount" <= $2`,
+			wantVars: []interface{}{int64(100), int64(200)},
+		},
+		{
+			name:    "null true",
+			filter:  Filter{Field: "note", Operator: NULL, Values: []string{"true"}},
+			wantSQL: `"filter_rows"."note" IS NULL`,
+		},
+		{
+			name:    "null false",
+			filter:  Filter{Field: "note", Operator: NULL, Values: []string{"false"}},
+			wantSQL: `"filter_rows"."note" IS NOT NULL`,
+		},
+		{
+			name:     "like escapes wildcards",
+			filter:   Filter{Field: "status", Operator: LIKE, Values: []string{`50%_off\`}},
+			wantSQL:  `"filter_rows"."status" LIKE $1`,
+			wantVars: []interface{}{`%50\%\_off\\%`},
+		},
+		{
+			name:     "like on a pointer to text",
+			filter:   Filter{Field: "note", Operator: LIKE, Values: []string{"gift"}},
+			wantSQL:  `"filter_rows"."note" LIKE $1`,
+			wantVars: []interface{}{"%gift%"},
+		},
+	}
+
+	db := newDryRunDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars, err := renderFilters(t, db, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `SELECT * FROM "filter_rows" WHERE ` + tt.wantSQL; sql != want {
+				t.Errorf("sql =\n%s\nwant\n%s", sql, want)
+			}
+			if len(vars) != 0 || len(tt.wantVars) != 0 {
+				if !reflect.DeepEqual(vars, tt.wantVars) {
+					t.Errorf("vars = %v, want %v", vars, tt.wantVars)
+				}
+			}
+		})
+	}
+
+	t.Run("in at the cap", func(t *testing.T) {
+		_, vars, err := renderFilters(t, db, Filter{Field: "status", Operator: IN, Values: []string{atCap}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vars) != maxFilterValues {
+			t.Errorf("%d values, want %d", len(vars), maxFilterValues)
+		}
+	})
+}
+
+func TestFindWithPaginationRejectsFilters(t *testing.T) {
+	db := newDryRunDB(t)
+	query := PaginationQuery{Limit: 10, Page: 1, SortBy: "created_at", SortOrder: "desc"}
+
+	// filterRow only allows its FilterFields
+	query.Filters = []Filter{{Field: "id", Operator: EQ, Values: []string{"1"}}}
+	if _, err := db.FindWithPagination(nil, query, &[]filterRow{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("filter on id: %v, want ErrInvalidQuery", err)
+	}
+
+	// cursorRow has no FilterFields at all
+	query.Filters = []Filter{{Field: "seq", Operator: EQ, Values: []string{"1"}}}
+	if _, err := db.FindWithPagination(nil, query, &[]cursorRow{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("filter on a model without FilterFields: %v, want ErrInvalidQuery", err)
+	}
+
+	query.Filters = nil
+	query.SortBy = "amount;drop"
+	if _, err := db.FindWithPagination(nil, query, &[]filterRow{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("sort by an unknown column: %v, want ErrInvalidQuery", err)
+	}
+}
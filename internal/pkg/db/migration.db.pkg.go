@@ -1,145 +1,459 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"go-boilerplate/internal/common/models"
 	"go-boilerplate/internal/pkg/logger"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func (db *Database) RunMigrations() error {
-	logger.Info.Println("Starting database migrations...")
+const (
+	// schemaMigrationsTable has a row per applied migration
+	schemaMigrationsTable = "schema_migrations"
+	// migrationLockKey is the PostgreSQL advisory lock held while migrating,
+	// pods starting together migrate one at a time
+	migrationLockKey int64 = 7_264_091_538
+	// noTransactionDirective on the first line runs a migration outside a
+	// transaction, for statements like CREATE INDEX CONCURRENTLY. On MySQL
+	// every migration runs that way.
+	noTransactionDirective = "-- migrate:no-transaction"
+)
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
 
-	// Create extensions first
-	// if err := db.createExtensions(); err != nil {
-	// 	return fmt.Errorf("failed to create extensions: %w", err)
-	// }
+// ErrDirtyMigration is returned while a migration that ran outside a
+// transaction failed halfway. Repair the schema by hand, then run force.
+var ErrDirtyMigration = errors.New("database is dirty")
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
 
-	// Note: analisis_status is now handled as VARCHAR type in models
-	// No custom types needed
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Dirty     bool
+	// Modified is set when the up file changed after it was applied
+	Modified bool
+	// Missing is set when an applied migration has no file anymore
+	Missing bool
+}
+
+type appliedMigration struct {
+	version   int64
+	name      string
+	checksum  string
+	dirty     bool
+	appliedAt time.Time
+}
+
+// Migrator applies versioned SQL migrations and records them in
+// schema_migrations with the checksum of their up file
+type Migrator struct {
+	db         *Database
+	dialect    *migrationDialect
+	migrations []*Migration
+}
+
+// NewMigrator runs the migrations in fsys, written for the driver of db. On
+// MySQL db needs MultiStatements.
+func NewMigrator(db *Database, fsys fs.FS) (*Migrator, error) {
+	dialect, err := migrationDialectOf(db.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
 
-	// Define models in dependency order
-	models := []interface{}{
-		&models.Transaction{},
+// LoadMigrations reads the migration files at the root of fsys sorted by
+// version, every version needs an up file
+func LoadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
 	}
 
-	for _, model := range models {
-		logger.Info.Printf("Migrating model: %T", model)
-		if err := db.AutoMigrate(model); err != nil {
-			return fmt.Errorf("failed to migrate %T: %w", model, err)
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", migration.Name, match[2], version)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
 		}
 	}
 
-	// Create indexes after all tables are created
-	// if err := db.createIndexes(); err != nil {
-	// 	return fmt.Errorf("failed to create indexes: %w", err)
-	// }
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
 
-	// Create triggers for updated_at columns
-	// if err := db.createTriggers(); err != nil {
-	// 	return fmt.Errorf("failed to create triggers: %w", err)
-	// }
+// Up applies every pending migration in version order and returns them
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var done []*Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
 
-	logger.Info.Println("Database migrations completed successfully")
-	return nil
+		for _, migration := range m.migrations {
+			if row, ok := applied[migration.Version]; ok {
+				if row.checksum != migration.Checksum {
+					return fmt.Errorf("migration %d_%s changed after it was applied, add a new migration instead", migration.Version, migration.Name)
+				}
+				continue
+			}
+
+			logger.Info.Printf("Applying migration %d_%s", migration.Version, migration.Name)
+			if err := m.run(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
 }
 
-func (db *Database) createExtensions() error {
-	query := `CREATE EXTENSION IF NOT EXISTS "pgcrypto";`
-	return db.Exec(query).Error
+// Down reverts the last n applied migrations, newest first, and returns them
+func (m *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+	files := make(map[int64]*Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		files[migration.Version] = migration
+	}
+
+	var done []*Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, version := range versions[:min(n, len(versions))] {
+			migration, ok := files[version]
+			if !ok {
+				return fmt.Errorf("applied migration %d_%s has no file", version, applied[version].name)
+			}
+			if strings.TrimSpace(migration.Down) == "" {
+				return fmt.Errorf("migration %d_%s has no down file", version, migration.Name)
+			}
+
+			logger.Info.Printf("Reverting migration %d_%s", migration.Version, migration.Name)
+			if err := m.run(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
 }
 
-func (db *Database) createIndexes() error {
-	indexes := []string{
-		// Customer indexes
-		`CREATE INDEX IF NOT EXISTS idx_customers_team_id ON customers(team_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_customers_nik ON customers(nik);`,
-		`CREATE INDEX IF NOT EXISTS idx_customers_status ON customers(status);`,
-		`CREATE INDEX IF NOT EXISTS idx_customers_created_at ON customers(created_at);`,
-		`CREATE INDEX IF NOT EXISTS idx_customers_deleted_at ON customers(deleted_at);`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_code_team ON customers(code, team_id);`,
+// Status lists the migration files and the applied migrations without a file
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
 
-		// Credit applications indexes
-		`CREATE INDEX IF NOT EXISTS idx_credit_applications_customer_id ON credit_applications(customer_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_credit_applications_code ON credit_applications(code);`,
-		`CREATE INDEX IF NOT EXISTS idx_credit_applications_threshold_value ON credit_applications(threshold_value);`,
-		`CREATE INDEX IF NOT EXISTS idx_credit_applications_status ON credit_applications(status);`,
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &row.appliedAt
+			status.Dirty = row.dirty
+			status.Modified = row.checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		appliedAt := row.appliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   row.version,
+			Name:      row.name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Dirty:     row.dirty,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
 
-		// Data room indexes
-		`CREATE INDEX IF NOT EXISTS idx_data_room_team_id ON data_room(team_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_data_room_status ON data_room(status);`,
-		`CREATE INDEX IF NOT EXISTS idx_dataroom_name_team ON data_room(name, team_id);`,
+// Force records the database as migrated up to version, clean and with the
+// current checksums, without running any SQL. Use it after repairing a
+// failed migration by hand; version 0 forgets every migration.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	known := version == 0
+	for _, migration := range m.migrations {
+		known = known || migration.Version == version
+	}
+	if !known {
+		return fmt.Errorf("no migration with version %d", version)
+	}
 
-		// Bank statement docs indexes
-		`CREATE INDEX IF NOT EXISTS idx_bank_statement_docs_team_id ON bank_statement_docs(team_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_bank_statement_docs_status ON bank_statement_docs(status);`,
-		`CREATE INDEX IF NOT EXISTS idx_bank_statement_docs_account_number ON bank_statement_docs(account_number);`,
-		`CREATE INDEX IF NOT EXISTS idx_bank_statement_docs_period ON bank_statement_docs(period);`,
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer func() { _ = tx.Rollback() }()
 
-		// Bank statement indexes
-		`CREATE INDEX IF NOT EXISTS idx_bank_statement_docs_id ON bank_statement(bank_statement_docs_id);`,
+		if _, err := tx.ExecContext(ctx, m.dialect.placeholders(`DELETE FROM `+schemaMigrationsTable+` WHERE version > ?`), version); err != nil {
+			return fmt.Errorf("failed to force version %d: %w", version, err)
+		}
+		upsert := m.dialect.upsert("name", "checksum", "dirty")
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, err := tx.ExecContext(ctx, upsert, migration.Version, migration.Name, migration.Checksum, false); err != nil {
+				return fmt.Errorf("failed to force version %d: %w", version, err)
+			}
+		}
+		return tx.Commit()
+	})
+}
 
-		// Junction table indexes
-		`CREATE INDEX IF NOT EXISTS idx_dataroom_bankstatement_data_room_id ON data_room_bank_statement_docs(data_room_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_dataroom_collateral_data_room_id ON data_room_collateral_docs(data_room_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_dataroom_slikojk_data_room_id ON data_room_slik_ojk_docs(data_room_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_dataroom_relatedparties_data_room_id ON data_room_related_parties(data_room_id);`,
+// run applies or reverts one migration. In a transaction the SQL and its
+// record commit together. Outside one the record is marked dirty until the
+// SQL succeeds, a failure leaves it dirty for force.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration *Migration, up bool) error {
+	query, action := migration.Up, "apply"
+	if !up {
+		query, action = migration.Down, "revert"
 	}
 
-	for _, query := range indexes {
-		if err := db.Exec(query).Error; err != nil {
-			logger.Error.Printf("Error creating index: %s, Error: %v", query, err)
-			return err
+	if !m.dialect.transactional || strings.HasPrefix(strings.TrimSpace(query), noTransactionDirective) {
+		var err error
+		if up {
+			_, err = conn.ExecContext(ctx, m.dialect.placeholders(`INSERT INTO `+schemaMigrationsTable+` (version, name, checksum, dirty) VALUES (?, ?, ?, TRUE)`),
+				migration.Version, migration.Name, migration.Checksum)
+		} else {
+			_, err = conn.ExecContext(ctx, m.dialect.placeholders(`UPDATE `+schemaMigrationsTable+` SET dirty = TRUE WHERE version = ?`), migration.Version)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
 		}
+
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to %s migration %d_%s, the database is dirty: %w", action, migration.Version, migration.Name, err)
+		}
+
+		if up {
+			_, err = conn.ExecContext(ctx, m.dialect.placeholders(`UPDATE `+schemaMigrationsTable+` SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = ?`), migration.Version)
+		} else {
+			_, err = conn.ExecContext(ctx, m.dialect.placeholders(`DELETE FROM `+schemaMigrationsTable+` WHERE version = ?`), migration.Version)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		return nil
 	}
 
-	return nil
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to %s migration %d_%s: %w", action, migration.Version, migration.Name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, m.dialect.placeholders(`INSERT INTO `+schemaMigrationsTable+` (version, name, checksum, dirty) VALUES (?, ?, ?, FALSE)`),
+			migration.Version, migration.Name, migration.Checksum)
+	} else {
+		_, err = tx.ExecContext(ctx, m.dialect.placeholders(`DELETE FROM `+schemaMigrationsTable+` WHERE version = ?`), migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return tx.Commit()
 }
 
-func (db *Database) createTriggers() error {
-	// Create the trigger function first
-	triggerFunction := `
-	CREATE OR REPLACE FUNCTION update_updated_at_column()
-	RETURNS TRIGGER AS $$
-	BEGIN
-		NEW.updated_at = NOW();
-		RETURN NEW;
-	END;
-	$$ language 'plpgsql';`
+// withLock runs fn on one connection holding the migration lock, so the
+// lock and the migrations share a session
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
 
-	if err := db.Exec(triggerFunction).Error; err != nil {
+	var answer any
+	if err := conn.QueryRowContext(ctx, m.dialect.placeholders(m.dialect.tryLock), m.dialect.lockKey).Scan(&answer); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !locked(answer) {
+		logger.Info.Println("Another migration is running, waiting for its lock...")
+		if _, err := conn.ExecContext(ctx, m.dialect.placeholders(m.dialect.lock), m.dialect.lockKey); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), m.dialect.placeholders(m.dialect.unlock), m.dialect.lockKey); err != nil {
+			logger.Warning.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
 		return err
 	}
+	return fn(conn)
+}
 
-	// Tables that need updated_at triggers
-	tables := []string{
-		"customers",
-		"credit_applications",
-		"data_room",
-		"bank_statement_docs",
-		"bank_statement_indicator_categories",
-		"bank_statement_indicator_types",
-		"bank_statement_analyses",
-		"collateral_docs",
-		"slik_ojk_docs",
-		"slik_ojk_doc_analysis",
-		"related_parties_masters",
-		"related_parties_lists",
-		"related_parties",
-	}
-
-	for _, table := range tables {
-		triggerQuery := fmt.Sprintf(`
-		DROP TRIGGER IF EXISTS update_%s_updated_at ON %s;
-		CREATE TRIGGER update_%s_updated_at
-		BEFORE UPDATE ON %s
-		FOR EACH ROW EXECUTE PROCEDURE update_updated_at_column();`,
-			table, table, table, table)
-
-		if err := db.Exec(triggerQuery).Error; err != nil {
-			logger.Error.Printf("Error creating trigger for table %s: %v", table, err)
-			return err
+func (m *Migrator) conn(ctx context.Context) (*sql.Conn, error) {
+	sqlDB, err := m.db.DB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database instance: %w", err)
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	return conn, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return fmt.Errorf("failed to create %s: %w", schemaMigrationsTable, err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, dirty, applied_at FROM `+schemaMigrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var row appliedMigration
+		if err := rows.Scan(&row.version, &row.name, &row.checksum, &row.dirty, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
 		}
+		applied[row.version] = row
 	}
+	return applied, rows.Err()
+}
 
+func checkClean(applied map[int64]appliedMigration) error {
+	for _, row := range applied {
+		if row.dirty {
+			return fmt.Errorf("migration %d_%s failed halfway, repair it and run force: %w", row.version, row.name, ErrDirtyMigration)
+		}
+	}
 	return nil
 }
+
+var migrationName = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateMigration writes empty up and down files for the next version in
+// every dir, the migrations of each driver, and returns their paths
+func CreateMigration(name string, dirs ...string) ([]string, error) {
+	name = strings.Trim(migrationName.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migration name is empty")
+	}
+
+	var version int64 = 1
+	for _, dir := range dirs {
+		migrations, err := LoadMigrations(os.DirFS(dir))
+		if err != nil {
+			return nil, err
+		}
+		if len(migrations) > 0 {
+			version = max(version, migrations[len(migrations)-1].Version+1)
+		}
+	}
+
+	var paths []string
+	for _, dir := range dirs {
+		base := filepath.Join(dir, fmt.Sprintf("%06d_%s", version, name))
+		up, down := base+".up.sql", base+".down.sql"
+		if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to create migration: %w", err)
+		}
+		if err := os.WriteFile(down, []byte("-- revert "+name+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to create migration: %w", err)
+		}
+		paths = append(paths, up, down)
+	}
+	return paths, nil
+}
@@ -1,16 +1,16 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"reflect"
 	"strings"
 
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
-
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 type PaginationResult struct {
@@ -42,6 +42,8 @@ type PaginationQuery struct {
 	Limit     int    `form:"limit" json:"limit"`
 	SortBy    string `form:"sort_by" json:"sort_by"` // Field to sort by
 	SortOrder string `form:"sort_order" json:"sort_order"`
+	// Filters are the filter[field][operator] parameters, see ParseFilters
+	Filters []Filter `form:"-" json:"-"`
 }
 
 const (
@@ -55,6 +57,7 @@ const (
 func NewPaginationRequest(c *gin.Context) *PaginationQuery {
 	var query PaginationQuery
 	_ = c.ShouldBindQuery(&query)
+	query.Filters = ParseFilters(c.Request.URL.Query())
 	return query.Parse()
 }
 
@@ -83,6 +86,7 @@ func (q *PaginationQuery) Parse() *PaginationQuery {
 		Limit:     limit,
 		SortBy:    q.SortBy,
 		SortOrder: q.SortOrder,
+		Filters:   q.Filters,
 	}
 }
 
@@ -95,13 +99,15 @@ func (q *PaginationQuery) Paginate() func(db *gorm.DB) *gorm.DB {
 	}
 }
 
-// FindWithPagination executes the query with pagination and returns PaginationResult
+// FindWithPagination executes the query with pagination and returns PaginationResult.
+// The filters of query must be whitelisted by the model of dest, see
+// Filterable, and like an unknown sort column fail with ErrInvalidQuery.
 //
 // Example basic usage:
 //
 // var users []User
 // pagination := database.NewPaginationRequest(c)
-// result, err := db.FindWithPagination(pagination, &users)
+// result, err := db.FindWithPagination(nil, *pagination, &users)
 // // result.Data contains first 10 users
 // // result.TotalItems contains total count of users
 //
@@ -109,14 +115,28 @@ func (q *PaginationQuery) Paginate() func(db *gorm.DB) *gorm.DB {
 //
 // var users []User
 // pagination := database.NewPaginationRequest(c)
-// db = db.Where("name LIKE ?", "%john%")
-// result, err := db.FindWithPagination(pagination, &users)
+// result, err := db.FindWithPagination(nil, *pagination, &users, "name LIKE ?", "%john%")
 // // result.Data contains first 10 users with name containing "john"
+//
+// Example with filters, GET /transactions?filter[status][in]=settlement,capture:
+//
+// var trxs []models.Transaction
+// pagination := database.NewPaginationRequest(c)
+// result, err := db.FindWithPagination(nil, *pagination, &trxs)
+// // database.IsInvalidQuery(err) reports filters the model does not allow, respond 400
 func (db *Database) FindWithPagination(builder *gorm.DB, query PaginationQuery, dest interface{}, conditions ...interface{}) (*PaginationResult, error) {
 	var totalItems int64
 
+	s, err := db.schemaOf(dest)
+	if err != nil {
+		return nil, err
+	}
+
 	// build where clause
-	whereStr, args := BuildCondition(conditions...)
+	whereStr, args, err := BuildCondition(conditions...)
+	if err != nil {
+		return nil, err
+	}
 	tx := db.Model(dest)
 
 	if builder != nil {
@@ -127,6 +147,18 @@ func (db *Database) FindWithPagination(builder *gorm.DB, query PaginationQuery,
 		tx = tx.Where(whereStr, args...)
 	}
 
+	if len(query.Filters) > 0 {
+		filterable, ok := reflect.New(s.ModelType).Interface().(Filterable)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s cannot be filtered", ErrInvalidQuery, s.Name)
+		}
+		exprs, err := filterable.FilterFields().clauses(s, query.Filters)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(clause.And(exprs...))
+	}
+
 	if err := tx.Count(&totalItems).Error; err != nil {
 		return nil, err
 	}
@@ -135,15 +167,15 @@ func (db *Database) FindWithPagination(builder *gorm.DB, query PaginationQuery,
 	scope := tx.Scopes(query.Paginate())
 
 	// build order clause
-	orderStr := fmt.Sprintf("%s %s", query.SortBy, strings.ToLower(query.SortOrder))
 	if query.SortBy != "" {
-		order := strings.ToLower(query.SortOrder)
-		if order != "asc" && order != "desc" {
-			order = "desc"
+		column, _, err := lookUpColumn(s, query.SortBy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot sort by %s", ErrInvalidQuery, query.SortBy)
 		}
-		orderStr = fmt.Sprintf("%s %s", query.SortBy, order)
-
-		scope = scope.Order(orderStr)
+		scope = scope.Order(clause.OrderByColumn{
+			Column: column,
+			Desc:   !strings.EqualFold(query.SortOrder, string(ASC)),
+		})
 	}
 
 	if err := scope.Find(dest).Error; err != nil {
@@ -159,10 +191,12 @@ func (db *Database) FindWithPagination(builder *gorm.DB, query PaginationQuery,
 	}, nil
 }
 
-func BuildCondition(conditions ...interface{}) (string, []interface{}) {
+// BuildCondition joins query and argument pairs with AND, like
+// BuildCondition("status = ?", "settlement", "gross_amount >= ?", 10000).
+// The queries are SQL and must never come from a request, use filters there.
+func BuildCondition(conditions ...interface{}) (string, []interface{}, error) {
 	if len(conditions)%2 != 0 {
-		fmt.Println("[BuildCondition] ⚠️ jumlah conditions ganjil, mungkin ada pasangan query-arg yang hilang")
-		return "", nil
+		return "", nil, fmt.Errorf("conditions need query and argument pairs, got %d values", len(conditions))
 	}
 
 	var queryParts []string
@@ -171,68 +205,226 @@ func BuildCondition(conditions ...interface{}) (string, []interface{}) {
 	for i := 0; i < len(conditions); i += 2 {
 		queryPart, ok := conditions[i].(string)
 		if !ok {
-			fmt.Printf("[BuildCondition] ❌ conditions[%d] bukan string: %#v\n", i, conditions[i])
-			continue
+			return "", nil, fmt.Errorf("condition %d is %T, not a query string", i/2, conditions[i])
 		}
 
 		queryParts = append(queryParts, queryPart)
 		args = append(args, conditions[i+1])
 	}
 
-	return strings.Join(queryParts, " AND "), args
+	return strings.Join(queryParts, " AND "), args, nil
+}
+
+// cursorPayload is encrypted into a cursor, Orders rejects a cursor made for
+// another ordering
+type cursorPayload struct {
+	Orders []string          `json:"o"`
+	Values []json.RawMessage `json:"v"`
 }
 
-// FindWithCursor executes the query with infinite scrolling and returns CursorResult
+// cursorColumn is an order resolved against the schema of dest
+type cursorColumn struct {
+	column clause.Column
+	field  *schema.Field
+	desc   bool
+}
+
+// FindWithCursor pages dest with a keyset cursor over orders, like
+// created_at DESC, id DESC. The orders must end in a unique column and may
+// mix directions, their columns must not be NULL. The cursor holds the typed
+// values of the last row, so the next page starts right after it even when
+// created_at repeats. builder carries the caller's filters, dest's model is
+// queried when it is nil.
 //
 // Example basic usage:
 //
-//	var users []User
-//	result, err := db.FindWithCursor("", 10, &users, "id")
-//	// result.Items contains first 10 users
-//	// result.NextCursor contains the cursor for the next page
+//	var trxs []models.Transaction
+//	result, err := db.FindWithCursor(db.Where("status = ?", "settlement"), cursor, 20, &trxs,
+//		database.OrderField{Field: "created_at", Direction: database.DESC},
+//		database.OrderField{Field: "id", Direction: database.DESC},
+//	)
+//	// result.Items contains the first 20 settled transactions
+//	// result.NextCursor continues after the last of them
 //	// result.HasMore is true if there are more items
-func (db *Database) FindWithCursor(encryptedCursor string, limit int, dest interface{}, order OrderField) (*CursorResult, error) {
+func (db *Database) FindWithCursor(builder *gorm.DB, encryptedCursor string, limit int, dest interface{}, orders ...OrderField) (*CursorResult, error) {
 	if limit <= 0 {
-		limit = 10
+		limit = defaultLimit
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("cursor pagination needs at least one order")
+	}
+
+	columns, err := db.cursorColumns(dest, orders)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(columns))
+	orderBy := make([]clause.OrderByColumn, len(columns))
+	for i, c := range columns {
+		keys[i] = c.key()
+		orderBy[i] = clause.OrderByColumn{Column: c.column, Desc: c.desc}
 	}
 
-	limit++
-	query := db.DB
+	query := db.Model(dest)
+	if builder != nil {
+		query = builder
+	}
 
 	if encryptedCursor != "" {
-		cursor, err := db.cursorCrypto.decrypt(encryptedCursor)
+		values, err := db.decodeCursor(encryptedCursor, keys, columns)
 		if err != nil {
-			return nil, fmt.Errorf("invalid cursor: %w", err)
-		}
-		if cursor != "" {
-			query = query.Where(order.Field+" < ?", cursor)
+			return nil, err
 		}
+		query = query.Where(keysetCondition(columns, values))
 	}
 
-	query = query.Order(order.ToString()).Limit(limit)
-
-	if err := query.Find(dest).Error; err != nil {
+	if err := query.Order(clause.OrderBy{Columns: orderBy}).Limit(limit + 1).Find(dest).Error; err != nil {
 		return nil, err
 	}
 
 	result := &CursorResult{
 		Items:   dest,
-		PerPage: limit - 1,
+		PerPage: limit,
 	}
 
 	items := reflect.ValueOf(dest).Elem()
-	if items.Len() == limit {
-		items.Set(items.Slice(0, items.Len()-1))
+	if items.Len() > limit {
+		items.Set(items.Slice(0, limit))
 		result.HasMore = true
 
-		lastItem := items.Index(items.Len() - 1)
-		cursorField := lastItem.FieldByName(cases.Title(language.Und).String(strings.Split(order.Field, ".")[len(strings.Split(order.Field, "."))-1]))
-		nextCursor, err := db.cursorCrypto.encrypt(fmt.Sprint(cursorField.Interface()))
+		nextCursor, err := db.encodeCursor(keys, columns, reflect.Indirect(items.Index(limit-1)))
 		if err != nil {
-			return nil, fmt.Errorf("failed to encrypt cursor: %w", err)
+			return nil, err
 		}
 		result.NextCursor = nextCursor
 	}
 
 	return result, nil
 }
+
+// key names the column and direction in a cursor
+func (c cursorColumn) key() string {
+	if c.desc {
+		return c.field.DBName + " " + string(DESC)
+	}
+	return c.field.DBName + " " + string(ASC)
+}
+
+// cursorColumns looks the orders up in the schema of dest, by column or
+// field name, optionally prefixed by a table
+func (db *Database) cursorColumns(dest interface{}, orders []OrderField) ([]cursorColumn, error) {
+	s, err := db.schemaOf(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]cursorColumn, len(orders))
+	for i, order := range orders {
+		column, field, err := lookUpColumn(s, order.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		direction := DirectionEnum(strings.ToLower(string(order.Direction)))
+		if direction != "" && !direction.IsValid() {
+			return nil, fmt.Errorf("invalid direction %q for %s", order.Direction, order.Field)
+		}
+
+		columns[i] = cursorColumn{
+			column: column,
+			field:  field,
+			desc:   direction == DESC,
+		}
+	}
+	return columns, nil
+}
+
+func (db *Database) schemaOf(dest interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db.DB}
+	if err := stmt.Parse(dest); err != nil {
+		return nil, fmt.Errorf("failed to parse %T: %w", dest, err)
+	}
+	return stmt.Schema, nil
+}
+
+// lookUpColumn finds a column by column or field name, optionally prefixed by
+// a table
+func lookUpColumn(s *schema.Schema, name string) (clause.Column, *schema.Field, error) {
+	table, fieldName := clause.CurrentTable, name
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		table, fieldName = name[:dot], name[dot+1:]
+	}
+
+	field := s.LookUpField(fieldName)
+	if field == nil || field.DBName == "" {
+		return clause.Column{}, nil, fmt.Errorf("%s has no column %s", s.Name, name)
+	}
+	return clause.Column{Table: table, Name: field.DBName}, field, nil
+}
+
+// keysetCondition selects the rows after values in the order of columns:
+// a > x OR (a = x AND b > y) ..., with < for descending columns
+func keysetCondition(columns []cursorColumn, values []interface{}) clause.Expression {
+	ors := make([]clause.Expression, len(columns))
+	for i, c := range columns {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: columns[j].column, Value: values[j]})
+		}
+		if c.desc {
+			ands = append(ands, clause.Lt{Column: c.column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: c.column, Value: values[i]})
+		}
+		ors[i] = clause.And(ands...)
+	}
+	return clause.Or(ors...)
+}
+
+func (db *Database) encodeCursor(keys []string, columns []cursorColumn, row reflect.Value) (string, error) {
+	payload := cursorPayload{Orders: keys, Values: make([]json.RawMessage, len(columns))}
+	for i, c := range columns {
+		value, _ := c.field.ValueOf(db.Statement.Context, row)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode cursor value %s: %w", c.field.DBName, err)
+		}
+		payload.Values[i] = encoded
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	cursor, err := db.cursorCrypto.encrypt(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt cursor: %w", err)
+	}
+	return cursor, nil
+}
+
+// decodeCursor restores the values of a cursor as the types of their fields
+func (db *Database) decodeCursor(encryptedCursor string, keys []string, columns []cursorColumn) ([]interface{}, error) {
+	data, err := db.cursorCrypto.decrypt(encryptedCursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if strings.Join(payload.Orders, ",") != strings.Join(keys, ",") || len(payload.Values) != len(columns) {
+		return nil, fmt.Errorf("invalid cursor: made for another order")
+	}
+
+	values := make([]interface{}, len(columns))
+	for i, c := range columns {
+		value := reflect.New(c.field.FieldType)
+		if err := json.Unmarshal(payload.Values[i], value.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid cursor value %s: %w", c.field.DBName, err)
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
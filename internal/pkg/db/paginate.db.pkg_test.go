@@ -0,0 +1,225 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type cursorRow struct {
+	ID        string
+	Seq       int64
+	CreatedAt time.Time
+	PaidAt    *time.Time
+}
+
+// newDryRunDB renders SQL without a server
+func newDryRunDB(t *testing.T) *Database {
+	t.Helper()
+	g, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=x"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypto, err := newCursorCrypto([]byte("cursor-test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Database{g, &Config{}, crypto}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		orders   []OrderField
+		values   []interface{}
+		wantSQL  string
+		wantVars []interface{}
+	}{
+		{
+			name:     "one column asc",
+			orders:   []OrderField{{"id", ASC}},
+			values:   []interface{}{"a"},
+			wantSQL:  `"cursor_rows"."id" > $1`,
+			wantVars: []interface{}{"a"},
+		},
+		{
+			name:     "one column desc",
+			orders:   []OrderField{{"created_at", DESC}},
+			values:   []interface{}{at},
+			wantSQL:  `"cursor_rows"."created_at" < $1`,
+			wantVars: []interface{}{at},
+		},
+		{
+			name:     "two columns desc",
+			orders:   []OrderField{{"created_at", DESC}, {"id", DESC}},
+			values:   []interface{}{at, "a"},
+			wantSQL:  `("cursor_rows"."created_at" < $1 OR ("cursor_rows"."created_at" = $2 AND "cursor_rows"."id" < $3))`,
+			wantVars: []interface{}{at, at, "a"},
+		},
+		{
+			name:     "two columns asc then desc",
+			orders:   []OrderField{{"seq", ASC}, {"id", DESC}},
+			values:   []interface{}{int64(7), "a"},
+			wantSQL:  `("cursor_rows"."seq" > $1 OR ("cursor_rows"."seq" = $2 AND "cursor_rows"."id" < $3))`,
+			wantVars: []interface{}{int64(7), int64(7), "a"},
+		},
+		{
+			name:   "three columns mixed, by field name and table",
+			orders: []OrderField{{"CreatedAt", DESC}, {"cursor_rows.seq", ASC}, {"id", DESC}},
+			values: []interface{}{at, int64(7), "a"},
+			wantSQL: `("cursor_rows"."created_at" < $1` +
+				` OR ("cursor_rows"."created_at" = $2 AND "cursor_rows"."seq" > $3)` +
+				` OR ("cursor_rows"."created_at" = $4 AND "cursor_rows"."seq" = $5 AND "cursor_rows"."id" < $6))`,
+			wantVars: []interface{}{at, at, int64(7), at, int64(7), "a"},
+		},
+	}
+
+	db := newDryRunDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := db.cursorColumns(&[]cursorRow{}, tt.orders)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rows []cursorRow
+			stmt := db.Model(&rows).Where(keysetCondition(columns, tt.values)).Find(&rows).Statement
+
+			want := `SELECT * FROM "cursor_rows" WHERE ` + tt.wantSQL
+			if got := stmt.SQL.String(); got != want {
+				t.Errorf("sql =\n%s\nwant\n%s", got, want)
+			}
+			if !reflect.DeepEqual(stmt.Vars, tt.wantVars) {
+				t.Errorf("vars = %v, want %v", stmt.Vars, tt.wantVars)
+			}
+		})
+	}
+}
+
+func TestFindWithCursorQuery(t *testing.T) {
+	db := newDryRunDB(t)
+	orders := []OrderField{{"created_at", DESC}, {"id", DESC}}
+	columns, err := db.cursorColumns(&[]cursorRow{}, orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{columns[0].key(), columns[1].key()}
+	row := cursorRow{ID: "a", CreatedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)}
+	cursor, err := db.encodeCursor(keys, columns, reflect.ValueOf(row))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sql string
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []cursorRow
+	if _, err := db.FindWithCursor(nil, cursor, 20, &rows, orders...); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `SELECT * FROM "cursor_rows"` +
+		` WHERE ("cursor_rows"."created_at" < $1 OR ("cursor_rows"."created_at" = $2 AND "cursor_rows"."id" < $3))` +
+		` ORDER BY "cursor_rows"."created_at" DESC,"cursor_rows"."id" DESC LIMIT $4`
+	if sql != want {
+		t.Errorf("sql =\n%s\nwant\n%s", sql, want)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	db := newDryRunDB(t)
+	orders := []OrderField{{"created_at", DESC}, {"paid_at", ASC}, {"seq", DESC}, {"id", ASC}}
+	columns, err := db.cursorColumns(&[]cursorRow{}, orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, len(columns))
+	for i, c := range columns {
+		keys[i] = c.key()
+	}
+
+	// a zone other than UTC and nanoseconds must survive
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 123456789, jakarta)
+	paidAt := createdAt.Add(time.Minute)
+	row := cursorRow{ID: "trx_01HZX", Seq: 1 << 40, CreatedAt: createdAt, PaidAt: &paidAt}
+
+	cursor, err := db.encodeCursor(keys, columns, reflect.ValueOf(row))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(cursor, "trx_01HZX") {
+		t.Error("cursor is not encrypted")
+	}
+
+	values, err := db.decodeCursor(cursor, keys, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := values[0].(time.Time); !ok || !got.Equal(createdAt) {
+		t.Errorf("created_at = %#v, want time.Time %s", values[0], createdAt)
+	}
+	if got, ok := values[1].(*time.Time); !ok || got == nil || !got.Equal(paidAt) {
+		t.Errorf("paid_at = %#v, want *time.Time %s", values[1], paidAt)
+	}
+	if got, ok := values[2].(int64); !ok || got != row.Seq {
+		t.Errorf("seq = %#v, want int64 %d", values[2], row.Seq)
+	}
+	if got, ok := values[3].(string); !ok || got != row.ID {
+		t.Errorf("id = %#v, want string %s", values[3], row.ID)
+	}
+}
+
+func TestCursorRejectsAnotherOrder(t *testing.T) {
+	db := newDryRunDB(t)
+	resolve := func(orders ...OrderField) ([]string, []cursorColumn) {
+		columns, err := db.cursorColumns(&[]cursorRow{}, orders)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, len(columns))
+		for i, c := range columns {
+			keys[i] = c.key()
+		}
+		return keys, columns
+	}
+
+	keys, columns := resolve(OrderField{"created_at", DESC}, OrderField{"id", DESC})
+	row := cursorRow{ID: "a", CreatedAt: time.Now()}
+	cursor, err := db.encodeCursor(keys, columns, reflect.ValueOf(row))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		orders []OrderField
+	}{
+		{"other direction", []OrderField{{"created_at", ASC}, {"id", DESC}}},
+		{"other column", []OrderField{{"seq", DESC}, {"id", DESC}}},
+		{"fewer columns", []OrderField{{"created_at", DESC}}},
+		{"more columns", []OrderField{{"created_at", DESC}, {"id", DESC}, {"seq", ASC}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, columns := resolve(tt.orders...)
+			if _, err := db.decodeCursor(cursor, keys, columns); err == nil || !strings.Contains(err.Error(), "another order") {
+				t.Errorf("decode = %v, want a cursor for another order", err)
+			}
+		})
+	}
+
+	if _, err := db.decodeCursor("not-a-cursor", keys, columns); err == nil {
+		t.Error("decoding a forged cursor succeeded")
+	}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 type redisCacher struct {
-	rdb       *redis.Client
+	rdb       redis.UniversalClient
 	cacheTime time.Duration
 }
 
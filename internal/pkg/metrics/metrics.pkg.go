@@ -0,0 +1,342 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to a minute
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Default is the registry the New functions register to and Handler serves
+var Default = NewRegistry()
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metrics and writes them in the Prometheus text format
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register panics on a duplicate name, metrics are declared once at init
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic(fmt.Sprintf("metric %s registered twice", c.name()))
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes every metric, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, c := range collectors {
+		c.write(cw)
+	}
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.err
+}
+
+// Handler serves the registry for a Prometheus scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// Handler serves the Default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// family is the name, help and labels shared by the series of a metric
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+	mu         sync.Mutex
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s takes %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, escapeHelp(f.help), f.metricName, f.kind)
+}
+
+// labelPairs formats the labels of a series, extra is appended as is
+func (f *family) labelPairs(values []string, extra string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escapeLabel(value)))
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type valueSeries struct {
+	values []string
+	value  float64
+}
+
+// Counter only goes up, like messages handled
+type Counter struct {
+	family
+	series map[string]*valueSeries
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		family: family{metricName: name, help: help, kind: "counter", labels: labels},
+		series: make(map[string]*valueSeries),
+	}
+	Default.register(c)
+	return c
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.metricName))
+	}
+	addValue(&c.family, c.series, delta, values)
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeValues(w, &c.family, c.series)
+}
+
+// Gauge goes up and down, like messages in flight
+type Gauge struct {
+	family
+	series map[string]*valueSeries
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{
+		family: family{metricName: name, help: help, kind: "gauge", labels: labels},
+		series: make(map[string]*valueSeries),
+	}
+	Default.register(g)
+	return g
+}
+
+func (g *Gauge) Set(value float64, values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s, ok := g.series[key]
+	if !ok {
+		s = &valueSeries{values: append([]string(nil), values...)}
+		g.series[key] = s
+	}
+	s.value = value
+}
+
+func (g *Gauge) Add(delta float64, values ...string) {
+	addValue(&g.family, g.series, delta, values)
+}
+
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeValues(w, &g.family, g.series)
+}
+
+func addValue(f *family, series map[string]*valueSeries, delta float64, values []string) {
+	key := f.key(values)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := series[key]
+	if !ok {
+		s = &valueSeries{values: append([]string(nil), values...)}
+		series[key] = s
+	}
+	s.value += delta
+}
+
+func writeValues(w io.Writer, f *family, series map[string]*valueSeries) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.header(w)
+	for _, key := range sortedKeys(series) {
+		s := series[key]
+		fmt.Fprintf(w, "%s%s %s\n", f.metricName, f.labelPairs(s.values, ""), formatFloat(s.value))
+	}
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations into buckets, like handler latency
+type Histogram struct {
+	family
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+// NewHistogram uses DefaultBuckets when buckets is nil
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{
+		family:  family{metricName: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	Default.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+// ObserveSince observes the seconds passed since start
+func (h *Histogram) ObserveSince(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			le := fmt.Sprintf(`le="%s"`, formatFloat(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(s.values, le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(s.values, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelPairs(s.values, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelPairs(s.values, ""), s.count)
+	}
+}
+
+func sortedKeys[T any](series map[string]T) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape writes the collectors through a registry of their own
+func scrape(t *testing.T, collectors ...collector) string {
+	t.Helper()
+	r := NewRegistry()
+	for _, c := range collectors {
+		r.register(c)
+	}
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestCounterExposition(t *testing.T) {
+	c := NewCounter("test_counter_total", "Messages handled.", "queue")
+	c.Inc("orders")
+	c.Add(2.5, "orders")
+	c.Inc("emails")
+
+	want := `# HELP test_counter_total Messages handled.
+# TYPE test_counter_total counter
+test_counter_total{queue="emails"} 1
+test_counter_total{queue="orders"} 3.5
+`
+	if got := scrape(t, c); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeWithoutLabels(t *testing.T) {
+	g := NewGauge("test_gauge", "In flight.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	g.Add(0.5)
+
+	want := `# HELP test_gauge In flight.
+# TYPE test_gauge gauge
+test_gauge 1.5
+`
+	if got := scrape(t, g); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	g.Set(7)
+	if got := scrape(t, g); !strings.Contains(got, "test_gauge 7\n") {
+		t.Errorf("after Set(7) got\n%s", got)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	c := NewCounter("test_escaped_total", "Help with a \\ and a\nnew line.", "key")
+	c.Inc(`a "quoted" \ value` + "\nwith a new line")
+
+	want := `# HELP test_escaped_total Help with a \\ and a\nnew line.
+# TYPE test_escaped_total counter
+test_escaped_total{key="a \"quoted\" \\ value\nwith a new line"} 1
+`
+	if got := scrape(t, c); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	// buckets are sorted whatever the order given
+	h := NewHistogram("test_duration_seconds", "Handler latency.", []float64{1, 0.1, 0.5}, "outcome")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v, "ack")
+	}
+
+	// 0.1 falls in its own bucket, le is inclusive
+	want := `# HELP test_duration_seconds Handler latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{outcome="ack",le="0.1"} 2
+test_duration_seconds_bucket{outcome="ack",le="0.5"} 3
+test_duration_seconds_bucket{outcome="ack",le="1"} 4
+test_duration_seconds_bucket{outcome="ack",le="+Inf"} 5
+test_duration_seconds_sum{outcome="ack"} 3.15
+test_duration_seconds_count{outcome="ack"} 5
+`
+	if got := scrape(t, h); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	h := NewHistogram("test_size_bytes", "Body size.", []float64{10})
+	h.Observe(100)
+
+	want := `# HELP test_size_bytes Body size.
+# TYPE test_size_bytes histogram
+test_size_bytes_bucket{le="10"} 0
+test_size_bytes_bucket{le="+Inf"} 1
+test_size_bytes_sum 100
+test_size_bytes_count 1
+`
+	if got := scrape(t, h); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistrySortsByName(t *testing.T) {
+	b := NewGauge("test_sorted_b", "B.")
+	a := NewGauge("test_sorted_a", "A.")
+	a.Set(1)
+	b.Set(2)
+
+	got := scrape(t, b, a)
+	if strings.Index(got, "test_sorted_a") > strings.Index(got, "test_sorted_b") {
+		t.Errorf("metrics not sorted by name:\n%s", got)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	NewCounter("test_twice_total", "Once.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	NewCounter("test_twice_total", "Twice.")
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	c := NewCounter("test_labels_total", "Two labels.", "queue", "requeue")
+	defer func() {
+		if recover() == nil {
+			t.Error("a missing label value did not panic")
+		}
+	}()
+	c.Inc("orders")
+}
+
+func TestHandler(t *testing.T) {
+	c := NewCounter("test_handler_total", "Served.")
+	c.Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "test_handler_total 1\n") {
+		t.Errorf("body does not contain the counter:\n%s", rec.Body.String())
+	}
+}
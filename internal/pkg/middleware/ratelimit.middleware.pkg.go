@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	_type "go-boilerplate/internal/common/type"
+	"go-boilerplate/internal/pkg/helper"
+	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/redis"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RateLimitAlgorithm int
+
+const (
+	// SlidingWindow allows Limit requests in any Window long period
+	SlidingWindow RateLimitAlgorithm = iota
+	// TokenBucket allows bursts of Limit requests, refilled evenly over Window
+	TokenBucket
+)
+
+// RateLimitKey returns who a request is counted against, "" falls back to
+// the client IP
+type RateLimitKey func(c *gin.Context) string
+
+type RateLimitPolicy struct {
+	// Name separates the counters of policies sharing a key
+	Name      string
+	Limit     int
+	Window    time.Duration
+	Algorithm RateLimitAlgorithm
+	Key       RateLimitKey
+}
+
+// Both scripts read the clock of Redis so every instance agrees on it, and
+// return {allowed, remaining, milliseconds until reset}.
+var (
+	slidingWindowScript = redis.NewScript(`
+local now = redis.call("TIME")
+now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[3])
+	redis.call("PEXPIRE", KEYS[1], window)
+	local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+	return {1, limit - count - 1, tonumber(oldest[2]) + window - now}
+end
+
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+	tokenBucketScript = redis.NewScript(`
+local now = redis.call("TIME")
+now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local rate = limit / window
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or limit
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(limit, tokens + (now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], window)
+
+if allowed == 1 then
+	return {1, math.floor(tokens), math.ceil((limit - tokens) / rate)}
+end
+return {0, 0, math.ceil((1 - tokens) / rate)}
+`)
+)
+
+// RateLimitMiddleware rejects requests over the policy with a 429 and sets the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. Requests
+// pass when Redis is unreachable, an outage must not take the API down.
+func RateLimitMiddleware(rds redis.IRedis, policy *RateLimitPolicy) gin.HandlerFunc {
+	script := slidingWindowScript
+	if policy.Algorithm == TokenBucket {
+		script = tokenBucketScript
+	}
+	window := policy.Window.Milliseconds()
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(math.Ceil(policy.Window.Seconds())))
+
+	return func(c *gin.Context) {
+		send := c.MustGet("send").(func(r *_type.Response))
+
+		key := ""
+		if policy.Key != nil {
+			key = policy.Key(c)
+		}
+		if key == "" {
+			key = "ip:" + c.ClientIP()
+		}
+
+		result, err := rds.RunScript(c.Request.Context(), script,
+			[]string{"ratelimit:" + policy.Name + ":" + key}, policy.Limit, window, uuid.NewString())
+		if err != nil {
+			logger.Warning.Printf("Rate limit %s skipped: %v", policy.Name, err)
+			c.Next()
+			return
+		}
+
+		allowed, remaining, resetMs := parseRateLimit(result)
+		reset := strconv.FormatInt((resetMs+999)/1000, 10)
+		header := c.Writer.Header()
+		header.Set("RateLimit-Policy", policyHeader)
+		header.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		header.Set("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		header.Set("RateLimit-Reset", reset)
+
+		if !allowed {
+			header.Set("Retry-After", reset)
+			send(helper.ParseResponse(&_type.Response{
+				Code:    http.StatusTooManyRequests,
+				Message: "Too many requests, try again in " + reset + " seconds",
+			}))
+			return
+		}
+		c.Next()
+	}
+}
+
+func parseRateLimit(result interface{}) (allowed bool, remaining, resetMs int64) {
+	values, _ := result.([]interface{})
+	if len(values) != 3 {
+		return true, 0, 0
+	}
+	a, _ := values[0].(int64)
+	remaining, _ = values[1].(int64)
+	resetMs, _ = values[2].(int64)
+	return a == 1, remaining, resetMs
+}
+
+// KeyByIP counts requests per client IP. c.ClientIP() reads X-Forwarded-For
+// only from the proxies set with SetTrustedProxies (TRUSTED_PROXIES), any
+// client could spoof it otherwise.
+func KeyByIP() RateLimitKey {
+	return func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// KeyByAPIKey counts requests per value of the header
+func KeyByAPIKey(header string) RateLimitKey {
+	return func(c *gin.Context) string {
+		if value := c.GetHeader(header); value != "" {
+			return "key:" + value
+		}
+		return ""
+	}
+}
+
+// KeyByUser counts requests per user set by AuthMiddleware, which must run
+// first
+func KeyByUser() RateLimitKey {
+	return func(c *gin.Context) string {
+		if user, ok := c.Get("auth"); ok {
+			if auth, ok := user.(_type.UserWithAuth); ok {
+				return "user:" + auth.ID.String()
+			}
+		}
+		return ""
+	}
+}
+
+// KeyByJSONField counts requests per value of a field of the JSON body, path
+// is dot separated like "customer.phone". The body is restored for the handler.
+func KeyByJSONField(path string) RateLimitKey {
+	fields := strings.Split(path, ".")
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+
+		var value any
+		if err := json.Unmarshal(body, &value); err != nil {
+			return ""
+		}
+		for _, field := range fields {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return ""
+			}
+			value = object[field]
+		}
+
+		if s, ok := value.(string); ok && s != "" {
+			return path + ":" + s
+		}
+		return ""
+	}
+}
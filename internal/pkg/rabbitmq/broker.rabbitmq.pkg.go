@@ -0,0 +1,63 @@
+package rabbitmq
+
+import (
+	"context"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MessagePublisher publishes messages and makes RPC calls. Services depend on
+// it instead of *Publisher, so tests can hand them a MemoryBroker.
+type MessagePublisher interface {
+	Publish(msg *Message, opts *PublishOptions) (interface{}, error)
+	PublishWithContext(ctx context.Context, msg *Message, opts *PublishOptions) (*RPCResponse, error)
+	PublishBatch(ctx context.Context, msgs []*Message, opts *PublishOptions) ([]PublishResult, error)
+	Close() error
+}
+
+// MessageSubscriber is a running consumer of one queue
+type MessageSubscriber interface {
+	Start() error
+	Stop() error
+	IsHealthy() bool
+	GetRunningWorkers() int
+	GetWorkerCapacity() int
+}
+
+// Broker creates subscribers, *ConnectionManager subscribes on RabbitMQ and
+// MemoryBroker in process
+type Broker interface {
+	Subscribe(ctx context.Context, handler MessageHandler, opts *SubscribeOptions) (MessageSubscriber, error)
+}
+
+var (
+	_ MessagePublisher  = (*Publisher)(nil)
+	_ MessageSubscriber = (*Subscriber)(nil)
+	_ Broker            = (*ConnectionManager)(nil)
+)
+
+// Subscribe creates a subscriber of opts.QueueName, it consumes once started
+func (cm *ConnectionManager) Subscribe(ctx context.Context, handler MessageHandler, opts *SubscribeOptions) (MessageSubscriber, error) {
+	sub, err := NewSubscriber(ctx, cm, handler, opts)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// RetryDelay is the wait before retry attempt of a message failed on the
+// queue, for transports outside this package
+func (o *SubscribeOptions) RetryDelay(attempt int) time.Duration {
+	return retryDelay(o, attempt)
+}
+
+// MarkDead sets the dead letter headers Subscriber sets, headers may be nil
+func (o *SubscribeOptions) MarkDead(headers amqp.Table, err error) amqp.Table {
+	return markDead(headers, o, err)
+}
+
+// DeliveryCount is the number of times msg failed before, from x-retry-count
+func DeliveryCount(msg *amqp.Delivery) int {
+	return deliveryCount(msg)
+}
@@ -18,6 +18,7 @@ type ChannelManager struct {
 	closed        bool
 	maxRetries    int
 	retryInterval time.Duration
+	setupHooks    []func(ch *amqp.Channel) error
 	ctx           context.Context
 	cancel        context.CancelFunc
 }
@@ -49,6 +50,23 @@ func (cm *ChannelManager) GetChannel() (*amqp.Channel, error) {
 	return cm.setupChannelWithRetry()
 }
 
+// AddSetupHook runs hook on the current channel and on every channel opened
+// after a reconnect, e.g. to declare the exchanges the channel publishes to.
+// A hook failing on the current channel is not kept.
+func (cm *ChannelManager) AddSetupHook(hook func(ch *amqp.Channel) error) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.channel != nil {
+		if err := hook(cm.channel); err != nil {
+			return err
+		}
+	}
+
+	cm.setupHooks = append(cm.setupHooks, hook)
+	return nil
+}
+
 func (cm *ChannelManager) setupChannelWithRetry() (*amqp.Channel, error) {
 	var err error
 	for attempt := 0; attempt < cm.maxRetries; attempt++ {
@@ -84,6 +102,13 @@ func (cm *ChannelManager) setupChannel() (*amqp.Channel, error) {
 		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
 	}
 
+	for _, hook := range cm.setupHooks {
+		if err := hook(ch); err != nil {
+			ch.Close()
+			return nil, fmt.Errorf("failed to run channel setup hook: %w", err)
+		}
+	}
+
 	go cm.channelMonitor(ch)
 
 	return ch, nil
@@ -134,6 +159,7 @@ func (cm *ChannelManager) reconnect() {
 	if err != nil {
 		logger.Error.Printf("Failed to reconnect channel: %v\n", err)
 	} else {
+		channelReconnectsTotal.Inc()
 		logger.Info.Println("Successfully reconnected and established a new channel")
 	}
 }
@@ -0,0 +1,338 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// returnBuffer is the size of the return buffer of a channel and the
+	// number of returns kept for take
+	returnBuffer = 1024
+	// returnTTL is how long a return nobody took is kept
+	returnTTL = 5 * time.Minute
+)
+
+var (
+	// ErrNacked is returned when the broker refused a message
+	ErrNacked = errors.New("message nacked by broker")
+	// ErrUnroutable is returned when a mandatory message matched no queue
+	ErrUnroutable = errors.New("message returned as unroutable")
+)
+
+// PublishResult is the outcome of one message of PublishBatch
+type PublishResult struct {
+	MessageID string
+	Acked     bool
+	Attempts  int
+	Err       error
+}
+
+// returnTracker collects the basic.return of mandatory messages by MessageId.
+// The broker sends the return before the ack of the same message and the
+// client buffers it before handling the ack, so after a confirm the return,
+// if any, is in the buffer or already collected. A goroutine per channel
+// empties the buffer so the connection reader never blocks on it, and returns
+// nobody takes, e.g. of a dead letter publish, expire after returnTTL.
+type returnTracker struct {
+	mu       sync.Mutex
+	watcher  *returnWatcher
+	returned map[string]returnedMessage
+}
+
+type returnedMessage struct {
+	amqp.Return
+	at time.Time
+}
+
+// returnWatcher reads the returns of one channel
+type returnWatcher struct {
+	returns chan amqp.Return
+	flushes chan chan struct{}
+	stopped chan struct{}
+}
+
+func newReturnTracker() *returnTracker {
+	return &returnTracker{returned: make(map[string]returnedMessage)}
+}
+
+// watch is a channel setup hook, every new channel gets its own listener
+func (t *returnTracker) watch(ch *amqp.Channel) error {
+	w := &returnWatcher{
+		returns: ch.NotifyReturn(make(chan amqp.Return, returnBuffer)),
+		flushes: make(chan chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	t.mu.Lock()
+	t.watcher = w
+	t.mu.Unlock()
+
+	go t.collect(w)
+	return nil
+}
+
+// collect stores the returns of w until its channel is closed
+func (t *returnTracker) collect(w *returnWatcher) {
+	defer close(w.stopped)
+	for {
+		select {
+		case r, ok := <-w.returns:
+			if !ok {
+				return
+			}
+			t.add(r)
+		case done := <-w.flushes:
+			// returns buffered before the flush are stored before it answers
+			for flushed := false; !flushed; {
+				select {
+				case r, ok := <-w.returns:
+					if !ok {
+						close(done)
+						return
+					}
+					t.add(r)
+				default:
+					flushed = true
+				}
+			}
+			close(done)
+		}
+	}
+}
+
+// flush waits until the returns buffered so far are collected
+func (w *returnWatcher) flush() {
+	done := make(chan struct{})
+	select {
+	case w.flushes <- done:
+		<-done
+	case <-w.stopped:
+	}
+}
+
+func (t *returnTracker) add(r amqp.Return) {
+	if r.MessageId == "" {
+		logger.Warning.Printf("Unroutable message without message id returned by %s/%s: %s", r.Exchange, r.RoutingKey, r.ReplyText)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if len(t.returned) >= returnBuffer {
+		t.expire(now)
+	}
+	t.returned[r.MessageId] = returnedMessage{Return: r, at: now}
+}
+
+// expire drops the returns older than returnTTL, and the oldest ones while
+// more than returnBuffer are left. Caller holds t.mu.
+func (t *returnTracker) expire(now time.Time) {
+	for id, r := range t.returned {
+		if now.Sub(r.at) > returnTTL {
+			delete(t.returned, id)
+		}
+	}
+	for len(t.returned) >= returnBuffer {
+		var oldest string
+		for id, r := range t.returned {
+			if oldest == "" || r.at.Before(t.returned[oldest].at) {
+				oldest = id
+			}
+		}
+		delete(t.returned, oldest)
+	}
+}
+
+// take reports whether the message was returned, call it after its confirm
+func (t *returnTracker) take(messageID string) (amqp.Return, bool) {
+	t.mu.Lock()
+	w := t.watcher
+	t.mu.Unlock()
+
+	if w != nil {
+		w.flush()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.returned[messageID]
+	delete(t.returned, messageID)
+	return r.Return, ok
+}
+
+// publishDeferred publishes without waiting, the confirmation is nil when the
+// channel is not in confirm mode
+func (p *Publisher) publishDeferred(ctx context.Context, opts *PublishOptions, payload *amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	ch, err := p.channelManager.GetChannel()
+	if err != nil || ch == nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		opts.Exchange,
+		opts.routingKey(),
+		opts.Mandatory,
+		opts.Immediate,
+		*payload,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	return confirm, nil
+}
+
+// waitConfirm waits for the broker to confirm the message and checks whether
+// a mandatory message was returned
+func (p *Publisher) waitConfirm(ctx context.Context, opts *PublishOptions, messageID string, confirm *amqp.DeferredConfirmation) error {
+	if confirm == nil {
+		return nil
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publish confirm: %w", err)
+	}
+
+	if opts.Mandatory {
+		if r, ok := p.returns.take(messageID); ok {
+			return fmt.Errorf("%w: %d %s", ErrUnroutable, r.ReplyCode, r.ReplyText)
+		}
+	}
+
+	if !acked {
+		return ErrNacked
+	}
+
+	return nil
+}
+
+// PublishBatch pipelines the messages in chunks of opts.BatchSize, waits up to
+// opts.Timeout for the confirms of each chunk and republishes the nacked or
+// unconfirmed ones up to opts.MaxRetries times. Unroutable messages are not
+// retried. Results are in the order of msgs, the error is set when any
+// message was not delivered.
+func (p *Publisher) PublishBatch(ctx context.Context, msgs []*Message, opts *PublishOptions) ([]PublishResult, error) {
+	if opts.IsRPC {
+		return nil, errors.New("batch publishing does not support RPC")
+	}
+
+	// defaults are filled in on a copy, the caller may reuse opts
+	copied := *opts
+	opts = &copied
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = p.maxRetries
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = p.retryInterval
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Minute
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 || batchSize > returnBuffer {
+		batchSize = returnBuffer
+	}
+
+	results := make([]PublishResult, len(msgs))
+	payloads := make([]*amqp.Publishing, len(msgs))
+	for i, msg := range msgs {
+		// Generated once, so a republished message keeps its MessageId
+		payloads[i] = msg.GeneratePayload()
+		payloads[i].Type = opts.Pattern
+		results[i].MessageID = msg.ID
+	}
+
+	for start := 0; start < len(msgs); start += batchSize {
+		end := min(start+batchSize, len(msgs))
+
+		pending := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			pending = append(pending, i)
+		}
+
+		for attempt := 0; attempt <= opts.MaxRetries && len(pending) > 0; attempt++ {
+			if attempt > 0 {
+				if err := p.waitForRetry(ctx, opts, attempt); err != nil {
+					return results, err
+				}
+				logger.Warning.Printf("Republishing %d unconfirmed messages (attempt %d)\n", len(pending), attempt)
+			}
+			pending = p.publishChunk(ctx, opts, payloads, results, pending)
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Acked {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d messages were not confirmed", failed, len(msgs))
+	}
+
+	return results, nil
+}
+
+// publishChunk publishes the pending messages and returns the ones to retry
+func (p *Publisher) publishChunk(ctx context.Context, opts *PublishOptions, payloads []*amqp.Publishing, results []PublishResult, pending []int) []int {
+	if opts.QueueName != "" && opts.Exchange == "" {
+		if _, err := p.declareQueue(opts.QueueName, opts.QueueOpts); err != nil {
+			for _, i := range pending {
+				results[i].Attempts++
+				results[i].Err = err
+			}
+			return pending
+		}
+	}
+
+	confirms := make(map[int]*amqp.DeferredConfirmation, len(pending))
+	var retry []int
+	start := time.Now()
+
+	for _, i := range pending {
+		results[i].Attempts++
+		confirm, err := p.publishDeferred(ctx, opts, payloads[i])
+		if err != nil {
+			observePublish(opts, start, err)
+			results[i].Err = err
+			retry = append(retry, i)
+			continue
+		}
+		confirms[i] = confirm
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	for _, i := range pending {
+		confirm, ok := confirms[i]
+		if !ok {
+			continue
+		}
+
+		err := p.waitConfirm(waitCtx, opts, payloads[i].MessageId, confirm)
+		observePublish(opts, start, err)
+		results[i].Err = err
+		results[i].Acked = err == nil
+
+		if err != nil && !errors.Is(err, ErrUnroutable) {
+			retry = append(retry, i)
+		}
+	}
+
+	return retry
+}
@@ -0,0 +1,90 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// startWatcher collects returns like watch does for a real channel
+func startWatcher(t *returnTracker) *returnWatcher {
+	w := &returnWatcher{
+		returns: make(chan amqp.Return, returnBuffer),
+		flushes: make(chan chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	t.watcher = w
+	go t.collect(w)
+	return w
+}
+
+func TestReturnTrackerTakesBufferedReturn(t *testing.T) {
+	tracker := newReturnTracker()
+	w := startWatcher(tracker)
+	defer close(w.returns)
+
+	for i := 0; i < 100; i++ {
+		w.returns <- amqp.Return{MessageId: fmt.Sprintf("msg_%d", i), ReplyCode: 312}
+	}
+
+	// every return sent before take is seen by it
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("msg_%d", i)
+		if r, ok := tracker.take(id); !ok || r.ReplyCode != 312 {
+			t.Fatalf("take(%s) = %v, %v", id, r, ok)
+		}
+	}
+	if _, ok := tracker.take("msg_0"); ok {
+		t.Error("a return was taken twice")
+	}
+}
+
+func TestReturnTrackerDoesNotBlockChannel(t *testing.T) {
+	tracker := newReturnTracker()
+	w := startWatcher(tracker)
+
+	// nobody takes these, the buffer must keep emptying
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 3*returnBuffer; i++ {
+			w.returns <- amqp.Return{MessageId: fmt.Sprintf("msg_%d", i)}
+		}
+		close(w.returns)
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("returns blocked the channel")
+	}
+	<-w.stopped
+
+	if n := len(tracker.returned); n > returnBuffer {
+		t.Errorf("%d returns kept, want at most %d", n, returnBuffer)
+	}
+	if _, ok := tracker.take(fmt.Sprintf("msg_%d", 3*returnBuffer-1)); !ok {
+		t.Error("the newest return was dropped")
+	}
+	if _, ok := tracker.take("msg_0"); ok {
+		t.Error("the oldest return was kept")
+	}
+}
+
+func TestReturnTrackerExpiresOldReturns(t *testing.T) {
+	tracker := newReturnTracker()
+	now := time.Now()
+	tracker.returned["old"] = returnedMessage{at: now.Add(-returnTTL - time.Second)}
+	tracker.returned["new"] = returnedMessage{at: now}
+
+	tracker.expire(now)
+
+	if _, ok := tracker.returned["old"]; ok {
+		t.Error("an expired return was kept")
+	}
+	if _, ok := tracker.returned["new"]; !ok {
+		t.Error("a recent return was dropped")
+	}
+}
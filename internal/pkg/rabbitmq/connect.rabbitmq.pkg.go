@@ -12,6 +12,7 @@ import (
 
 type ConnectionManager struct {
 	conn          *amqp.Connection
+	checkedQueues sync.Map
 	mu            sync.Mutex
 	url           string
 	isConnected   bool
@@ -21,11 +22,19 @@ type ConnectionManager struct {
 }
 
 type QueueConfig struct {
-	Durable    bool
-	AutoDelete bool
-	Exclusive  bool
-	NoWait     bool
-	Args       amqp.Table
+	Durable        bool
+	AutoDelete     bool
+	Exclusive      bool
+	NoWait         bool
+	Args           amqp.Table
+	Type           QueueType      // Classic by default, quorum replicates the queue across nodes
+	MaxPriority    uint8          // x-max-priority, 0 disables priorities
+	MessageTTL     time.Duration  // x-message-ttl, 0 keeps messages until consumed
+	MaxLength      int            // x-max-length in messages, 0 is unbounded
+	MaxLengthBytes int            // x-max-length-bytes, 0 is unbounded
+	Overflow       OverflowPolicy // What happens to publishes over the max length
+	Lazy           bool           // x-queue-mode=lazy, keeps messages on disk (classic only)
+	DeliveryLimit  int            // x-delivery-limit, redeliveries before a quorum queue drops or dead-letters
 }
 
 func DefaultQueueConfig() *QueueConfig {
@@ -127,6 +136,7 @@ func (cm *ConnectionManager) connectionMonitor() {
 						continue
 					}
 
+					connectionReconnectsTotal.Inc()
 					logger.Info.Println("Reconnected successfully")
 					return // Exit monitor, new goroutine will be started by connect()
 				}
@@ -0,0 +1,277 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// deadLetterHeaders are set by the subscriber when a message is dead-lettered
+var deadLetterHeaders = []string{"x-retry-count", "x-death-reason", "x-death-time", "x-death-queue", "x-death-max-retries"}
+
+// DeadLetterQueueName is the exchange and queue failed messages of queue go to
+func DeadLetterQueueName(queue string) string {
+	return "fail:" + queue
+}
+
+// markDead sets the dead letter headers of a message that failed on the
+// queue of opts, headers may be nil
+func markDead(headers amqp.Table, opts *SubscribeOptions, err error) amqp.Table {
+	if headers == nil {
+		headers = make(amqp.Table)
+	}
+	headers["x-death-reason"] = err.Error()
+	headers["x-death-time"] = time.Now().Format(time.RFC3339)
+	headers["x-death-queue"] = opts.QueueName
+	headers["x-death-max-retries"] = opts.MaxRetryAttempts
+	return headers
+}
+
+// DeadLetter is a message read from a dead letter queue
+type DeadLetter struct {
+	MessageID   string
+	Queue       string // Queue the message failed on
+	Reason      string
+	Retries     int
+	DiedAt      time.Time
+	Timestamp   time.Time
+	ContentType string
+	Headers     amqp.Table
+	Body        []byte
+}
+
+// Age is the time since the message was dead-lettered
+func (d *DeadLetter) Age() time.Duration {
+	if !d.DiedAt.IsZero() {
+		return time.Since(d.DiedAt)
+	}
+	if !d.Timestamp.IsZero() {
+		return time.Since(d.Timestamp)
+	}
+	return 0
+}
+
+func newDeadLetter(msg *amqp.Delivery, source string) *DeadLetter {
+	letter := &DeadLetter{
+		MessageID:   msg.MessageId,
+		Queue:       source,
+		Timestamp:   msg.Timestamp,
+		ContentType: msg.ContentType,
+		Headers:     msg.Headers,
+		Body:        msg.Body,
+	}
+
+	if letter.MessageID == "" {
+		letter.MessageID, _ = msg.Headers["id"].(string)
+	}
+	if queue, ok := msg.Headers["x-death-queue"].(string); ok && queue != "" {
+		letter.Queue = queue
+	}
+	letter.Reason, _ = msg.Headers["x-death-reason"].(string)
+	if diedAt, ok := msg.Headers["x-death-time"].(string); ok {
+		letter.DiedAt, _ = time.Parse(time.RFC3339, diedAt)
+	}
+	switch v := msg.Headers["x-retry-count"].(type) {
+	case int32:
+		letter.Retries = int(v)
+	case int64:
+		letter.Retries = int(v)
+	case int:
+		letter.Retries = v
+	}
+
+	return letter
+}
+
+// DeadLetterQueue reads and replays the dead letter queue of a work queue.
+// Reading holds the messages unacked and requeues them afterwards, so the
+// queue is left as it was.
+type DeadLetterQueue struct {
+	ch     *amqp.Channel
+	Name   string
+	Source string
+}
+
+func OpenDeadLetterQueue(connManager *ConnectionManager, source string) (*DeadLetterQueue, error) {
+	conn := connManager.GetConnection()
+	if conn == nil {
+		return nil, fmt.Errorf("no connection available")
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	q := &DeadLetterQueue{ch: ch, Name: DeadLetterQueueName(source), Source: source}
+	if _, err := q.Count(); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Count returns the number of ready messages
+func (q *DeadLetterQueue) Count() (int, error) {
+	info, err := q.ch.QueueDeclarePassive(q.Name, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("dead letter queue %s not found: %w", q.Name, err)
+	}
+	return info.Messages, nil
+}
+
+// Peek returns up to limit messages from the head of the queue without
+// removing them, limit <= 0 reads the whole queue
+func (q *DeadLetterQueue) Peek(limit int) ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+	var lastTag uint64
+
+	for limit <= 0 || len(letters) < limit {
+		msg, ok, err := q.ch.Get(q.Name, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", q.Name, err)
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, newDeadLetter(&msg, q.Source))
+		lastTag = msg.DeliveryTag
+	}
+
+	if lastTag > 0 {
+		if err := q.ch.Nack(lastTag, true, true); err != nil {
+			return nil, fmt.Errorf("failed to requeue peeked messages: %w", err)
+		}
+	}
+
+	return letters, nil
+}
+
+// Replay publishes the messages matching match back to the queue they failed
+// on with a fresh retry count and removes them from the dead letter queue.
+// replayed is called after each message is confirmed by the broker. Only the
+// messages in the queue when Replay starts are considered.
+func (q *DeadLetterQueue) Replay(ctx context.Context, match func(*DeadLetter) bool, replayed func(*DeadLetter)) (int, error) {
+	count, err := q.Count()
+	if err != nil {
+		return 0, err
+	}
+
+	// Publishing to a missing queue would silently drop the message
+	checked := make(map[string]bool)
+
+	var held []uint64
+	defer func() {
+		for _, tag := range held {
+			_ = q.ch.Nack(tag, false, true)
+		}
+	}()
+
+	done := 0
+	for i := 0; i < count; i++ {
+		msg, ok, err := q.ch.Get(q.Name, false)
+		if err != nil {
+			return done, fmt.Errorf("failed to read %s: %w", q.Name, err)
+		}
+		if !ok {
+			break
+		}
+
+		letter := newDeadLetter(&msg, q.Source)
+		if !match(letter) {
+			held = append(held, msg.DeliveryTag)
+			continue
+		}
+
+		if !checked[letter.Queue] {
+			if _, err := q.ch.QueueDeclarePassive(letter.Queue, true, false, false, false, nil); err != nil {
+				// The channel is closed by the broker, which requeues the held messages
+				held = nil
+				return done, fmt.Errorf("source queue %s not found: %w", letter.Queue, err)
+			}
+			checked[letter.Queue] = true
+		}
+
+		if err := q.republish(ctx, letter, &msg); err != nil {
+			held = append(held, msg.DeliveryTag)
+			return done, fmt.Errorf("failed to replay %s: %w", letter.MessageID, err)
+		}
+
+		if err := q.ch.Ack(msg.DeliveryTag, false); err != nil {
+			return done, fmt.Errorf("failed to remove replayed %s: %w", letter.MessageID, err)
+		}
+
+		done++
+		if replayed != nil {
+			replayed(letter)
+		}
+	}
+
+	return done, nil
+}
+
+func (q *DeadLetterQueue) republish(ctx context.Context, letter *DeadLetter, msg *amqp.Delivery) error {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	for _, key := range deadLetterHeaders {
+		delete(headers, key)
+	}
+	headers["x-replayed-at"] = time.Now().Format(time.RFC3339)
+
+	confirm, err := q.ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",
+		letter.Queue,
+		false,
+		false,
+		amqp.Publishing{
+			Headers:         headers,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    amqp.Persistent,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			AppId:           msg.AppId,
+			Body:            msg.Body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNacked
+	}
+
+	return nil
+}
+
+// Purge deletes every ready message and returns how many were removed
+func (q *DeadLetterQueue) Purge() (int, error) {
+	count, err := q.ch.QueuePurge(q.Name, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s: %w", q.Name, err)
+	}
+	return count, nil
+}
+
+func (q *DeadLetterQueue) Close() error {
+	return q.ch.Close()
+}
@@ -0,0 +1,952 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrBrokerClosed is returned by a MemoryBroker after Close
+var ErrBrokerClosed = errors.New("broker closed")
+
+// memoryIdlePoll is how often WaitIdle checks the broker
+const memoryIdlePoll = 10 * time.Millisecond
+
+// MemoryBroker is an in-process broker with the semantics of Publisher and
+// Subscriber: acks and requeues, redelivery counts, delayed retries, dead
+// letters, exchanges and RPC replies. Nothing leaves the process, services and
+// handlers can be tested without a RabbitMQ server:
+//
+//	broker := rabbitmq.NewMemoryBroker()
+//	service := paymentService.NewService(ctx, redisClient, rp, mt, wa, broker, baseURL, template)
+//	_ = registry.Start(ctx, broker)
+//	_ = broker.WaitIdle(ctx)
+type MemoryBroker struct {
+	mu        sync.Mutex
+	queues    map[string]*memoryQueue
+	exchanges map[string]ExchangeKind
+	bindings  []memoryBinding
+	unacked   map[uint64]*memoryDelivery
+	calls     map[string]chan amqp.Publishing
+	timers    map[*time.Timer]struct{}
+	tag       uint64
+	inFlight  int
+	closed    bool
+}
+
+type memoryQueue struct {
+	name      string
+	messages  []memoryMessage
+	ready     chan struct{}
+	consumers int
+	config    *QueueConfig // Nil until declared with settings
+}
+
+type memoryMessage struct {
+	publishing  amqp.Publishing
+	exchange    string
+	routingKey  string
+	redelivered bool
+	expiresAt   time.Time
+}
+
+// memoryDelivery is a message handed to a consumer and not acked yet
+type memoryDelivery struct {
+	queue *memoryQueue
+	msg   memoryMessage
+	owner *memorySubscriber
+}
+
+// memoryBinding routes Source to a queue, or to the exchange Destination
+type memoryBinding struct {
+	source      string
+	queue       string
+	destination string
+	routingKey  string
+	args        amqp.Table
+}
+
+var (
+	_ MessagePublisher  = (*MemoryBroker)(nil)
+	_ Broker            = (*MemoryBroker)(nil)
+	_ amqp.Acknowledger = (*MemoryBroker)(nil)
+)
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues:    make(map[string]*memoryQueue),
+		exchanges: make(map[string]ExchangeKind),
+		unacked:   make(map[uint64]*memoryDelivery),
+		calls:     make(map[string]chan amqp.Publishing),
+		timers:    make(map[*time.Timer]struct{}),
+	}
+}
+
+// DeclareTopology declares the exchanges and bindings of topology
+func (b *MemoryBroker) DeclareTopology(topology *Topology) error {
+	return b.declareTopology(topology, "")
+}
+
+func (b *MemoryBroker) declareTopology(t *Topology, defaultQueue string) error {
+	if t == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ex := range t.Exchanges {
+		kind := ex.Kind
+		if kind == "" {
+			kind = DirectExchange
+		}
+		if declared, ok := b.exchanges[ex.Name]; ok && declared != kind {
+			return fmt.Errorf("failed to declare exchange %s: declared as %s, not %s", ex.Name, declared, kind)
+		}
+		b.exchanges[ex.Name] = kind
+	}
+
+	for _, eb := range t.ExchangeBindings {
+		if err := b.checkExchange(eb.Source, eb.Destination); err != nil {
+			return fmt.Errorf("failed to bind exchange %s to %s: %w", eb.Destination, eb.Source, err)
+		}
+		b.bind(memoryBinding{source: eb.Source, destination: eb.Destination, routingKey: eb.RoutingKey, args: eb.Args})
+	}
+
+	for _, qb := range t.QueueBindings {
+		queue := qb.Queue
+		if queue == "" {
+			queue = defaultQueue
+		}
+		if queue == "" {
+			return fmt.Errorf("queue binding on exchange %s has no queue", qb.Exchange)
+		}
+		if err := b.checkExchange(qb.Exchange); err != nil {
+			return fmt.Errorf("failed to bind queue %s to %s: %w", queue, qb.Exchange, err)
+		}
+		b.declareQueue(queue)
+		b.bind(memoryBinding{source: qb.Exchange, queue: queue, routingKey: qb.RoutingKey, args: qb.Args})
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) checkExchange(names ...string) error {
+	for _, name := range names {
+		if _, ok := b.exchanges[name]; !ok {
+			return fmt.Errorf("exchange %s not found", name)
+		}
+	}
+	return nil
+}
+
+// bind adds binding unless it exists, binding twice is a no-op like on RabbitMQ
+func (b *MemoryBroker) bind(binding memoryBinding) {
+	for _, existing := range b.bindings {
+		if existing.source == binding.source && existing.queue == binding.queue &&
+			existing.destination == binding.destination && existing.routingKey == binding.routingKey {
+			return
+		}
+	}
+	b.bindings = append(b.bindings, binding)
+}
+
+// declareQueue returns the queue, declaring it if needed. Caller holds b.mu.
+func (b *MemoryBroker) declareQueue(name string) *memoryQueue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{name: name, ready: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+// declareQueueConfig declares the queue with config, like RabbitMQ a queue
+// that exists with other settings fails with ErrQueueMismatch. Caller holds b.mu.
+func (b *MemoryBroker) declareQueueConfig(name string, config *QueueConfig) (*memoryQueue, error) {
+	if config == nil {
+		config = DefaultQueueConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid settings for queue %s: %w", name, err)
+	}
+
+	q := b.declareQueue(name)
+	if q.config == nil {
+		q.config = config
+		return q, nil
+	}
+
+	declared := fmt.Sprintf("%t|%t|%v", q.config.Durable, q.config.AutoDelete, q.config.arguments())
+	requested := fmt.Sprintf("%t|%t|%v", config.Durable, config.AutoDelete, config.arguments())
+	if declared != requested {
+		return nil, fmt.Errorf("%w: %s: declared as %s, not %s", ErrQueueMismatch, name, declared, requested)
+	}
+	return q, nil
+}
+
+// route returns the queues a message published to exchange with routingKey
+// reaches. Caller holds b.mu.
+func (b *MemoryBroker) route(exchange, routingKey string, headers amqp.Table) []*memoryQueue {
+	if exchange == "" {
+		if q, ok := b.queues[routingKey]; ok {
+			return []*memoryQueue{q}
+		}
+		return nil
+	}
+
+	var queues []*memoryQueue
+	seen := make(map[string]bool)
+	visited := map[string]bool{exchange: true}
+	pending := []string{exchange}
+
+	for len(pending) > 0 {
+		source := pending[0]
+		pending = pending[1:]
+		kind := b.exchanges[source]
+
+		for _, binding := range b.bindings {
+			if binding.source != source || !bindingMatches(kind, binding, routingKey, headers) {
+				continue
+			}
+			if binding.destination != "" {
+				if !visited[binding.destination] {
+					visited[binding.destination] = true
+					pending = append(pending, binding.destination)
+				}
+				continue
+			}
+			if q, ok := b.queues[binding.queue]; ok && !seen[q.name] {
+				seen[q.name] = true
+				queues = append(queues, q)
+			}
+		}
+	}
+
+	return queues
+}
+
+func bindingMatches(kind ExchangeKind, binding memoryBinding, routingKey string, headers amqp.Table) bool {
+	switch kind {
+	case FanoutExchange:
+		return true
+	case TopicExchange:
+		return topicMatches(strings.Split(binding.routingKey, "."), strings.Split(routingKey, "."))
+	case HeadersExchange:
+		return headersMatch(binding.args, headers)
+	default:
+		return binding.routingKey == routingKey
+	}
+}
+
+// topicMatches matches routing key words against a binding pattern, where *
+// is exactly one word and # is zero or more
+func topicMatches(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	if pattern[0] == "#" {
+		for i := 0; i <= len(words); i++ {
+			if topicMatches(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(words) == 0 {
+		return false
+	}
+	if pattern[0] != "*" && pattern[0] != words[0] {
+		return false
+	}
+	return topicMatches(pattern[1:], words[1:])
+}
+
+// headersMatch applies the x-match (all by default, or any) of a headers binding
+func headersMatch(args, headers amqp.Table) bool {
+	matchAny := args["x-match"] == "any"
+	for key, want := range args {
+		if strings.HasPrefix(key, "x-") {
+			continue
+		}
+		got, ok := headers[key]
+		matched := ok && fmt.Sprint(got) == fmt.Sprint(want)
+		if matchAny && matched {
+			return true
+		}
+		if !matchAny && !matched {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+// publish routes payload to its queues, or to the waiting RPC call for a reply
+func (b *MemoryBroker) publish(exchange, routingKey string, mandatory bool, payload amqp.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+
+	if exchange == "" && routingKey == DirectReplyTo {
+		call, ok := b.calls[payload.CorrelationId]
+		if !ok {
+			logger.Warning.Printf("Dropping RPC reply %s, the call already returned", payload.CorrelationId)
+			return nil
+		}
+		delete(b.calls, payload.CorrelationId)
+		call <- payload
+		return nil
+	}
+
+	if exchange != "" {
+		if err := b.checkExchange(exchange); err != nil {
+			return fmt.Errorf("failed to publish: %w", err)
+		}
+	}
+
+	queues := b.route(exchange, routingKey, payload.Headers)
+	if len(queues) == 0 {
+		if mandatory {
+			return fmt.Errorf("%w: %s/%s", ErrUnroutable, exchange, routingKey)
+		}
+		return nil
+	}
+
+	for _, q := range queues {
+		msg := memoryMessage{exchange: exchange, routingKey: routingKey, publishing: payload}
+		msg.publishing.Headers = cloneTable(payload.Headers)
+		msg.expiresAt = q.expiresAt(payload.Expiration)
+		b.enqueue(q, msg, false)
+	}
+	return nil
+}
+
+// expiresAt is when a message published now with expiration is dropped, the
+// shorter of the per-message and the queue TTL
+func (q *memoryQueue) expiresAt(expiration string) time.Time {
+	ttl, expires := time.Duration(0), false
+	if q.config != nil && q.config.MessageTTL > 0 {
+		ttl, expires = q.config.MessageTTL, true
+	}
+	if ms, err := strconv.ParseInt(expiration, 10, 64); err == nil {
+		if perMessage := time.Duration(ms) * time.Millisecond; !expires || perMessage < ttl {
+			ttl, expires = perMessage, true
+		}
+	}
+	if !expires {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// enqueue adds msg to q, a requeued message goes first. On a priority queue a
+// message goes behind the ones of equal or higher priority. Caller holds b.mu.
+func (b *MemoryBroker) enqueue(q *memoryQueue, msg memoryMessage, front bool) {
+	switch {
+	case front:
+		q.messages = append([]memoryMessage{msg}, q.messages...)
+	case q.config != nil && q.config.MaxPriority > 0:
+		priority := min(msg.publishing.Priority, q.config.MaxPriority)
+		i := len(q.messages)
+		for i > 0 && min(q.messages[i-1].publishing.Priority, q.config.MaxPriority) < priority {
+			i--
+		}
+		q.messages = append(q.messages, memoryMessage{})
+		copy(q.messages[i+1:], q.messages[i:])
+		q.messages[i] = msg
+	default:
+		q.messages = append(q.messages, msg)
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// publishAfter publishes payload to queue once delay passed, like a message
+// waiting in a retry queue
+func (b *MemoryBroker) publishAfter(delay time.Duration, queue string, payload amqp.Publishing) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		// Published before the timer is forgotten, so WaitIdle sees one of them
+		if err := b.publish("", queue, false, payload); err != nil {
+			logger.Warning.Printf("Failed to return delayed message %s to %s: %v", payload.MessageId, queue, err)
+		}
+
+		b.mu.Lock()
+		delete(b.timers, timer)
+		b.mu.Unlock()
+	})
+	b.timers[timer] = struct{}{}
+}
+
+// deliver takes the next message of q and hands it to owner
+func (b *MemoryBroker) deliver(q *memoryQueue, owner *memorySubscriber) (*amqp.Delivery, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for len(q.messages) > 0 && !q.messages[0].expiresAt.IsZero() && now.After(q.messages[0].expiresAt) {
+		q.messages = q.messages[1:]
+	}
+	if len(q.messages) == 0 {
+		return nil, false
+	}
+	msg := q.messages[0]
+	q.messages = q.messages[1:]
+	if len(q.messages) > 0 {
+		// Wake the next worker too
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+	}
+
+	b.tag++
+	b.inFlight++
+	if !owner.opts.AutoAck {
+		b.unacked[b.tag] = &memoryDelivery{queue: q, msg: msg, owner: owner}
+	}
+
+	p := msg.publishing
+	return &amqp.Delivery{
+		Acknowledger:    b,
+		Headers:         cloneTable(p.Headers),
+		ContentType:     p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		DeliveryMode:    p.DeliveryMode,
+		Priority:        p.Priority,
+		CorrelationId:   p.CorrelationId,
+		ReplyTo:         p.ReplyTo,
+		Expiration:      p.Expiration,
+		MessageId:       p.MessageId,
+		Timestamp:       p.Timestamp,
+		Type:            p.Type,
+		UserId:          p.UserId,
+		AppId:           p.AppId,
+		ConsumerTag:     owner.opts.ConsumerName,
+		DeliveryTag:     b.tag,
+		Redelivered:     msg.redelivered,
+		Exchange:        msg.exchange,
+		RoutingKey:      msg.routingKey,
+		Body:            p.Body,
+	}, true
+}
+
+// processed marks a delivered message as handled
+func (b *MemoryBroker) processed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.inFlight--
+}
+
+// settle removes the unacked deliveries tag stands for, with multiple every
+// earlier one of the same consumer too
+func (b *MemoryBroker) settle(tag uint64, multiple bool) ([]*memoryDelivery, error) {
+	d, ok := b.unacked[tag]
+	if !ok {
+		return nil, fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	delete(b.unacked, tag)
+
+	settled := []*memoryDelivery{d}
+	if multiple {
+		for t, other := range b.unacked {
+			if t < tag && other.owner == d.owner {
+				delete(b.unacked, t)
+				settled = append(settled, other)
+			}
+		}
+	}
+	return settled, nil
+}
+
+func (b *MemoryBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, err := b.settle(tag, multiple)
+	return err
+}
+
+func (b *MemoryBroker) Nack(tag uint64, multiple bool, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	settled, err := b.settle(tag, multiple)
+	if err != nil {
+		return err
+	}
+	if requeue {
+		for _, d := range settled {
+			d.msg.redelivered = true
+			b.enqueue(d.queue, d.msg, true)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Reject(tag uint64, requeue bool) error {
+	return b.Nack(tag, false, requeue)
+}
+
+// requeueUnacked returns the unacked messages of owner to their queues, as
+// RabbitMQ does when a consumer's channel closes
+func (b *MemoryBroker) requeueUnacked(owner *memorySubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for tag, d := range b.unacked {
+		if d.owner != owner {
+			continue
+		}
+		delete(b.unacked, tag)
+		d.msg.redelivered = true
+		b.enqueue(d.queue, d.msg, true)
+	}
+}
+
+func (b *MemoryBroker) Publish(msg *Message, opts *PublishOptions) (interface{}, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return b.PublishWithContext(ctx, msg, opts)
+}
+
+// PublishWithContext publishes msg, or for RPC sends it and waits for the
+// reply until ctx is done (opts.Timeout when ctx has no deadline)
+func (b *MemoryBroker) PublishWithContext(ctx context.Context, msg *Message, opts *PublishOptions) (*RPCResponse, error) {
+	if opts.IsRPC {
+		if _, ok := ctx.Deadline(); !ok && opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+		return b.call(ctx, msg, opts)
+	}
+
+	payload := msg.GeneratePayload()
+	payload.Type = opts.Pattern
+	if err := b.publishOpts(opts, payload); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// publishOpts publishes like Publisher, declaring the queue of the default
+// exchange first
+func (b *MemoryBroker) publishOpts(opts *PublishOptions, payload *amqp.Publishing) error {
+	if opts.QueueName != "" && opts.Exchange == "" {
+		b.mu.Lock()
+		_, err := b.declareQueueConfig(opts.QueueName, opts.QueueOpts)
+		b.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to declare queue: %w", err)
+		}
+	}
+
+	return b.publish(opts.Exchange, opts.routingKey(), opts.Mandatory, *payload)
+}
+
+func (b *MemoryBroker) call(ctx context.Context, msg *Message, opts *PublishOptions) (*RPCResponse, error) {
+	payload := msg.GenerateRPCPayload(DirectReplyTo, opts.Pattern)
+	reply := make(chan amqp.Publishing, 1)
+
+	b.mu.Lock()
+	b.calls[payload.CorrelationId] = reply
+	b.mu.Unlock()
+
+	cancelCall := func() {
+		b.mu.Lock()
+		delete(b.calls, payload.CorrelationId)
+		b.mu.Unlock()
+	}
+
+	// Like Publisher the request queue is not declared, a pattern no service
+	// consumes fails at once
+	if err := b.publish(opts.Exchange, opts.routingKey(), true, *payload); err != nil {
+		cancelCall()
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		cancelCall()
+		return nil, fmt.Errorf("rpc %s: %w", opts.Pattern, ctx.Err())
+	case p := <-reply:
+		var response RPCResponse
+		if err := json.Unmarshal(p.Body, &response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		return &response, nil
+	}
+}
+
+// PublishBatch publishes msgs one by one, every routable message is acked
+func (b *MemoryBroker) PublishBatch(ctx context.Context, msgs []*Message, opts *PublishOptions) ([]PublishResult, error) {
+	if opts.IsRPC {
+		return nil, errors.New("batch publishing does not support RPC")
+	}
+
+	results := make([]PublishResult, len(msgs))
+	failed := 0
+	for i, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		payload := msg.GeneratePayload()
+		payload.Type = opts.Pattern
+		err := b.publishOpts(opts, payload)
+
+		results[i] = PublishResult{MessageID: msg.ID, Acked: err == nil, Attempts: 1, Err: err}
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d messages were not confirmed", failed, len(msgs))
+	}
+	return results, nil
+}
+
+// Messages returns the ready messages of queue, oldest first
+func (b *MemoryBroker) Messages(queue string) []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil
+	}
+	messages := make([]amqp.Publishing, 0, len(q.messages))
+	for _, msg := range q.messages {
+		messages = append(messages, msg.publishing)
+	}
+	return messages
+}
+
+// WaitIdle waits until every message was consumed and acked, and no retry is
+// pending. Messages of queues without a consumer count as idle.
+func (b *MemoryBroker) WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(memoryIdlePoll)
+	defer ticker.Stop()
+
+	for {
+		if b.idle() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("broker not idle: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *MemoryBroker) idle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.inFlight > 0 || len(b.unacked) > 0 || len(b.timers) > 0 {
+		return false
+	}
+	for _, q := range b.queues {
+		if q.consumers > 0 && len(q.messages) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Close drops pending retries, later publishes fail with ErrBrokerClosed
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for timer := range b.timers {
+		timer.Stop()
+	}
+	b.timers = make(map[*time.Timer]struct{})
+	return nil
+}
+
+// Subscribe creates a subscriber of opts.QueueName, it consumes once started
+func (b *MemoryBroker) Subscribe(ctx context.Context, handler MessageHandler, opts *SubscribeOptions) (MessageSubscriber, error) {
+	if opts.WorkerCount <= 0 {
+		return nil, errors.New("subscriber needs at least one worker")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &memorySubscriber{
+		broker:  b,
+		handler: handler,
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// memorySubscriber consumes a MemoryBroker queue and settles messages the way
+// Subscriber does
+type memorySubscriber struct {
+	broker    *MemoryBroker
+	handler   MessageHandler
+	opts      *SubscribeOptions
+	queue     *memoryQueue
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	isRunning atomic.Bool
+}
+
+func (s *memorySubscriber) Start() error {
+	if s.isRunning.Swap(true) {
+		return fmt.Errorf("subscriber is already running")
+	}
+
+	s.broker.mu.Lock()
+	q, err := s.broker.declareQueueConfig(s.opts.QueueName, s.opts.QueueOpts)
+	s.broker.mu.Unlock()
+	if err != nil {
+		s.isRunning.Store(false)
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	if err := s.broker.declareTopology(s.opts.Topology, s.opts.QueueName); err != nil {
+		s.isRunning.Store(false)
+		return fmt.Errorf("failed to declare topology: %w", err)
+	}
+
+	s.broker.mu.Lock()
+	q.consumers++
+	s.broker.mu.Unlock()
+	s.queue = q
+
+	for i := 0; i < s.opts.WorkerCount; i++ {
+		s.wg.Add(1)
+		go s.runWorker(q)
+	}
+	return nil
+}
+
+func (s *memorySubscriber) runWorker(q *memoryQueue) {
+	defer s.wg.Done()
+
+	for {
+		if s.ctx.Err() != nil {
+			return
+		}
+		if msg, ok := s.broker.deliver(q, s); ok {
+			s.processMessage(msg)
+			s.broker.processed()
+			continue
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-q.ready:
+		}
+	}
+}
+
+func (s *memorySubscriber) processMessage(msg *amqp.Delivery) {
+	defer func() {
+		// Left unacked like a panicking worker of Subscriber, Stop requeues it
+		if r := recover(); r != nil {
+			logger.Error.Printf("Message processor panic: %v\n", r)
+		}
+	}()
+
+	count := deliveryCount(msg)
+	response, err := s.handler(msg)
+	if err != nil {
+		err = s.handleProcessingError(msg, err, count)
+	} else {
+		err = s.handleSuccessfulProcessing(msg, response)
+	}
+	if err != nil {
+		logger.Error.Printf("Failed to process message %s: %v\n", msg.MessageId, err)
+	}
+}
+
+func (s *memorySubscriber) handleProcessingError(msg *amqp.Delivery, handlerErr error, count int) error {
+	if msg.CorrelationId != "" {
+		if msg.ReplyTo != "" {
+			if err := s.reply(msg, &RPCResponse{Status: "error", Err: handlerErr.Error()}); err != nil {
+				logger.Error.Printf("Failed to handle RPC error: %v", err)
+			}
+		}
+		return s.ack(msg)
+	}
+
+	if count >= s.opts.MaxRetryAttempts {
+		if !s.opts.EnableDeadLetter {
+			if err := msg.Reject(false); err != nil {
+				return fmt.Errorf("failed to reject message: %w", err)
+			}
+			return nil
+		}
+
+		if err := s.ack(msg); err != nil {
+			return err
+		}
+		payload := publishingOf(msg)
+		payload.Headers = markDead(payload.Headers, s.opts, handlerErr)
+
+		s.broker.mu.Lock()
+		s.broker.declareQueue(s.opts.DeadLetterName)
+		s.broker.mu.Unlock()
+		if err := s.broker.publish("", s.opts.DeadLetterName, false, payload); err != nil {
+			return fmt.Errorf("failed to publish to dead letter queue: %w", err)
+		}
+		return nil
+	}
+
+	payload := publishingOf(msg)
+	if payload.Headers == nil {
+		payload.Headers = make(amqp.Table)
+	}
+	payload.Headers["x-retry-count"] = count + 1
+	payload.Expiration = ""
+	s.broker.publishAfter(retryDelay(s.opts, count+1), s.opts.QueueName, payload)
+
+	if err := s.ack(msg); err != nil {
+		return err
+	}
+	return fmt.Errorf("handler error on attempt %d: %w", count+1, handlerErr)
+}
+
+func (s *memorySubscriber) handleSuccessfulProcessing(msg *amqp.Delivery, response interface{}) error {
+	if msg.CorrelationId != "" && msg.ReplyTo != "" {
+		if err := s.reply(msg, &RPCResponse{IsDisposed: true, Response: response}); err != nil {
+			return fmt.Errorf("failed to handle successful RPC: %w", err)
+		}
+	}
+	return s.ack(msg)
+}
+
+func (s *memorySubscriber) reply(delivery *amqp.Delivery, response *RPCResponse) error {
+	msg, err := NewMessage(response, &delivery.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to create reply payload: %w", err)
+	}
+	payload := msg.GenerateRPCReplyPayload(delivery.CorrelationId)
+	return s.broker.publish("", delivery.ReplyTo, false, *payload)
+}
+
+func (s *memorySubscriber) ack(msg *amqp.Delivery) error {
+	if s.opts.AutoAck {
+		return nil
+	}
+	if err := msg.Ack(false); err != nil {
+		return fmt.Errorf("failed to acknowledge message: %w", err)
+	}
+	return nil
+}
+
+// Stop lets the workers finish their messages, then requeues what is left
+// unacked
+func (s *memorySubscriber) Stop() error {
+	if !s.isRunning.Swap(false) {
+		return nil
+	}
+
+	s.cancel()
+
+	drainTimeout := s.opts.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = time.Second * 30
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+		err = fmt.Errorf("timeout waiting for workers to stop")
+	}
+
+	s.broker.mu.Lock()
+	s.queue.consumers--
+	s.broker.mu.Unlock()
+
+	s.broker.requeueUnacked(s)
+	return err
+}
+
+func (s *memorySubscriber) GetRunningWorkers() int {
+	if !s.isRunning.Load() {
+		return 0
+	}
+	return s.opts.WorkerCount
+}
+
+func (s *memorySubscriber) GetWorkerCapacity() int {
+	return s.opts.WorkerCount
+}
+
+func (s *memorySubscriber) IsHealthy() bool {
+	return s.isRunning.Load()
+}
+
+// publishingOf copies the properties of a delivery to publish it again
+func publishingOf(msg *amqp.Delivery) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         cloneTable(msg.Headers),
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+func cloneTable(t amqp.Table) amqp.Table {
+	if t == nil {
+		return nil
+	}
+	clone := make(amqp.Table, len(t))
+	for k, v := range t {
+		clone[k] = v
+	}
+	return clone
+}
@@ -0,0 +1,385 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-boilerplate/internal/pkg/logger"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMain(m *testing.M) {
+	logger.Setup()
+	os.Exit(m.Run())
+}
+
+func publishText(t *testing.T, b *MemoryBroker, queue, body string) {
+	t.Helper()
+	msg, err := NewMessage(body, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Publish(msg, DefaultPublishOptions(queue, "test", false)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+// startSubscriber subscribes handler to opts.QueueName and stops it with the test
+func startSubscriber(t *testing.T, b *MemoryBroker, opts *SubscribeOptions, handler MessageHandler) {
+	t.Helper()
+	sub, err := b.Subscribe(context.Background(), handler, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sub.Stop() })
+}
+
+func waitIdle(t *testing.T, b *MemoryBroker) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryBrokerAckNack(t *testing.T) {
+	b := NewMemoryBroker()
+	publishText(t, b, "orders", "first")
+	publishText(t, b, "orders", "second")
+
+	owner := &memorySubscriber{opts: DefaultSubscribeOptions("orders", false)}
+	q := b.queues["orders"]
+
+	first, ok := b.deliver(q, owner)
+	if !ok || string(first.Body) != "first" || first.Redelivered {
+		t.Fatalf("first delivery = %+v, %v", first, ok)
+	}
+	b.processed()
+
+	// a requeued message goes back to the head of the queue
+	if err := first.Nack(false, true); err != nil {
+		t.Fatal(err)
+	}
+	again, ok := b.deliver(q, owner)
+	if !ok || string(again.Body) != "first" {
+		t.Fatalf("redelivery = %+v, %v", again, ok)
+	}
+	b.processed()
+	if !again.Redelivered || DeliveryCount(again) != 1 {
+		t.Errorf("redelivered = %v, count = %d, want true, 1", again.Redelivered, DeliveryCount(again))
+	}
+	if again.DeliveryTag == first.DeliveryTag {
+		t.Error("redelivery reused the delivery tag")
+	}
+
+	if err := again.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Ack(false); err == nil {
+		t.Error("acking a settled delivery succeeded")
+	}
+
+	// a nack without requeue drops the message
+	second, ok := b.deliver(q, owner)
+	if !ok || string(second.Body) != "second" {
+		t.Fatalf("second delivery = %+v, %v", second, ok)
+	}
+	b.processed()
+	if err := second.Nack(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Messages("orders"); len(got) != 0 {
+		t.Errorf("queue holds %d messages, want 0", len(got))
+	}
+	if !b.idle() {
+		t.Error("broker not idle after settling every delivery")
+	}
+}
+
+func TestMemoryBrokerAckMultiple(t *testing.T) {
+	b := NewMemoryBroker()
+	for _, body := range []string{"a", "b", "c"} {
+		publishText(t, b, "orders", body)
+	}
+
+	owner := &memorySubscriber{opts: DefaultSubscribeOptions("orders", false)}
+	q := b.queues["orders"]
+	var last *amqp.Delivery
+	for i := 0; i < 3; i++ {
+		last, _ = b.deliver(q, owner)
+		b.processed()
+	}
+
+	if err := last.Nack(true, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Messages("orders"); len(got) != 3 {
+		t.Fatalf("requeued %d messages, want 3", len(got))
+	}
+}
+
+func TestMemoryBrokerStopRequeuesUnacked(t *testing.T) {
+	b := NewMemoryBroker()
+	opts := DefaultSubscribeOptions("orders", false)
+	opts.WorkerCount = 1
+	opts.DrainTimeout = 50 * time.Millisecond
+
+	started := make(chan struct{})
+	sub, err := b.Subscribe(context.Background(), func(msg *amqp.Delivery) (interface{}, error) {
+		close(started)
+		panic("handler crashed")
+	}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	publishText(t, b, "orders", "crash")
+	<-started
+	// the panicking worker leaves the message unacked
+	time.Sleep(20 * time.Millisecond)
+
+	if err := sub.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	got := b.Messages("orders")
+	if len(got) != 1 || string(got[0].Body) != "crash" {
+		t.Fatalf("queue after stop = %v, want the unacked message", got)
+	}
+}
+
+func TestMemoryBrokerRetriesThenDeadLetters(t *testing.T) {
+	b := NewMemoryBroker()
+	opts := DefaultSubscribeOptions("orders", false)
+	opts.WorkerCount = 1
+	opts.MaxRetryAttempts = 2
+	opts.RetryStrategy = LinearRetry
+	opts.BaseRetryDelay = 30 * time.Millisecond
+
+	var mu sync.Mutex
+	var counts []int
+	var times []time.Time
+	startSubscriber(t, b, opts, func(msg *amqp.Delivery) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts = append(counts, DeliveryCount(msg))
+		times = append(times, time.Now())
+		return nil, errors.New("downstream unavailable")
+	})
+
+	publishText(t, b, "orders", "payload")
+	waitIdle(t, b)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(counts) != 3 || counts[0] != 0 || counts[1] != 1 || counts[2] != 2 {
+		t.Fatalf("delivery counts = %v, want [0 1 2]", counts)
+	}
+	// linear: the n-th retry waits n base delays
+	for i := 1; i < len(times); i++ {
+		if gap, want := times[i].Sub(times[i-1]), opts.RetryDelay(i); gap < want {
+			t.Errorf("retry %d came after %s, want at least %s", i, gap, want)
+		}
+	}
+
+	dead := b.Messages(opts.DeadLetterName)
+	if len(dead) != 1 {
+		t.Fatalf("dead letter queue holds %d messages, want 1", len(dead))
+	}
+	if string(dead[0].Body) != "payload" {
+		t.Errorf("dead letter body = %q", dead[0].Body)
+	}
+	if reason := dead[0].Headers["x-death-reason"]; reason != "downstream unavailable" {
+		t.Errorf("x-death-reason = %v", reason)
+	}
+	if queue := dead[0].Headers["x-death-queue"]; queue != "orders" {
+		t.Errorf("x-death-queue = %v", queue)
+	}
+	if got := b.Messages("orders"); len(got) != 0 {
+		t.Errorf("work queue holds %d messages, want 0", len(got))
+	}
+}
+
+func TestMemoryBrokerDeadLettersWithoutRetryDelay(t *testing.T) {
+	b := NewMemoryBroker()
+	opts := DefaultSubscribeOptions("orders", false)
+	opts.WorkerCount = 1
+	opts.MaxRetryAttempts = 3
+	opts.BaseRetryDelay = 0
+
+	var mu sync.Mutex
+	calls := 0
+	startSubscriber(t, b, opts, func(msg *amqp.Delivery) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return nil, errors.New("downstream unavailable")
+	})
+
+	publishText(t, b, "orders", "payload")
+	waitIdle(t, b)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != opts.MaxRetryAttempts+1 {
+		t.Errorf("handler called %d times, want %d", calls, opts.MaxRetryAttempts+1)
+	}
+	if dead := b.Messages(opts.DeadLetterName); len(dead) != 1 {
+		t.Errorf("dead letter queue holds %d messages, want 1", len(dead))
+	}
+}
+
+func TestMemoryBrokerRejectsWithoutDeadLetter(t *testing.T) {
+	b := NewMemoryBroker()
+	opts := DefaultSubscribeOptions("orders", false)
+	opts.WorkerCount = 1
+	opts.MaxRetryAttempts = 0
+	opts.EnableDeadLetter = false
+
+	calls := 0
+	startSubscriber(t, b, opts, func(msg *amqp.Delivery) (interface{}, error) {
+		calls++
+		return nil, errors.New("invalid payload")
+	})
+
+	publishText(t, b, "orders", "payload")
+	waitIdle(t, b)
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if got := b.Messages(opts.DeadLetterName); len(got) != 0 {
+		t.Errorf("dead letter queue holds %d messages, want 0", len(got))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		strategy RetryStrategy
+		attempt  int
+		want     time.Duration
+	}{
+		{FixedRetry, 1, time.Second},
+		{FixedRetry, 4, time.Second},
+		{LinearRetry, 1, time.Second},
+		{LinearRetry, 3, 3 * time.Second},
+		{ExponentialRetry, 1, 2 * time.Second},
+		{ExponentialRetry, 3, 8 * time.Second},
+		{ExponentialRetry, 10, 10 * time.Second}, // capped at MaxRetryDelay
+	}
+
+	for _, tt := range tests {
+		opts := DefaultSubscribeOptions("orders", false)
+		opts.RetryStrategy = tt.strategy
+		opts.BaseRetryDelay = time.Second
+		opts.MaxRetryDelay = 10 * time.Second
+
+		if got := opts.RetryDelay(tt.attempt); got != tt.want {
+			t.Errorf("%s attempt %d: delay = %s, want %s", tt.strategy, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryBrokerRPC(t *testing.T) {
+	b := NewMemoryBroker()
+	opts := DefaultSubscribeOptions("rpc:sum", true)
+	opts.WorkerCount = 1
+	startSubscriber(t, b, opts, func(msg *amqp.Delivery) (interface{}, error) {
+		var body RPCBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return nil, err
+		}
+		if body.Pattern == "fail" {
+			return nil, errors.New("cannot sum")
+		}
+		return "42", nil
+	})
+
+	call := func(pattern string, timeout time.Duration) (*RPCResponse, error) {
+		msg, err := NewMessage("x", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return b.PublishWithContext(ctx, msg, DefaultPublishOptions("rpc:sum", pattern, true))
+	}
+
+	resp, err := call("sum", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsDisposed || resp.Response != "42" {
+		t.Errorf("reply = %+v, want the handler response", resp)
+	}
+
+	resp, err = call("fail", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "error" || resp.Err != "cannot sum" {
+		t.Errorf("error reply = %+v, want the handler error", resp)
+	}
+
+	// nothing consumes the queue, the call fails at once
+	msg, _ := NewMessage("x", nil)
+	if _, err := b.PublishWithContext(context.Background(), msg, DefaultPublishOptions("rpc:missing", "sum", true)); !errors.Is(err, ErrUnroutable) {
+		t.Errorf("call to a missing queue: %v, want ErrUnroutable", err)
+	}
+}
+
+func TestMemoryBrokerRPCTimeout(t *testing.T) {
+	b := NewMemoryBroker()
+	opts := DefaultSubscribeOptions("rpc:slow", true)
+	opts.WorkerCount = 1
+
+	release := make(chan struct{})
+	startSubscriber(t, b, opts, func(msg *amqp.Delivery) (interface{}, error) {
+		<-release
+		return "late", nil
+	})
+
+	msg, _ := NewMessage("x", nil)
+	publishOpts := DefaultPublishOptions("rpc:slow", "slow", true)
+	publishOpts.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := b.PublishWithContext(context.Background(), msg, publishOpts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("slow call: %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call returned after %s, want about the timeout", elapsed)
+	}
+
+	// the late reply is dropped, not delivered to a later call
+	close(release)
+	waitIdle(t, b)
+	b.mu.Lock()
+	pending := len(b.calls)
+	b.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d calls still waiting for a reply", pending)
+	}
+}
+
+func TestMemoryBrokerClose(t *testing.T) {
+	b := NewMemoryBroker()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := NewMessage("x", nil)
+	if _, err := b.Publish(msg, DefaultPublishOptions("orders", "test", false)); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("publish after close: %v, want ErrBrokerClosed", err)
+	}
+}
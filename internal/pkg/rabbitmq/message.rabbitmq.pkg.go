@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"go-boilerplate/internal/pkg/helper"
+	"strconv"
 	"time"
 
 	gonanoid "github.com/matoous/go-nanoid/v2"
@@ -11,12 +12,14 @@ import (
 )
 
 type Message struct {
-	ID          string      `json:"id"`
-	Body        []byte      `json:"content"`
-	Payload     interface{} `json:"payload"`
-	Headers     amqp.Table  `json:"headers,omitempty"`
-	Timestamp   time.Time   `json:"timestamp"`
-	ContentType string      `json:"content_type"`
+	ID          string        `json:"id"`
+	Body        []byte        `json:"content"`
+	Payload     interface{}   `json:"payload"`
+	Headers     amqp.Table    `json:"headers,omitempty"`
+	Timestamp   time.Time     `json:"timestamp"`
+	ContentType string        `json:"content_type"`
+	Priority    uint8         `json:"priority,omitempty"`   // Needs a queue with QueueConfig.MaxPriority
+	Expiration  time.Duration `json:"expiration,omitempty"` // Dropped or dead-lettered when not consumed in time
 }
 
 type RPCBody struct {
@@ -87,6 +90,8 @@ func (m *Message) GeneratePayload() *amqp.Publishing {
 		Timestamp:    m.Timestamp,
 		DeliveryMode: amqp.Persistent,
 		Headers:      m.Headers,
+		Priority:     m.Priority,
+		Expiration:   m.expiration(),
 	}
 }
 
@@ -107,9 +112,19 @@ func (m *Message) GenerateRPCPayload(queueName, pattern string) *amqp.Publishing
 		ReplyTo:       queueName,
 		CorrelationId: m.ID,
 		Headers:       m.Headers,
+		Priority:      m.Priority,
+		Expiration:    m.expiration(),
 	}
 }
 
+// expiration is the per-message TTL in the milliseconds string AMQP expects
+func (m *Message) expiration() string {
+	if m.Expiration <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(m.Expiration.Milliseconds(), 10)
+}
+
 func (m *Message) GenerateRPCReplyPayload(correlationID string) *amqp.Publishing {
 	v, _ := helper.JSONToStruct[RPCResponse](m.Payload)
 	v.ID = correlationID
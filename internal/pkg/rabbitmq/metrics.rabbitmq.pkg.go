@@ -0,0 +1,97 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"go-boilerplate/internal/pkg/metrics"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	consumedTotal     = metrics.NewCounter("rabbitmq_messages_consumed_total", "Messages delivered to a handler.", "queue")
+	ackedTotal        = metrics.NewCounter("rabbitmq_messages_acked_total", "Messages acked by a consumer.", "queue")
+	nackedTotal       = metrics.NewCounter("rabbitmq_messages_nacked_total", "Messages nacked or rejected by a consumer.", "queue", "requeue")
+	retriedTotal      = metrics.NewCounter("rabbitmq_messages_retried_total", "Failed messages moved to a retry queue.", "queue")
+	deadLetteredTotal = metrics.NewCounter("rabbitmq_messages_dead_lettered_total", "Messages moved to the dead letter queue after their last retry.", "queue")
+	handlerDuration   = metrics.NewHistogram("rabbitmq_handler_duration_seconds", "Time a handler took per message.", nil, "queue", "outcome")
+	inFlightMessages  = metrics.NewGauge("rabbitmq_messages_in_flight", "Messages being handled.", "queue")
+	consumerWorkers   = metrics.NewGauge("rabbitmq_consumer_workers", "Running workers of a subscriber (GetRunningWorkers).", "queue")
+
+	publishDuration      = metrics.NewHistogram("rabbitmq_publish_duration_seconds", "Time from publish to broker confirm.", nil, "exchange", "routing_key")
+	publishFailuresTotal = metrics.NewCounter("rabbitmq_publish_failures_total", "Publishes not confirmed by the broker.", "exchange", "routing_key", "reason")
+
+	connectionReconnectsTotal = metrics.NewCounter("rabbitmq_connection_reconnects_total", "Connections reopened after the broker closed them.")
+	channelReconnectsTotal    = metrics.NewCounter("rabbitmq_channel_reconnects_total", "Channels reopened after the broker closed them.")
+)
+
+// meteredAcknowledger counts the acks and nacks of a queue's deliveries,
+// whoever settles them, the subscriber or a handler
+type meteredAcknowledger struct {
+	amqp.Acknowledger
+	queue string
+}
+
+func (a meteredAcknowledger) Ack(tag uint64, multiple bool) error {
+	err := a.Acknowledger.Ack(tag, multiple)
+	if err == nil {
+		ackedTotal.Inc(a.queue)
+	}
+	return err
+}
+
+func (a meteredAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	err := a.Acknowledger.Nack(tag, multiple, requeue)
+	if err == nil {
+		nackedTotal.Inc(a.queue, boolLabel(requeue))
+	}
+	return err
+}
+
+func (a meteredAcknowledger) Reject(tag uint64, requeue bool) error {
+	err := a.Acknowledger.Reject(tag, requeue)
+	if err == nil {
+		nackedTotal.Inc(a.queue, boolLabel(requeue))
+	}
+	return err
+}
+
+// meter makes the acks of msg count towards queue
+func meter(msg *amqp.Delivery, queue string) {
+	if msg.Acknowledger != nil {
+		msg.Acknowledger = meteredAcknowledger{Acknowledger: msg.Acknowledger, queue: queue}
+	}
+}
+
+// observePublish records the confirm latency of a publish, or its failure
+func observePublish(opts *PublishOptions, start time.Time, err error) {
+	if err != nil {
+		publishFailuresTotal.Inc(opts.Exchange, opts.routingKey(), publishFailure(err))
+		return
+	}
+	publishDuration.ObserveSince(start, opts.Exchange, opts.routingKey())
+}
+
+// publishFailure is the reason label of a failed publish
+func publishFailure(err error) string {
+	switch {
+	case errors.Is(err, ErrUnroutable):
+		return "unroutable"
+	case errors.Is(err, ErrNacked):
+		return "nacked"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
+func boolLabel(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
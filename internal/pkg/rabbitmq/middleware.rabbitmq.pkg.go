@@ -0,0 +1,182 @@
+package rabbitmq
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Middleware wraps a MessageHandler, e.g. to log or guard every message
+type Middleware func(next MessageHandler) MessageHandler
+
+// Chain wraps handler with middlewares, the first middleware runs first
+func Chain(handler MessageHandler, middlewares ...Middleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// LoggingMiddleware logs the pattern, duration and result of every message
+func LoggingMiddleware() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg *amqp.Delivery) (interface{}, error) {
+			start := time.Now()
+			response, err := next(msg)
+
+			pattern := Pattern(msg)
+			if err != nil {
+				logger.Error.Printf("Message %s (%s) failed after %s: %v", msg.MessageId, pattern, time.Since(start), err)
+			} else {
+				logger.Info.Printf("Message %s (%s) handled in %s", msg.MessageId, pattern, time.Since(start))
+			}
+			return response, err
+		}
+	}
+}
+
+// RecoveryMiddleware turns a handler panic into an error, so the message is
+// retried or dead-lettered instead of left unacked
+func RecoveryMiddleware() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg *amqp.Delivery) (response interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error.Printf("Message %s handler panic: %v\n%s", msg.MessageId, r, debug.Stack())
+					response, err = nil, fmt.Errorf("handler panic: %v", r)
+				}
+			}()
+			return next(msg)
+		}
+	}
+}
+
+// TraceParentHeader is the W3C trace context header
+const TraceParentHeader = "traceparent"
+
+// TracingMiddleware continues the W3C trace of the message, or starts one,
+// and sets traceparent to the span of this consumer. RPC replies copy the
+// headers, so the caller sees the same trace.
+func TracingMiddleware() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg *amqp.Delivery) (interface{}, error) {
+			traceID, _ := parseTraceParent(msg)
+			if traceID == "" {
+				traceID = randomHex(16)
+			}
+
+			if msg.Headers == nil {
+				msg.Headers = make(amqp.Table)
+			}
+			msg.Headers[TraceParentHeader] = fmt.Sprintf("00-%s-%s-01", traceID, randomHex(8))
+
+			return next(msg)
+		}
+	}
+}
+
+// TraceID returns the trace id of the message set by TracingMiddleware
+func TraceID(msg *amqp.Delivery) string {
+	traceID, _ := parseTraceParent(msg)
+	return traceID
+}
+
+func parseTraceParent(msg *amqp.Delivery) (traceID, spanID string) {
+	value, _ := msg.Headers[TraceParentHeader].(string)
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IdempotencyStore remembers the message ids already handled
+type IdempotencyStore interface {
+	// Claim reports false when the id was claimed before and not released
+	Claim(id string, ttl time.Duration) (bool, error)
+	Release(id string) error
+}
+
+// IdempotencyMiddleware skips messages whose MessageId was already handled
+// within ttl. The id is released when the handler fails, so retries run.
+// Messages without a MessageId are always handled.
+func IdempotencyMiddleware(store IdempotencyStore, ttl time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg *amqp.Delivery) (interface{}, error) {
+			if msg.MessageId == "" {
+				return next(msg)
+			}
+
+			claimed, err := store.Claim(msg.MessageId, ttl)
+			if err != nil {
+				return nil, fmt.Errorf("failed to claim message %s: %w", msg.MessageId, err)
+			}
+			if !claimed {
+				logger.Warning.Printf("Skipping duplicate message %s (%s)", msg.MessageId, Pattern(msg))
+				return nil, nil
+			}
+
+			response, err := next(msg)
+			if err != nil {
+				if releaseErr := store.Release(msg.MessageId); releaseErr != nil {
+					logger.Error.Printf("Failed to release message %s: %v", msg.MessageId, releaseErr)
+				}
+			}
+			return response, err
+		}
+	}
+}
+
+// MemoryIdempotencyStore dedupes within one process, use a shared store when
+// several instances consume the same queue
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	claimed map[string]time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{claimed: make(map[string]time.Time)}
+}
+
+func (s *MemoryIdempotencyStore) Claim(id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if expiry, ok := s.claimed[id]; ok && now.Before(expiry) {
+		return false, nil
+	}
+
+	// Drop expired ids while the map is locked anyway
+	if len(s.claimed) > 10000 {
+		for key, expiry := range s.claimed {
+			if !now.Before(expiry) {
+				delete(s.claimed, key)
+			}
+		}
+	}
+
+	s.claimed[id] = now.Add(ttl)
+	return true, nil
+}
+
+func (s *MemoryIdempotencyStore) Release(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.claimed, id)
+	return nil
+}
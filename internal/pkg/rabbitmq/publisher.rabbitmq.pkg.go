@@ -2,7 +2,6 @@ package rabbitmq
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"go-boilerplate/internal/pkg/logger"
@@ -15,6 +14,8 @@ import (
 type Publisher struct {
 	connManager    *ConnectionManager
 	channelManager *ChannelManager
+	returns        *returnTracker
+	rpc            *rpcClient
 	mu             sync.Mutex
 	wg             sync.WaitGroup
 	maxRetries     int
@@ -28,6 +29,7 @@ type PublishOptions struct {
 	QueueName    string
 	Pattern      string
 	Exchange     string
+	RoutingKey   string // Defaults to QueueName
 	Mandatory    bool
 	Immediate    bool
 	MaxRetries   int
@@ -55,10 +57,23 @@ func DefaultPublishOptions(queueName, pattern string, isRPC bool) *PublishOption
 		IsRPC:        isRPC,
 	}
 
-	if isRPC {
-		opts.QueueOpts.AutoDelete = true
+	return opts
+}
+
+// routingKey is RoutingKey, or QueueName through the default exchange
+func (o *PublishOptions) routingKey() string {
+	if o.RoutingKey == "" {
+		return o.QueueName
 	}
+	return o.RoutingKey
+}
 
+// DefaultExchangePublishOptions publishes to exchange with routingKey instead
+// of a queue, the bound queues receive the message
+func DefaultExchangePublishOptions(exchange, routingKey, pattern string) *PublishOptions {
+	opts := DefaultPublishOptions("", pattern, false)
+	opts.Exchange = exchange
+	opts.RoutingKey = routingKey
 	return opts
 }
 
@@ -72,32 +87,43 @@ func NewPublisher(ctx context.Context, connManager *ConnectionManager) (*Publish
 		ctx:            ctx,
 		cancel:         cancel,
 		channelManager: NewChannelManager(ctx, connManager),
+		returns:        newReturnTracker(),
+		rpc:            newRPCClient(),
+	}
+
+	if err := pub.channelManager.AddSetupHook(pub.returns.watch); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to watch returned messages: %w", err)
+	}
+	if err := pub.channelManager.AddSetupHook(pub.rpc.watch); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start rpc reply consumer: %w", err)
 	}
 
 	return pub, nil
 }
 
-func (p *Publisher) declareQueue(name string, isRPC bool, config *QueueConfig) (*amqp.Queue, error) {
-	ch, err := p.channelManager.GetChannel()
-	queueName := name
-	cfg := config
+// DeclareTopology declares the exchanges and bindings the publisher sends to,
+// now and again whenever its channel is reopened
+func (p *Publisher) DeclareTopology(topology *Topology) error {
+	if _, err := p.channelManager.GetChannel(); err != nil {
+		return fmt.Errorf("failed to get channel: %w", err)
+	}
 
-	if err != nil || ch == nil {
-		return nil, fmt.Errorf("failed to get channel: %w", err)
+	if err := p.channelManager.AddSetupHook(topology.Declare); err != nil {
+		return fmt.Errorf("failed to declare topology: %w", err)
 	}
 
-	if isRPC {
-		queueName = ""
+	return nil
+}
+
+func (p *Publisher) declareQueue(name string, config *QueueConfig) (*amqp.Queue, error) {
+	ch, err := p.channelManager.GetChannel()
+	if err != nil || ch == nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
 	}
 
-	reply, err := ch.QueueDeclare(
-		queueName,
-		cfg.Durable,
-		cfg.AutoDelete,
-		cfg.Exclusive,
-		cfg.NoWait,
-		cfg.Args,
-	)
+	reply, err := queueDeclare(p.connManager, ch, name, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to declare queue: %w", err)
 	}
@@ -111,6 +137,9 @@ func (p *Publisher) Publish(msg *Message, opts *PublishOptions) (interface{}, er
 	return p.PublishWithContext(to, msg, opts)
 }
 
+// PublishWithContext publishes msg, or for RPC sends it and waits for the
+// reply until ctx is done (opts.Timeout when ctx has no deadline). RPC calls
+// share one Direct Reply-To consumer, so any number can be in flight.
 func (p *Publisher) PublishWithContext(ctx context.Context, msg *Message, opts *PublishOptions) (*RPCResponse, error) {
 	if opts.MaxRetries == 0 {
 		opts.MaxRetries = p.maxRetries
@@ -118,9 +147,13 @@ func (p *Publisher) PublishWithContext(ctx context.Context, msg *Message, opts *
 	if opts.RetryBackoff == 0 {
 		opts.RetryBackoff = p.retryInterval
 	}
+	if _, ok := ctx.Deadline(); !ok && opts.IsRPC && opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
 
 	var lastErr error
-	var replyQueue *amqp.Queue
 
 	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
 		if attempt > 0 {
@@ -136,34 +169,37 @@ func (p *Publisher) PublishWithContext(ctx context.Context, msg *Message, opts *
 			continue
 		}
 
-		if opts.QueueName != "" {
-			var err error
-			replyQueue, err = p.declareQueue(opts.QueueName, opts.IsRPC, opts.QueueOpts)
-			if err != nil {
+		if opts.IsRPC {
+			response, err := p.call(ctx, msg, opts)
+			// Only a request lost with its channel is sent again, after a
+			// timeout the service may still be handling the first one
+			if errors.Is(err, ErrReplyChannelClosed) {
 				lastErr = err
-				logger.Warning.Printf("Failed to declare queue on attempt %d: %v\n", attempt, err)
+				logger.Warning.Printf("RPC reply channel closed on attempt %d, retrying\n", attempt)
 				continue
 			}
+			return response, err
 		}
 
-		if opts.IsRPC {
-			if replyQueue == nil {
-				return nil, errors.New("reply queue is not initialized")
-			}
-			payload := msg.GenerateRPCPayload(replyQueue.Name, opts.Pattern)
-			if err := p.publishMessage(ctx, opts, payload); err != nil {
+		// Messages sent to an exchange reach the queues bound to it, only the
+		// default exchange needs the queue named after the routing key
+		if opts.QueueName != "" && opts.Exchange == "" {
+			if _, err := p.declareQueue(opts.QueueName, opts.QueueOpts); err != nil {
 				lastErr = err
-				logger.Warning.Printf("Failed to publish message on attempt %d: %v\n", attempt, err)
+				logger.Warning.Printf("Failed to declare queue on attempt %d: %v\n", attempt, err)
 				continue
 			}
-			return p.consumeReplyQueue(ctx, replyQueue, payload)
-		} else {
-			payload := msg.GeneratePayload()
-			if err := p.publishMessage(ctx, opts, payload); err != nil {
-				lastErr = err
-				logger.Warning.Printf("Failed to publish message on attempt %d: %v\n", attempt, err)
-				continue
+		}
+
+		payload := msg.GeneratePayload()
+		payload.Type = opts.Pattern
+		if err := p.publishMessage(ctx, opts, payload); err != nil {
+			if errors.Is(err, ErrUnroutable) {
+				return nil, err
 			}
+			lastErr = err
+			logger.Warning.Printf("Failed to publish message on attempt %d: %v\n", attempt, err)
+			continue
 		}
 
 		return nil, nil
@@ -181,60 +217,16 @@ func (p *Publisher) waitForRetry(ctx context.Context, opts *PublishOptions, atte
 	return nil
 }
 
+// publishMessage returns once the broker confirmed the message
 func (p *Publisher) publishMessage(ctx context.Context, opts *PublishOptions, payload *amqp.Publishing) error {
-	ch, err := p.channelManager.GetChannel()
-
-	if err != nil || ch == nil {
-		return fmt.Errorf("failed to get channel: %w", err)
-	}
-
-	err = ch.PublishWithContext(
-		ctx,
-		opts.Exchange,
-		opts.QueueName,
-		opts.Mandatory,
-		opts.Immediate,
-		*payload,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to publish message: %w", err)
-	}
-
-	return nil
-}
-
-func (p *Publisher) consumeReplyQueue(ctx context.Context, replyQueue *amqp.Queue, payload *amqp.Publishing) (*RPCResponse, error) {
-	ch, err := p.channelManager.GetChannel()
-
-	if err != nil || ch == nil {
-		return nil, fmt.Errorf("failed to get channel: %w", err)
-	}
-
-	msgs, err := ch.ConsumeWithContext(
-		ctx,
-		replyQueue.Name,
-		"",
-		true,
-		true,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to consume reply queue: %w", err)
-	}
-
-	for m := range msgs {
-		if m.CorrelationId == payload.CorrelationId {
-			var response RPCResponse
-			if err := json.Unmarshal(m.Body, &response); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-			}
-			return &response, nil
-		}
+	start := time.Now()
+	confirm, err := p.publishDeferred(ctx, opts, payload)
+	if err == nil {
+		err = p.waitConfirm(ctx, opts, payload.MessageId, confirm)
 	}
 
-	return nil, errors.New("no matching response in reply queue")
+	observePublish(opts, start, err)
+	return err
 }
 
 func (p *Publisher) Close() error {
@@ -0,0 +1,178 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type QueueType string
+
+const (
+	ClassicQueue QueueType = "classic"
+	QuorumQueue  QueueType = "quorum"
+)
+
+// OverflowPolicy is what a queue at its max length does with new messages
+type OverflowPolicy string
+
+const (
+	DropHead         OverflowPolicy = "drop-head"          // Drops the oldest message
+	RejectPublish    OverflowPolicy = "reject-publish"     // Nacks the publish
+	RejectPublishDLX OverflowPolicy = "reject-publish-dlx" // Nacks and dead-letters it (classic only)
+)
+
+// ErrQueueMismatch is returned when a queue already exists with other settings
+var ErrQueueMismatch = errors.New("queue exists with different settings")
+
+// Validate reports settings RabbitMQ would refuse for this queue type
+func (c *QueueConfig) Validate() error {
+	switch c.Type {
+	case "", ClassicQueue:
+		if c.DeliveryLimit > 0 {
+			return errors.New("delivery limit needs a quorum queue")
+		}
+	case QuorumQueue:
+		if !c.Durable || c.AutoDelete || c.Exclusive {
+			return errors.New("quorum queues must be durable, not auto-delete or exclusive")
+		}
+		if c.MaxPriority > 0 {
+			return errors.New("quorum queues do not support x-max-priority")
+		}
+		if c.Lazy {
+			return errors.New("quorum queues are always on disk, lazy mode is for classic queues")
+		}
+		if c.Overflow == RejectPublishDLX {
+			return fmt.Errorf("quorum queues do not support overflow %s", c.Overflow)
+		}
+	default:
+		return fmt.Errorf("unknown queue type %s", c.Type)
+	}
+
+	switch c.Overflow {
+	case "", DropHead, RejectPublish, RejectPublishDLX:
+	default:
+		return fmt.Errorf("unknown overflow policy %s", c.Overflow)
+	}
+
+	if c.MessageTTL < 0 || c.MaxLength < 0 || c.MaxLengthBytes < 0 || c.DeliveryLimit < 0 {
+		return errors.New("queue limits must not be negative")
+	}
+
+	for key := range c.settings() {
+		if _, ok := c.Args[key]; ok {
+			return fmt.Errorf("%s is set in both Args and its QueueConfig field", key)
+		}
+	}
+
+	return nil
+}
+
+// settings are the x-arguments of the typed fields
+func (c *QueueConfig) settings() amqp.Table {
+	args := amqp.Table{}
+	if c.Type == QuorumQueue {
+		args["x-queue-type"] = string(QuorumQueue)
+	}
+	if c.MaxPriority > 0 {
+		args["x-max-priority"] = int(c.MaxPriority)
+	}
+	if c.MessageTTL > 0 {
+		args["x-message-ttl"] = c.MessageTTL.Milliseconds()
+	}
+	if c.MaxLength > 0 {
+		args["x-max-length"] = c.MaxLength
+	}
+	if c.MaxLengthBytes > 0 {
+		args["x-max-length-bytes"] = c.MaxLengthBytes
+	}
+	if c.Overflow != "" {
+		args["x-overflow"] = string(c.Overflow)
+	}
+	if c.Lazy {
+		args["x-queue-mode"] = "lazy"
+	}
+	if c.DeliveryLimit > 0 {
+		args["x-delivery-limit"] = c.DeliveryLimit
+	}
+	return args
+}
+
+// arguments are the x-arguments the queue is declared with
+func (c *QueueConfig) arguments() amqp.Table {
+	args := c.settings()
+	for key, value := range c.Args {
+		args[key] = value
+	}
+	return args
+}
+
+// queueDeclare validates config and declares the queue on ch. The first
+// declare of a queue runs on a channel of its own, so a queue that exists with
+// other settings fails with ErrQueueMismatch instead of closing ch.
+func queueDeclare(connManager *ConnectionManager, ch *amqp.Channel, name string, config *QueueConfig) (amqp.Queue, error) {
+	if config == nil {
+		config = DefaultQueueConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return amqp.Queue{}, fmt.Errorf("invalid settings for queue %s: %w", name, err)
+	}
+
+	args := config.arguments()
+	if name != "" && !config.Exclusive {
+		if err := connManager.checkQueue(name, config, args); err != nil {
+			return amqp.Queue{}, err
+		}
+	}
+
+	return ch.QueueDeclare(
+		name,
+		config.Durable,
+		config.AutoDelete,
+		config.Exclusive,
+		config.NoWait,
+		args,
+	)
+}
+
+// checkQueue declares the queue on a throwaway channel, once per name and
+// settings. RabbitMQ does not report the arguments of an existing queue, the
+// declare failing with PRECONDITION_FAILED is the only way to compare them.
+func (cm *ConnectionManager) checkQueue(name string, config *QueueConfig, args amqp.Table) error {
+	// fmt prints maps with sorted keys, so equal settings give equal keys
+	key := fmt.Sprintf("%s|%t|%t|%v", name, config.Durable, config.AutoDelete, args)
+	if _, ok := cm.checkedQueues.Load(key); ok {
+		return nil
+	}
+
+	conn := cm.GetConnection()
+	if conn == nil || conn.IsClosed() {
+		return errors.New("connection not available")
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer func() { _ = ch.Close() }()
+
+	_, err = ch.QueueDeclare(name, config.Durable, config.AutoDelete, false, false, args)
+	if err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+			return fmt.Errorf("%w: %s: %s", ErrQueueMismatch, name, mismatchReason(amqpErr.Reason))
+		}
+		return fmt.Errorf("failed to check queue %s: %w", name, err)
+	}
+
+	cm.checkedQueues.Store(key, struct{}{})
+	return nil
+}
+
+// mismatchReason strips the reply code prefix of a PRECONDITION_FAILED reason,
+// leaving e.g. "inequivalent arg 'x-max-priority' for queue ..."
+func mismatchReason(reason string) string {
+	return strings.TrimPrefix(reason, "PRECONDITION_FAILED - ")
+}
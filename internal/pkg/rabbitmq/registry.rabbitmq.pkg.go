@@ -0,0 +1,175 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"sync"
+)
+
+// Consumer declares a subscriber for the registry, modules register theirs
+// and the worker binary starts them all
+type Consumer struct {
+	Name    string // Defaults to the queue name
+	Options *SubscribeOptions
+	Handler MessageHandler
+}
+
+// ConsumerHealth is the state of one registered consumer
+type ConsumerHealth struct {
+	Name     string `json:"name"`
+	Queue    string `json:"queue"`
+	Healthy  bool   `json:"healthy"`
+	Workers  int    `json:"workers"`
+	Capacity int    `json:"capacity"`
+}
+
+type Registry struct {
+	mu          sync.Mutex
+	consumers   []Consumer
+	subscribers map[string]MessageSubscriber
+}
+
+func NewRegistry() *Registry {
+	return &Registry{subscribers: make(map[string]MessageSubscriber)}
+}
+
+func (r *Registry) Register(consumer Consumer) error {
+	if consumer.Options == nil || consumer.Options.QueueName == "" {
+		return errors.New("consumer needs options with a queue name")
+	}
+	if consumer.Handler == nil {
+		return fmt.Errorf("consumer of %s has no handler", consumer.Options.QueueName)
+	}
+	if consumer.Name == "" {
+		consumer.Name = consumer.Options.QueueName
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.consumers {
+		if c.Name == consumer.Name {
+			return fmt.Errorf("consumer %s is already registered", consumer.Name)
+		}
+	}
+	r.consumers = append(r.consumers, consumer)
+	return nil
+}
+
+// Consumers returns the names of the registered consumers
+func (r *Registry) Consumers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.consumers))
+	for _, c := range r.consumers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Start starts a subscriber per consumer on broker, only names given, or all
+// when empty
+func (r *Registry) Start(ctx context.Context, broker Broker, names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	for _, c := range r.consumers {
+		if len(selected) > 0 && !selected[c.Name] {
+			continue
+		}
+		delete(selected, c.Name)
+
+		if _, running := r.subscribers[c.Name]; running {
+			continue
+		}
+
+		sub, err := broker.Subscribe(ctx, c.Handler, c.Options)
+		if err != nil {
+			return fmt.Errorf("failed to create consumer %s: %w", c.Name, err)
+		}
+		if err := sub.Start(); err != nil {
+			return fmt.Errorf("failed to start consumer %s: %w", c.Name, err)
+		}
+
+		r.subscribers[c.Name] = sub
+		logger.Info.Printf("Consumer %s started on %s with %d workers", c.Name, c.Options.QueueName, c.Options.WorkerCount)
+	}
+
+	for name := range selected {
+		return fmt.Errorf("consumer %s is not registered", name)
+	}
+	return nil
+}
+
+// Stop stops every subscriber at once, each finishes its in-flight messages
+func (r *Registry) Stop() error {
+	r.mu.Lock()
+	subscribers := r.subscribers
+	r.subscribers = make(map[string]MessageSubscriber)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(subscribers))
+	var errMu sync.Mutex
+
+	for name, sub := range subscribers {
+		wg.Add(1)
+		go func(name string, sub MessageSubscriber) {
+			defer wg.Done()
+			if err := sub.Stop(); err != nil {
+				errMu.Lock()
+				errs = append(errs, fmt.Errorf("consumer %s: %w", name, err))
+				errMu.Unlock()
+				return
+			}
+			logger.Info.Printf("Consumer %s stopped", name)
+		}(name, sub)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Health reports every started consumer
+func (r *Registry) Health() []ConsumerHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	health := make([]ConsumerHealth, 0, len(r.subscribers))
+	for _, c := range r.consumers {
+		sub, ok := r.subscribers[c.Name]
+		if !ok {
+			continue
+		}
+		health = append(health, ConsumerHealth{
+			Name:     c.Name,
+			Queue:    c.Options.QueueName,
+			Healthy:  sub.IsHealthy(),
+			Workers:  sub.GetRunningWorkers(),
+			Capacity: sub.GetWorkerCapacity(),
+		})
+	}
+	return health
+}
+
+// Healthy reports whether consumers were started and all of them are healthy
+func (r *Registry) Healthy() bool {
+	health := r.Health()
+	if len(health) == 0 {
+		return false
+	}
+	for _, h := range health {
+		if !h.Healthy {
+			return false
+		}
+	}
+	return true
+}
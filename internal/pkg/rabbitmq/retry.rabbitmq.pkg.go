@@ -0,0 +1,192 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// retryConfirmTimeout bounds the wait for the broker to confirm a retry publish
+const retryConfirmTimeout = 10 * time.Second
+
+// RetryQueueName is the tier queue holding messages of queue for delay. The
+// delay is part of the name, so changing the retry options declares new tiers
+// instead of failing on the x-message-ttl of the existing ones.
+func RetryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("retry:%s:%d", queue, delay.Milliseconds())
+}
+
+// retryTierDelay is the delay of the tier queue of attempt. It is in whole
+// milliseconds like x-message-ttl and at least 1ms, so every attempt has a
+// declared tier even when the retry delays are 0.
+func retryTierDelay(opts *SubscribeOptions, attempt int) time.Duration {
+	delay := retryDelay(opts, attempt).Truncate(time.Millisecond)
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return delay
+}
+
+// retryDelays returns the distinct tier delays of every retry attempt in order
+func (s *Subscriber) retryDelays() []time.Duration {
+	var delays []time.Duration
+	seen := make(map[time.Duration]bool)
+
+	for attempt := 1; attempt <= s.opts.MaxRetryAttempts; attempt++ {
+		delay := retryTierDelay(s.opts, attempt)
+		if seen[delay] {
+			continue
+		}
+		seen[delay] = true
+		delays = append(delays, delay)
+	}
+
+	return delays
+}
+
+// declareRetryQueues declares one queue per retry delay. Messages wait there
+// without a consumer until x-message-ttl expires, then the broker dead-letters
+// them through the default exchange back to the work queue. Declaring is
+// idempotent, so every (re)connect of a worker runs it again.
+func (s *Subscriber) declareRetryQueues(workerID int) error {
+	if s.opts.IsRPC || s.opts.MaxRetryAttempts <= 0 {
+		return nil
+	}
+
+	ch, err := s.channelManagers[workerID].GetChannel()
+	if err != nil || ch == nil {
+		return fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	for _, delay := range s.retryDelays() {
+		_, err := ch.QueueDeclare(
+			RetryQueueName(s.opts.QueueName, delay),
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": s.opts.QueueName,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue for %s: %w", delay, err)
+		}
+	}
+
+	return nil
+}
+
+// republishWithDelay moves the message to the retry tier of its next attempt.
+// The original is acked only after the broker confirmed the copy and did not
+// return it as unroutable, otherwise it is requeued, so neither a crash nor a
+// deleted retry queue loses the message.
+func (s *Subscriber) republishWithDelay(workerID int, msg *amqp.Delivery, retryCount int) error {
+	if msg.Headers == nil {
+		msg.Headers = make(amqp.Table)
+	}
+	msg.Headers["x-retry-count"] = retryCount
+
+	delay := retryTierDelay(s.opts, retryCount)
+	queueName := RetryQueueName(s.opts.QueueName, delay)
+
+	publishing := amqp.Publishing{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		// Expiration is left out, a shorter per-message TTL would cut the delay
+		MessageId: msg.MessageId,
+		Timestamp: msg.Timestamp,
+		Type:      msg.Type,
+		UserId:    msg.UserId,
+		AppId:     msg.AppId,
+		Body:      msg.Body,
+	}
+
+	// returns are matched by message id, copies without one get it here
+	if publishing.MessageId == "" {
+		id, err := gonanoid.New()
+		if err != nil {
+			return fmt.Errorf("failed to generate message id: %w", err)
+		}
+		publishing.MessageId = id
+	}
+
+	if err := s.publishRetry(workerID, queueName, publishing); err != nil {
+		if errors.Is(err, ErrUnroutable) {
+			// the tier queue is gone, declare it again for the redelivery
+			if declareErr := s.declareRetryQueues(workerID); declareErr != nil {
+				logger.Error.Printf("Failed to redeclare retry queues of %s: %v", s.opts.QueueName, declareErr)
+			}
+		}
+		if !s.opts.AutoAck {
+			if nackErr := msg.Nack(false, true); nackErr != nil {
+				logger.Error.Printf("Failed to requeue message after retry publish failure: %v", nackErr)
+			}
+		}
+		return err
+	}
+
+	retriedTotal.Inc(s.opts.QueueName)
+	logger.Info.Printf("Scheduled retry %d in %s via %s", retryCount, delay, queueName)
+
+	if !s.opts.AutoAck {
+		if ackErr := msg.Ack(false); ackErr != nil {
+			return fmt.Errorf("failed to acknowledge original message: %w", ackErr)
+		}
+	}
+
+	return nil
+}
+
+func (s *Subscriber) publishRetry(workerID int, queueName string, publishing amqp.Publishing) error {
+	ch, err := s.channelManagers[workerID].GetChannel()
+	if err != nil || ch == nil {
+		return fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, retryConfirmTimeout)
+	defer cancel()
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",
+		queueName,
+		true,
+		false,
+		publishing,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish to retry queue %s: %w", queueName, err)
+	}
+
+	// nil when the channel is not in confirm mode
+	if confirm == nil {
+		return nil
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for retry publish confirm: %w", err)
+	}
+	// the broker acks a returned message too, after the return
+	if r, ok := s.returns[workerID].take(publishing.MessageId); ok {
+		return fmt.Errorf("retry publish to %s: %w: %d %s", queueName, ErrUnroutable, r.ReplyCode, r.ReplyText)
+	}
+	if !acked {
+		return fmt.Errorf("retry publish to %s was nacked by the broker", queueName)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryTiersCoverEveryAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy RetryStrategy
+		base     time.Duration
+		max      time.Duration
+	}{
+		{"no delay", FixedRetry, 0, 10 * time.Second},
+		{"no max delay", ExponentialRetry, time.Second, 0},
+		{"under a millisecond", LinearRetry, 300 * time.Microsecond, time.Second},
+		{"fractional milliseconds", LinearRetry, 1500 * time.Microsecond, time.Second},
+		{"capped", ExponentialRetry, time.Second, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultSubscribeOptions("orders", false)
+			opts.RetryStrategy = tt.strategy
+			opts.BaseRetryDelay = tt.base
+			opts.MaxRetryDelay = tt.max
+			s := &Subscriber{opts: opts}
+
+			declared := make(map[string]bool)
+			for _, delay := range s.retryDelays() {
+				if delay < time.Millisecond {
+					t.Errorf("tier of %s, x-message-ttl must be at least 1ms", delay)
+				}
+				declared[RetryQueueName(opts.QueueName, delay)] = true
+			}
+
+			// a copy published to an undeclared tier returns as unroutable
+			// and loops back to the work queue forever
+			for attempt := 1; attempt <= opts.MaxRetryAttempts; attempt++ {
+				if name := RetryQueueName(opts.QueueName, retryTierDelay(opts, attempt)); !declared[name] {
+					t.Errorf("attempt %d publishes to undeclared %s", attempt, name)
+				}
+			}
+		})
+	}
+}
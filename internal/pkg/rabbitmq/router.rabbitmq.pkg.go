@@ -0,0 +1,256 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// VersionHeader carries the schema version of the message data, messages
+// without it are version 1
+const VersionHeader = "x-schema-version"
+
+// ErrNoHandler is returned for messages whose pattern has no handler
+var ErrNoHandler = errors.New("no handler for message pattern")
+
+// Upcaster converts the data of a message from one schema version to the next
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// envelope is the wire format shared by RPCBody (pattern) and PubsubBody
+// (type), the same one the NestJS microservices send
+type envelope struct {
+	Pattern string          `json:"pattern,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Data    json.RawMessage `json:"data"`
+	ID      string          `json:"id,omitempty"`
+}
+
+// parseEnvelope reports false when the body is not a JSON envelope, e.g. the
+// raw payload published by Message.GeneratePayload
+func parseEnvelope(msg *amqp.Delivery) (*envelope, bool) {
+	if !isJSON(msg.ContentType) {
+		return nil, false
+	}
+
+	var env envelope
+	if err := json.Unmarshal(msg.Body, &env); err != nil {
+		return nil, false
+	}
+	if env.Data == nil || (env.Pattern == "" && env.Type == "") {
+		return nil, false
+	}
+	return &env, true
+}
+
+func (e *envelope) pattern() string {
+	if e.Pattern != "" {
+		return e.Pattern
+	}
+	return e.Type
+}
+
+func isJSON(contentType string) bool {
+	return contentType == "" || strings.Contains(contentType, "json")
+}
+
+// Pattern returns the routing pattern of a message: the pattern or type of the
+// envelope, otherwise the AMQP type property or the pattern header
+func Pattern(msg *amqp.Delivery) string {
+	if env, ok := parseEnvelope(msg); ok {
+		return env.pattern()
+	}
+	if msg.Type != "" {
+		return msg.Type
+	}
+	pattern, _ := msg.Headers["pattern"].(string)
+	return pattern
+}
+
+// Version returns the schema version of the message data
+func Version(msg *amqp.Delivery) int {
+	switch v := msg.Headers[VersionHeader].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 1
+}
+
+// Decode decodes the message data into T by content type. JSON envelopes are
+// unwrapped to their data, text and binary bodies decode into string or []byte.
+func Decode[T any](msg *amqp.Delivery) (T, error) {
+	var data T
+
+	switch v := any(&data).(type) {
+	case *[]byte:
+		*v = msg.Body
+		return data, nil
+	case *string:
+		if !isJSON(msg.ContentType) {
+			*v = string(msg.Body)
+			return data, nil
+		}
+	}
+
+	if !isJSON(msg.ContentType) {
+		return data, fmt.Errorf("cannot decode %s message into %T", msg.ContentType, data)
+	}
+
+	body := msg.Body
+	if env, ok := parseEnvelope(msg); ok {
+		body = env.Data
+	}
+
+	if err := json.Unmarshal(body, &data); err != nil {
+		return data, fmt.Errorf("failed to decode message into %T: %w", data, err)
+	}
+	return data, nil
+}
+
+// Handle adapts a typed handler to a MessageHandler
+func Handle[T any](fn func(data T, msg *amqp.Delivery) (interface{}, error)) MessageHandler {
+	return func(msg *amqp.Delivery) (interface{}, error) {
+		data, err := Decode[T](msg)
+		if err != nil {
+			return nil, err
+		}
+		return fn(data, msg)
+	}
+}
+
+// Router dispatches messages to the handler registered for their pattern,
+// after upcasting their data to the latest schema version and running the
+// middleware chain
+type Router struct {
+	mu          sync.RWMutex
+	handlers    map[string]MessageHandler
+	upcasters   map[string]map[int]Upcaster
+	middlewares []Middleware
+	fallback    MessageHandler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		handlers:  make(map[string]MessageHandler),
+		upcasters: make(map[string]map[int]Upcaster),
+	}
+}
+
+// Handle registers the handler of pattern, e.g. Handle("payment.paid", Handle(onPaid))
+func (r *Router) Handle(pattern string, handler MessageHandler) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[pattern] = handler
+	return r
+}
+
+// Fallback handles messages of unknown patterns instead of failing them
+func (r *Router) Fallback(handler MessageHandler) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fallback = handler
+	return r
+}
+
+// Upcast registers the conversion of pattern data from version to version+1.
+// Upcasters are chained, so a version 1 message passes through every one.
+func (r *Router) Upcast(pattern string, version int, upcaster Upcaster) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.upcasters[pattern] == nil {
+		r.upcasters[pattern] = make(map[int]Upcaster)
+	}
+	r.upcasters[pattern][version] = upcaster
+	return r
+}
+
+// Use appends middlewares, the first one wraps all others
+func (r *Router) Use(middlewares ...Middleware) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.middlewares = append(r.middlewares, middlewares...)
+	return r
+}
+
+// Handler returns the MessageHandler to subscribe with
+func (r *Router) Handler() MessageHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return Chain(r.dispatch, r.middlewares...)
+}
+
+func (r *Router) dispatch(msg *amqp.Delivery) (interface{}, error) {
+	pattern := Pattern(msg)
+
+	r.mu.RLock()
+	handler, ok := r.handlers[pattern]
+	fallback := r.fallback
+	upcasters := r.upcasters[pattern]
+	r.mu.RUnlock()
+
+	if !ok {
+		if fallback == nil {
+			return nil, fmt.Errorf("%w %q", ErrNoHandler, pattern)
+		}
+		handler = fallback
+	}
+
+	if len(upcasters) > 0 {
+		if err := upcast(msg, upcasters); err != nil {
+			return nil, fmt.Errorf("failed to upcast %s: %w", pattern, err)
+		}
+	}
+
+	return handler(msg)
+}
+
+// upcast rewrites the message data and version header to the latest version
+func upcast(msg *amqp.Delivery, upcasters map[int]Upcaster) error {
+	version := Version(msg)
+	if upcasters[version] == nil {
+		return nil
+	}
+
+	env, wrapped := parseEnvelope(msg)
+	data := json.RawMessage(msg.Body)
+	if wrapped {
+		data = env.Data
+	}
+
+	for up := upcasters[version]; up != nil; up = upcasters[version] {
+		next, err := up(data)
+		if err != nil {
+			return fmt.Errorf("version %d: %w", version, err)
+		}
+		data = next
+		version++
+	}
+
+	body := []byte(data)
+	if wrapped {
+		env.Data = data
+		var err error
+		if body, err = json.Marshal(env); err != nil {
+			return err
+		}
+	}
+
+	msg.Body = body
+	if msg.Headers == nil {
+		msg.Headers = make(amqp.Table)
+	}
+	msg.Headers[VersionHeader] = version
+	return nil
+}
@@ -0,0 +1,131 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DirectReplyTo is the pseudo queue RabbitMQ routes RPC replies through to the
+// consumer on the publishing channel, without declaring a reply queue
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+// ErrReplyChannelClosed is returned to RPC calls whose channel closed before
+// the reply arrived, the reply can no longer be delivered
+var ErrReplyChannelClosed = errors.New("rpc reply channel closed")
+
+// rpcCall is one in-flight RPC waiting for its reply
+type rpcCall struct {
+	reply      chan amqp.Delivery
+	generation int
+}
+
+// rpcClient matches replies to in-flight calls by correlation id. One reply
+// consumer runs per publisher channel and is started again on every new channel.
+type rpcClient struct {
+	mu         sync.Mutex
+	pending    map[string]*rpcCall
+	generation int
+}
+
+func newRPCClient() *rpcClient {
+	return &rpcClient{pending: make(map[string]*rpcCall)}
+}
+
+// watch is a channel setup hook, the reply consumer must be on the channel
+// the requests are published on
+func (c *rpcClient) watch(ch *amqp.Channel) error {
+	deliveries, err := ch.Consume(DirectReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %w", DirectReplyTo, err)
+	}
+
+	c.mu.Lock()
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+
+	go c.dispatch(deliveries, generation)
+	return nil
+}
+
+func (c *rpcClient) dispatch(deliveries <-chan amqp.Delivery, generation int) {
+	for d := range deliveries {
+		c.mu.Lock()
+		call, ok := c.pending[d.CorrelationId]
+		delete(c.pending, d.CorrelationId)
+		c.mu.Unlock()
+
+		if !ok {
+			logger.Warning.Printf("Dropping RPC reply %s, the call already returned", d.CorrelationId)
+			continue
+		}
+		call.reply <- d
+	}
+
+	// The channel is gone, fail the calls published on it
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, call := range c.pending {
+		if call.generation == generation {
+			close(call.reply)
+			delete(c.pending, id)
+		}
+	}
+}
+
+func (c *rpcClient) register(correlationID string) *rpcCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	call := &rpcCall{reply: make(chan amqp.Delivery, 1), generation: c.generation}
+	c.pending[correlationID] = call
+	return call
+}
+
+func (c *rpcClient) cancel(correlationID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, correlationID)
+}
+
+// call publishes the request and waits for its reply until ctx is done.
+// Requests are mandatory, so a pattern no service consumes fails at once
+// with ErrUnroutable instead of waiting for the timeout.
+func (p *Publisher) call(ctx context.Context, msg *Message, opts *PublishOptions) (*RPCResponse, error) {
+	if _, err := p.channelManager.GetChannel(); err != nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	payload := msg.GenerateRPCPayload(DirectReplyTo, opts.Pattern)
+	call := p.rpc.register(payload.CorrelationId)
+
+	rpcOpts := *opts
+	rpcOpts.Mandatory = true
+	if err := p.publishMessage(ctx, &rpcOpts, payload); err != nil {
+		p.rpc.cancel(payload.CorrelationId)
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		p.rpc.cancel(payload.CorrelationId)
+		return nil, fmt.Errorf("rpc %s: %w", opts.Pattern, ctx.Err())
+	case reply, ok := <-call.reply:
+		if !ok {
+			return nil, ErrReplyChannelClosed
+		}
+
+		var response RPCResponse
+		if err := json.Unmarshal(reply.Body, &response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		return &response, nil
+	}
+}
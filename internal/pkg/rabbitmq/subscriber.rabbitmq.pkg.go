@@ -42,6 +42,8 @@ type SubscribeOptions struct {
 	RetryStrategy    RetryStrategy // Strategy for retry delays
 	BaseRetryDelay   time.Duration // Base delay for retries (depends on strategy)
 	MaxRetryDelay    time.Duration // Maximum delay for retries
+	Topology         *Topology     // Exchanges and bindings of the queue, declared on every connect
+	DrainTimeout     time.Duration // Time in-flight messages get to finish on Stop
 }
 
 func DefaultSubscribeOptions(queueName string, isRPC bool) *SubscribeOptions {
@@ -60,10 +62,12 @@ func DefaultSubscribeOptions(queueName string, isRPC bool) *SubscribeOptions {
 		IsRPC:            isRPC,
 		MaxRetryAttempts: 5,
 		EnableDeadLetter: true,
-		DeadLetterName:   "fail:" + queueName,
+		DeadLetterName:   DeadLetterQueueName(queueName),
 		RetryStrategy:    FixedRetry,
 		BaseRetryDelay:   time.Second * 5,
 		MaxRetryDelay:    time.Minute * 10,
+		Topology:         nil,
+		DrainTimeout:     time.Second * 30,
 	}
 
 	if isRPC {
@@ -77,15 +81,17 @@ func DefaultSubscribeOptions(queueName string, isRPC bool) *SubscribeOptions {
 type Subscriber struct {
 	connManager     *ConnectionManager
 	channelManagers []*ChannelManager
-	handler         MessageHandler
-	opts            *SubscribeOptions
-	ctx             context.Context
-	cancel          context.CancelFunc
-	wg              sync.WaitGroup
-	isRunning       atomic.Bool
-	pool            *ants.Pool
-	mu              sync.RWMutex
-	msgChan         chan *amqp.Delivery
+	// returns of the mandatory retry publishes, one per worker channel
+	returns   []*returnTracker
+	handler   MessageHandler
+	opts      *SubscribeOptions
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	isRunning atomic.Bool
+	pool      *ants.Pool
+	mu        sync.RWMutex
+	msgChan   chan *amqp.Delivery
 }
 
 func NewSubscriber(ctx context.Context, connManager *ConnectionManager, handler MessageHandler, opts *SubscribeOptions) (*Subscriber, error) {
@@ -113,12 +119,19 @@ func NewSubscriber(ctx context.Context, connManager *ConnectionManager, handler
 		ctx:             ctx,
 		cancel:          cancel,
 		channelManagers: make([]*ChannelManager, opts.WorkerCount),
+		returns:         make([]*returnTracker, opts.WorkerCount),
 		pool:            pool,
 		msgChan:         make(chan *amqp.Delivery, opts.MessageBuffer),
 	}
 
 	for i := 0; i < opts.WorkerCount; i++ {
 		sub.channelManagers[i] = NewChannelManager(ctx, connManager)
+		sub.returns[i] = newReturnTracker()
+		if err := sub.channelManagers[i].AddSetupHook(sub.returns[i].watch); err != nil {
+			cancel()
+			pool.Release()
+			return nil, fmt.Errorf("failed to watch returned messages: %w", err)
+		}
 	}
 
 	return sub, nil
@@ -144,22 +157,7 @@ func (s *Subscriber) declareQueue(name string, workerID int, config *QueueConfig
 		return nil, fmt.Errorf("failed to set QoS: %w", err)
 	}
 
-	if config == nil {
-		config = DefaultQueueConfig()
-	}
-
-	if config.Args == nil {
-		config.Args = make(amqp.Table)
-	}
-
-	reply, err := ch.QueueDeclare(
-		queueName,
-		config.Durable,
-		config.AutoDelete,
-		config.Exclusive,
-		config.NoWait,
-		config.Args,
-	)
+	reply, err := queueDeclare(s.connManager, ch, queueName, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to declare queue: %w", err)
 	}
@@ -190,6 +188,9 @@ func (s *Subscriber) Start() error {
 func (s *Subscriber) runWorker(workerID int) {
 	defer s.wg.Done()
 
+	consumerWorkers.Inc(s.opts.QueueName)
+	defer consumerWorkers.Dec(s.opts.QueueName)
+
 	backoff := &exponentialBackoff{
 		min:    1 * time.Second,
 		max:    30 * time.Second,
@@ -267,13 +268,31 @@ func (s *Subscriber) consume(workerID int) error {
 	if err != nil {
 		return fmt.Errorf("failed to create message processor pool: %w", err)
 	}
-	defer messagePool.Release()
+	// Stop cancels the consumer, wait for the messages already being handled
+	// so they are acked before the channel closes
+	defer func() {
+		drainTimeout := s.opts.DrainTimeout
+		if drainTimeout <= 0 {
+			drainTimeout = time.Second * 30
+		}
+		if err := messagePool.ReleaseTimeout(drainTimeout); err != nil {
+			logger.Warning.Printf("Worker %d stopped before its in-flight messages finished: %v\n", workerID, err)
+		}
+	}()
 
 	q, err := s.declareQueue(s.opts.QueueName, workerID, s.opts.QueueOpts)
 	if err != nil {
 		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
+	if err := s.opts.Topology.declare(ch, q.Name); err != nil {
+		return fmt.Errorf("failed to declare topology: %w", err)
+	}
+
+	if err := s.declareRetryQueues(workerID); err != nil {
+		return fmt.Errorf("failed to declare retry queues: %w", err)
+	}
+
 	consumerName := fmt.Sprintf("%s-%d-%d", s.opts.ConsumerName, workerID, time.Now().Unix())
 	msgs, err := ch.ConsumeWithContext(
 		s.ctx,
@@ -298,11 +317,14 @@ func (s *Subscriber) consume(workerID int) error {
 		default:
 			// Copy message to avoid closure issues
 			msgCopy := msg
+			meter(&msgCopy, s.opts.QueueName)
+			consumedTotal.Inc(s.opts.QueueName)
 
 			// Submit to pool (blocking, will wait if pool is full)
 			err := messagePool.Submit(func() {
 				// Add timeout for message processing
-				ctx, cancel := context.WithTimeout(s.ctx, 25*time.Minute) // Less than RabbitMQ timeout (30 min)
+				// Not canceled by Stop, a draining message must not be nacked
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(s.ctx), 25*time.Minute) // Less than RabbitMQ timeout (30 min)
 				defer cancel()
 
 				done := make(chan error, 1)
@@ -337,10 +359,20 @@ func (s *Subscriber) consume(workerID int) error {
 }
 
 func (s *Subscriber) processMessage(workerID int, msg *amqp.Delivery) error {
-	deliveryCount := s.getDeliveryCount(msg)
+	deliveryCount := deliveryCount(msg)
 
+	inFlightMessages.Inc(s.opts.QueueName)
+	defer inFlightMessages.Dec(s.opts.QueueName)
+
+	start := time.Now()
 	response, err := s.handler(msg)
 
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	handlerDuration.ObserveSince(start, s.opts.QueueName, outcome)
+
 	if err != nil {
 		return s.handleProcessingError(workerID, msg, err, deliveryCount)
 	}
@@ -348,7 +380,8 @@ func (s *Subscriber) processMessage(workerID int, msg *amqp.Delivery) error {
 	return s.handleSuccessfulProcessing(workerID, msg, response)
 }
 
-func (s *Subscriber) getDeliveryCount(msg *amqp.Delivery) int {
+// deliveryCount is the number of times msg was handled before
+func deliveryCount(msg *amqp.Delivery) int {
 	deliveryCount := 0
 	if msg.Headers != nil {
 		if count, exists := msg.Headers["x-retry-count"]; exists {
@@ -454,72 +487,6 @@ func (s *Subscriber) handleSuccessfulProcessing(workerID int, msg *amqp.Delivery
 	return nil
 }
 
-func (s *Subscriber) republishWithDelay(workerID int, msg *amqp.Delivery, retryCount int) error {
-	msg.Headers["x-retry-count"] = retryCount
-
-	delay := s.calculateRetryDelay(retryCount)
-	delayMs := int64(delay / time.Millisecond)
-
-	publishing := amqp.Publishing{
-		Headers:         msg.Headers,
-		ContentType:     msg.ContentType,
-		ContentEncoding: msg.ContentEncoding,
-		DeliveryMode:    msg.DeliveryMode,
-		Priority:        msg.Priority,
-		CorrelationId:   msg.CorrelationId,
-		ReplyTo:         msg.ReplyTo,
-		Expiration:      msg.Expiration,
-		MessageId:       msg.MessageId,
-		Timestamp:       msg.Timestamp,
-		Type:            msg.Type,
-		UserId:          msg.UserId,
-		AppId:           msg.AppId,
-		Body:            msg.Body,
-	}
-	logger.Info.Printf("Scheduling retry with %dms delay using time-based retry", delayMs)
-
-	if !s.opts.AutoAck {
-		if ackErr := msg.Ack(false); ackErr != nil {
-			return fmt.Errorf("failed to acknowledge original message: %w", ackErr)
-		}
-	}
-
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-
-		timer := time.NewTimer(delay)
-		select {
-		case <-timer.C:
-		case <-s.ctx.Done():
-			if !timer.Stop() {
-				<-timer.C
-			}
-			return
-		}
-
-		ch, err := s.channelManagers[workerID].GetChannel()
-		if err != nil {
-			logger.Error.Printf("Failed to get channel after delay: %v", err)
-			return
-		}
-
-		err = ch.PublishWithContext(
-			s.ctx,
-			"",
-			s.opts.QueueName,
-			true,
-			false,
-			publishing,
-		)
-		if err != nil {
-			logger.Error.Printf("Failed to republish message after delay: %v", err)
-		}
-	}()
-
-	return nil
-}
-
 func (s *Subscriber) publishToDeadLetter(workerID int, msg *amqp.Delivery, err error) error {
 	ch, err2 := s.channelManagers[workerID].GetChannel()
 
@@ -565,10 +532,7 @@ func (s *Subscriber) publishToDeadLetter(workerID int, msg *amqp.Delivery, err e
 		return fmt.Errorf("failed to get channel for dead letter: %w", err2)
 	}
 
-	msg.Headers["x-death-reason"] = err.Error()
-	msg.Headers["x-death-time"] = time.Now().Format(time.RFC3339)
-	msg.Headers["x-death-queue"] = s.opts.QueueName
-	msg.Headers["x-death-max-retries"] = s.opts.MaxRetryAttempts
+	msg.Headers = markDead(msg.Headers, s.opts, err)
 
 	retryCount := 0
 	if count, exists := msg.Headers["x-retry-count"]; exists {
@@ -612,6 +576,7 @@ func (s *Subscriber) publishToDeadLetter(workerID int, msg *amqp.Delivery, err e
 		return fmt.Errorf("failed to publish to dead letter exchange: %w", err2)
 	}
 
+	deadLetteredTotal.Inc(s.opts.QueueName)
 	logger.Info.Printf("Successfully published failed message to dead letter queue after %d retries", retryCount)
 	return nil
 }
@@ -670,30 +635,31 @@ func (s *Subscriber) sendReply(workerID int, delivery *amqp.Delivery, msg *Messa
 	return nil
 }
 
-func (s *Subscriber) calculateRetryDelay(retryCount int) time.Duration {
+// retryDelay is the wait before attempt retryCount of a failed message
+func retryDelay(opts *SubscribeOptions, retryCount int) time.Duration {
 	var delay time.Duration
 
-	switch s.opts.RetryStrategy {
+	switch opts.RetryStrategy {
 	case FixedRetry:
-		delay = s.opts.BaseRetryDelay
+		delay = opts.BaseRetryDelay
 	case LinearRetry:
-		delay = s.opts.BaseRetryDelay * time.Duration(retryCount)
+		delay = opts.BaseRetryDelay * time.Duration(retryCount)
 	case ExponentialRetry:
 		multiplier := 1
 		for i := 0; i < retryCount; i++ {
 			multiplier *= 2
 		}
-		delay = s.opts.BaseRetryDelay * time.Duration(multiplier)
+		delay = opts.BaseRetryDelay * time.Duration(multiplier)
 	default:
 		multiplier := 1
 		for i := 0; i < retryCount; i++ {
 			multiplier *= 2
 		}
-		delay = s.opts.BaseRetryDelay * time.Duration(multiplier)
+		delay = opts.BaseRetryDelay * time.Duration(multiplier)
 	}
 
-	if delay > s.opts.MaxRetryDelay {
-		delay = s.opts.MaxRetryDelay
+	if delay > opts.MaxRetryDelay {
+		delay = opts.MaxRetryDelay
 	}
 
 	return delay
@@ -0,0 +1,136 @@
+package rabbitmq
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type ExchangeKind string
+
+const (
+	DirectExchange  ExchangeKind = amqp.ExchangeDirect
+	TopicExchange   ExchangeKind = amqp.ExchangeTopic
+	FanoutExchange  ExchangeKind = amqp.ExchangeFanout
+	HeadersExchange ExchangeKind = amqp.ExchangeHeaders
+)
+
+type ExchangeConfig struct {
+	Name       string
+	Kind       ExchangeKind
+	Durable    bool
+	AutoDelete bool
+	Internal   bool // Only reachable through exchange-to-exchange bindings
+	NoWait     bool
+	Args       amqp.Table
+}
+
+// QueueBinding routes messages of Exchange to Queue. RoutingKey is a pattern
+// for topic exchanges (payment.*, order.#) and ignored by fanout exchanges.
+// Headers exchanges match on Args instead, e.g. {"x-match": "all", "type": "paid"}.
+type QueueBinding struct {
+	Queue      string // Empty binds the queue of the subscriber
+	Exchange   string
+	RoutingKey string
+	NoWait     bool
+	Args       amqp.Table
+}
+
+// ExchangeBinding routes messages of Source to Destination
+type ExchangeBinding struct {
+	Destination string
+	Source      string
+	RoutingKey  string
+	NoWait      bool
+	Args        amqp.Table
+}
+
+// Topology is the set of exchanges and bindings a publisher or subscriber
+// needs. Every declaration is idempotent, so it is safely declared again on
+// each (re)connect.
+type Topology struct {
+	Exchanges        []ExchangeConfig
+	ExchangeBindings []ExchangeBinding
+	QueueBindings    []QueueBinding
+}
+
+func DefaultExchangeConfig(name string, kind ExchangeKind) ExchangeConfig {
+	return ExchangeConfig{
+		Name:       name,
+		Kind:       kind,
+		Durable:    true,
+		AutoDelete: false,
+		Internal:   false,
+		NoWait:     false,
+		Args:       nil,
+	}
+}
+
+// Declare declares the exchanges, then the exchange-to-exchange bindings and
+// the queue bindings. The bound queues must already exist.
+func (t *Topology) Declare(ch *amqp.Channel) error {
+	return t.declare(ch, "")
+}
+
+// declare binds the queue bindings without a queue to defaultQueue
+func (t *Topology) declare(ch *amqp.Channel, defaultQueue string) error {
+	if t == nil {
+		return nil
+	}
+
+	for _, ex := range t.Exchanges {
+		kind := ex.Kind
+		if kind == "" {
+			kind = DirectExchange
+		}
+
+		err := ch.ExchangeDeclare(
+			ex.Name,
+			string(kind),
+			ex.Durable,
+			ex.AutoDelete,
+			ex.Internal,
+			ex.NoWait,
+			ex.Args,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare exchange %s: %w", ex.Name, err)
+		}
+	}
+
+	for _, b := range t.ExchangeBindings {
+		err := ch.ExchangeBind(
+			b.Destination,
+			b.RoutingKey,
+			b.Source,
+			b.NoWait,
+			b.Args,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to bind exchange %s to %s: %w", b.Destination, b.Source, err)
+		}
+	}
+
+	for _, b := range t.QueueBindings {
+		queue := b.Queue
+		if queue == "" {
+			queue = defaultQueue
+		}
+		if queue == "" {
+			return fmt.Errorf("queue binding on exchange %s has no queue", b.Exchange)
+		}
+
+		err := ch.QueueBind(
+			queue,
+			b.RoutingKey,
+			b.Exchange,
+			b.NoWait,
+			b.Args,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to bind queue %s to %s: %w", queue, b.Exchange, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	_redis "github.com/redis/go-redis/v9"
+)
+
+// newClient builds the go-redis client of the mode, it does not connect yet
+func newClient(config *Config) (_redis.UniversalClient, error) {
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Mode {
+	case "", ModeSingle:
+		return _redis.NewClient(&_redis.Options{
+			Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
+			Username:     config.Username,
+			Password:     config.Password,
+			DB:           config.DB,
+			PoolSize:     config.PoolSize,
+			TLSConfig:    tlsConfig,
+			DialTimeout:  config.DialTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+		}), nil
+
+	case ModeSentinel:
+		if config.MasterName == "" || len(config.Addrs) == 0 {
+			return nil, errors.New("redis sentinel mode needs a master name and sentinel addresses")
+		}
+		return _redis.NewFailoverClient(&_redis.FailoverOptions{
+			MasterName:       config.MasterName,
+			SentinelAddrs:    config.Addrs,
+			SentinelUsername: config.SentinelUsername,
+			SentinelPassword: config.SentinelPassword,
+			Username:         config.Username,
+			Password:         config.Password,
+			DB:               config.DB,
+			PoolSize:         config.PoolSize,
+			TLSConfig:        tlsConfig,
+			DialTimeout:      config.DialTimeout,
+			ReadTimeout:      config.ReadTimeout,
+			WriteTimeout:     config.WriteTimeout,
+		}), nil
+
+	case ModeCluster:
+		if len(config.Addrs) == 0 {
+			return nil, errors.New("redis cluster mode needs seed node addresses")
+		}
+		return _redis.NewClusterClient(&_redis.ClusterOptions{
+			Addrs:        config.Addrs,
+			Username:     config.Username,
+			Password:     config.Password,
+			PoolSize:     config.PoolSize,
+			TLSConfig:    tlsConfig,
+			DialTimeout:  config.DialTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("unknown redis mode %q", config.Mode)
+}
+
+func (c *TLSConfig) build() (*tls.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// ParseAddrs splits a comma separated list of host:port
+func ParseAddrs(value string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"strings"
+
+	_redis "github.com/redis/go-redis/v9"
+)
+
+// clusterSlots is the number of hash slots of a Redis Cluster
+const clusterSlots = 16384
+
+// isCluster tells whether keys of one command must share a hash slot
+func (r *Client) isCluster() bool {
+	_, ok := r.Client.(*_redis.ClusterClient)
+	return ok
+}
+
+// slotGroups splits keys by hash slot in cluster mode, so a multi-key command
+// can be sent once per slot instead of failing with CROSSSLOT. Outside a
+// cluster every key is in the one group.
+func (r *Client) slotGroups(keys []string) [][]string {
+	if !r.isCluster() {
+		return [][]string{keys}
+	}
+
+	var groups [][]string
+	index := make(map[uint16]int)
+	for _, key := range keys {
+		slot := keySlot(key)
+		i, ok := index[slot]
+		if !ok {
+			i = len(groups)
+			index[slot] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], key)
+	}
+	return groups
+}
+
+// keySlot is the cluster slot of key, only its hash tag counts when it has one
+func keySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % clusterSlots
+}
+
+// crc16 is the CRC-16/XMODEM checksum Redis Cluster hashes keys with
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,344 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_redis "github.com/redis/go-redis/v9"
+)
+
+// incrByScript sets the expiration only when the increment created the key,
+// so a counter window is not extended by every hit
+var incrByScript = NewScript(`
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and value == tonumber(ARGV[1]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// SetWithContext stores value JSON encoded, like Set
+func (r *Client) SetWithContext(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode key %s: %w", key, err)
+	}
+	if err := r.Client.Set(ctx, key, data, expiration).Err(); err != nil {
+		return fmt.Errorf("failed to set key %s: %w", key, err)
+	}
+	return nil
+}
+
+// GetWithContext returns "" without error when the key does not exist
+func (r *Client) GetWithContext(ctx context.Context, key string) (string, error) {
+	result, err := r.Client.Get(ctx, key).Result()
+	if errors.Is(err, NilType) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get key %s: %w", key, err)
+	}
+	return result, nil
+}
+
+// DelWithContext deletes the keys, in cluster mode with one DEL per slot
+func (r *Client) DelWithContext(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err := r.Client.Pipelined(ctx, func(pipe _redis.Pipeliner) error {
+		for _, group := range r.slotGroups(keys) {
+			pipe.Del(ctx, group...)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete keys %v: %w", keys, err)
+	}
+	return nil
+}
+
+func (r *Client) ExpireWithContext(ctx context.Context, key string, expiration time.Duration) error {
+	if err := r.Client.Expire(ctx, key, expiration).Err(); err != nil {
+		return fmt.Errorf("failed to set expiration on key %s: %w", key, err)
+	}
+	return nil
+}
+
+// SetNX stores value JSON encoded only if key does not exist, it reports
+// whether the value was set
+func (r *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode key %s: %w", key, err)
+	}
+	ok, err := r.Client.SetNX(ctx, key, data, expiration).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to set key %s: %w", key, err)
+	}
+	return ok, nil
+}
+
+// Incr adds one to key, see IncrBy
+func (r *Client) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	return r.IncrBy(ctx, key, 1, expiration)
+}
+
+// IncrBy adds delta to key. A key created by the increment expires after
+// expiration, 0 keeps it; the expiration of an existing key is left as is.
+func (r *Client) IncrBy(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	if expiration <= 0 {
+		value, err := r.Client.IncrBy(ctx, key, delta).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to increment key %s: %w", key, err)
+		}
+		return value, nil
+	}
+
+	value, err := incrByScript.Run(ctx, r.Client, []string{key}, delta, expiration.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment key %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// MGet returns the values of the keys that exist. In cluster mode it sends
+// one MGET per slot, pipelined.
+func (r *Client) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return map[string]string{}, nil
+	}
+
+	groups := r.slotGroups(keys)
+	cmds := make([]*_redis.SliceCmd, len(groups))
+	_, err := r.Client.Pipelined(ctx, func(pipe _redis.Pipeliner) error {
+		for i, group := range groups {
+			cmds[i] = pipe.MGet(ctx, group...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get keys %v: %w", keys, err)
+	}
+
+	result := make(map[string]string, len(keys))
+	for i, cmd := range cmds {
+		for j, value := range cmd.Val() {
+			if s, ok := value.(string); ok {
+				result[groups[i][j]] = s
+			}
+		}
+	}
+	return result, nil
+}
+
+// MSet stores every value JSON encoded, like Set, in one transaction. In
+// cluster mode it sends one MSET per slot in a plain pipeline, so it is only
+// atomic for keys sharing a hash tag.
+func (r *Client) MSet(ctx context.Context, values map[string]interface{}, expiration time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(values))
+	encoded := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode key %s: %w", key, err)
+		}
+		keys = append(keys, key)
+		encoded[key] = data
+	}
+
+	pipelined := r.Client.TxPipelined
+	if r.isCluster() {
+		pipelined = r.Client.Pipelined
+	}
+	_, err := pipelined(ctx, func(pipe _redis.Pipeliner) error {
+		for _, group := range r.slotGroups(keys) {
+			pairs := make([]interface{}, 0, len(group)*2)
+			for _, key := range group {
+				pairs = append(pairs, key, encoded[key])
+			}
+			pipe.MSet(ctx, pairs...)
+		}
+		if expiration > 0 {
+			for _, key := range keys {
+				pipe.Expire(ctx, key, expiration)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set keys: %w", err)
+	}
+	return nil
+}
+
+// HSet sets fields of the hash key. Values are stored as go-redis formats
+// them (strings and numbers as is), not JSON encoded, so HIncrBy works on them.
+func (r *Client) HSet(ctx context.Context, key string, values map[string]interface{}) error {
+	if err := r.Client.HSet(ctx, key, values).Err(); err != nil {
+		return fmt.Errorf("failed to set hash %s: %w", key, err)
+	}
+	return nil
+}
+
+// HGet returns "" without error when the field does not exist
+func (r *Client) HGet(ctx context.Context, key, field string) (string, error) {
+	value, err := r.Client.HGet(ctx, key, field).Result()
+	if errors.Is(err, NilType) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get hash %s field %s: %w", key, field, err)
+	}
+	return value, nil
+}
+
+func (r *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	values, err := r.Client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash %s: %w", key, err)
+	}
+	return values, nil
+}
+
+func (r *Client) HDel(ctx context.Context, key string, fields ...string) error {
+	if err := r.Client.HDel(ctx, key, fields...).Err(); err != nil {
+		return fmt.Errorf("failed to delete hash %s fields %v: %w", key, fields, err)
+	}
+	return nil
+}
+
+func (r *Client) HIncrBy(ctx context.Context, key, field string, delta int64) (int64, error) {
+	value, err := r.Client.HIncrBy(ctx, key, field, delta).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment hash %s field %s: %w", key, field, err)
+	}
+	return value, nil
+}
+
+// LPush prepends values and returns the new length of the list
+func (r *Client) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	length, err := r.Client.LPush(ctx, key, values...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to push to list %s: %w", key, err)
+	}
+	return length, nil
+}
+
+// RPush appends values and returns the new length of the list
+func (r *Client) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	length, err := r.Client.RPush(ctx, key, values...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to push to list %s: %w", key, err)
+	}
+	return length, nil
+}
+
+// LPop returns "" without error when the list is empty
+func (r *Client) LPop(ctx context.Context, key string) (string, error) {
+	return pop(r.Client.LPop(ctx, key), key)
+}
+
+// RPop returns "" without error when the list is empty
+func (r *Client) RPop(ctx context.Context, key string) (string, error) {
+	return pop(r.Client.RPop(ctx, key), key)
+}
+
+func pop(cmd *_redis.StringCmd, key string) (string, error) {
+	value, err := cmd.Result()
+	if errors.Is(err, NilType) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to pop from list %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (r *Client) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	values, err := r.Client.LRange(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read list %s: %w", key, err)
+	}
+	return values, nil
+}
+
+func (r *Client) LLen(ctx context.Context, key string) (int64, error) {
+	length, err := r.Client.LLen(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get length of list %s: %w", key, err)
+	}
+	return length, nil
+}
+
+func (r *Client) ZAdd(ctx context.Context, key string, members ...Z) error {
+	if err := r.Client.ZAdd(ctx, key, members...).Err(); err != nil {
+		return fmt.Errorf("failed to add to sorted set %s: %w", key, err)
+	}
+	return nil
+}
+
+func (r *Client) ZIncrBy(ctx context.Context, key string, delta float64, member string) (float64, error) {
+	score, err := r.Client.ZIncrBy(ctx, key, delta, member).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment %s in sorted set %s: %w", member, key, err)
+	}
+	return score, nil
+}
+
+// ZScore reports false without error when member is not in the set
+func (r *Client) ZScore(ctx context.Context, key, member string) (float64, bool, error) {
+	score, err := r.Client.ZScore(ctx, key, member).Result()
+	if errors.Is(err, NilType) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get score of %s in sorted set %s: %w", member, key, err)
+	}
+	return score, true, nil
+}
+
+func (r *Client) ZRangeByScore(ctx context.Context, key string, by *ZRangeBy) ([]string, error) {
+	members, err := r.Client.ZRangeByScore(ctx, key, by).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sorted set %s: %w", key, err)
+	}
+	return members, nil
+}
+
+func (r *Client) ZRem(ctx context.Context, key string, members ...string) error {
+	args := make([]interface{}, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	if err := r.Client.ZRem(ctx, key, args...).Err(); err != nil {
+		return fmt.Errorf("failed to remove from sorted set %s: %w", key, err)
+	}
+	return nil
+}
+
+// ZRemRangeByScore removes the members scored between min and max and
+// returns how many were removed
+func (r *Client) ZRemRangeByScore(ctx context.Context, key, min, max string) (int64, error) {
+	removed, err := r.Client.ZRemRangeByScore(ctx, key, min, max).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove range from sorted set %s: %w", key, err)
+	}
+	return removed, nil
+}
+
+func (r *Client) ZCard(ctx context.Context, key string) (int64, error) {
+	count, err := r.Client.ZCard(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sorted set %s: %w", key, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,26 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GetJSON decodes the value Set or SetJSON stored at key. found is false
+// without error when the key does not exist.
+func GetJSON[T any](ctx context.Context, r IRedis, key string) (value T, found bool, err error) {
+	data, err := r.GetWithContext(ctx, key)
+	if err != nil || data == "" {
+		return value, false, err
+	}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return value, false, fmt.Errorf("failed to decode key %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// SetJSON stores value JSON encoded, the typed counterpart of GetJSON
+func SetJSON[T any](ctx context.Context, r IRedis, key string, value T, expiration time.Duration) error {
+	return r.SetWithContext(ctx, key, value, expiration)
+}
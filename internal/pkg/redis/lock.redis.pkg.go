@@ -0,0 +1,204 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrLockNotAcquired is returned when the lock is held by someone else
+	ErrLockNotAcquired = errors.New("redis: lock not acquired")
+	// ErrLockNotHeld is returned when the lock expired or was taken over
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+var (
+	acquireScript = NewScript(`return redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])`)
+
+	// releaseScript and extendScript only touch the key while it still holds
+	// the caller's token, so an expired holder cannot free someone else's lock
+	releaseScript = NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+	extendScript = NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+)
+
+type LockOptions struct {
+	// TTL bounds how long a crashed holder blocks others
+	TTL time.Duration
+	// RetryDelay is the first wait of Acquire, doubled up to MaxRetryDelay
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Prefix is prepended to every key
+	Prefix string
+}
+
+func DefaultLockOptions() *LockOptions {
+	return &LockOptions{
+		TTL:           30 * time.Second,
+		RetryDelay:    50 * time.Millisecond,
+		MaxRetryDelay: time.Second,
+		Prefix:        "lock:",
+	}
+}
+
+// Locker hands out locks on keys that hold across every instance sharing the
+// Redis server
+type Locker struct {
+	redis IRedis
+	opts  *LockOptions
+}
+
+func NewLocker(r IRedis, opts *LockOptions) *Locker {
+	if opts == nil {
+		opts = DefaultLockOptions()
+	}
+	return &Locker{redis: r, opts: opts}
+}
+
+// Lock is a held lock, identified by a token only its holder knows
+type Lock struct {
+	redis IRedis
+	key   string
+	token string
+	ttl   time.Duration
+}
+
+// TryAcquire takes the lock on key once, failing with ErrLockNotAcquired
+// when it is held
+func (l *Locker) TryAcquire(ctx context.Context, key string) (*Lock, error) {
+	lock := &Lock{
+		redis: l.redis,
+		key:   l.opts.Prefix + key,
+		token: uuid.NewString(),
+		ttl:   l.opts.TTL,
+	}
+
+	result, err := l.redis.RunScript(ctx, acquireScript, []string{lock.key}, lock.token, lock.ttl.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", lock.key, err)
+	}
+	if result == nil {
+		return nil, ErrLockNotAcquired
+	}
+	return lock, nil
+}
+
+// Acquire waits until the lock on key is free or ctx is done, backing off
+// between attempts
+func (l *Locker) Acquire(ctx context.Context, key string) (*Lock, error) {
+	delay := l.opts.RetryDelay
+	for {
+		lock, err := l.TryAcquire(ctx, key)
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return lock, err
+		}
+
+		// jitter keeps waiters from retrying in lockstep
+		wait := delay/2 + rand.N(delay/2+1)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to acquire lock %s: %w", l.opts.Prefix+key, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		if delay *= 2; delay > l.opts.MaxRetryDelay {
+			delay = l.opts.MaxRetryDelay
+		}
+	}
+}
+
+// WithLock runs fn while holding the lock on key. The lock is extended every
+// TTL/3 while fn runs, the ctx given to fn is canceled if it gets lost.
+func (l *Locker) WithLock(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	lock, err := l.Acquire(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		lock.heartbeat(fnCtx, cancel)
+	}()
+
+	fnErr := fn(fnCtx)
+	cancel()
+	<-stopped
+
+	// release even when ctx is done, the lock would block others until TTL
+	releaseCtx, releaseCancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer releaseCancel()
+	if err := lock.Release(releaseCtx); err != nil && fnErr == nil {
+		return err
+	}
+	return fnErr
+}
+
+func (lk *Lock) heartbeat(ctx context.Context, lost context.CancelFunc) {
+	ticker := time.NewTicker(lk.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := lk.Extend(ctx, lk.ttl); err != nil && ctx.Err() == nil {
+				lost()
+				return
+			}
+		}
+	}
+}
+
+// Key is the Redis key of the lock, prefix included
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Token identifies this holder of the lock
+func (lk *Lock) Token() string {
+	return lk.token
+}
+
+// Extend resets the lock's expiration to ttl, failing with ErrLockNotHeld
+// when it expired in the meantime
+func (lk *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	result, err := lk.redis.RunScript(ctx, extendScript, []string{lk.key}, lk.token, ttl.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to extend lock %s: %w", lk.key, err)
+	}
+	if n, _ := result.(int64); n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release frees the lock, failing with ErrLockNotHeld when it expired and
+// may already belong to someone else
+func (lk *Lock) Release(ctx context.Context) error {
+	result, err := lk.redis.RunScript(ctx, releaseScript, []string{lk.key}, lk.token)
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", lk.key, err)
+	}
+	if n, _ := result.(int64); n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
@@ -7,89 +7,115 @@ import (
 	"fmt"
 	"go-boilerplate/internal/pkg/logger"
 	"time"
-
-	_redis "github.com/redis/go-redis/v9"
 )
 
+// disconnectedAfter is how many failed checks in a row mark the connection
+// disconnected
+const disconnectedAfter = 3
+
 func Setup(ctx context.Context, config *Config) (*Client, error) {
-	clientCtx, cancel := context.WithCancel(ctx)
+	client, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
 
+	clientCtx, cancel := context.WithCancel(ctx)
 	r := &Client{
+		Client: client,
 		cancel: cancel,
 		ctx:    clientCtx,
 		config: config,
 	}
 
-	// Connect to IRedis
-	if err := r.connect(); err != nil {
+	if err := r.Client.Ping(r.ctx).Err(); err != nil {
 		cancel() // Ensure cleanup if initialization fails
+		_ = client.Close()
 		logger.Error.Println(err)
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	// Start the reconnect handler
-	go r.reconnectHandler()
+	// go-redis redials broken connections and follows failovers itself, the
+	// monitor only tracks the state for health checks
+	go r.monitor()
 
 	return r, nil
 }
 
-func (r *Client) connect() error {
-	r.Client = _redis.NewClient(&_redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", r.config.Host, r.config.Port),
-		Username: r.config.Username,
-		Password: r.config.Password,
-		PoolSize: r.config.PoolSize,
-	})
-
-	if err := r.Client.Ping(r.ctx).Err(); err != nil {
-		return fmt.Errorf("failed to connect to redis: %w", err)
+func (r *Client) monitor() {
+	interval := r.config.HealthInterval
+	if interval <= 0 {
+		interval = time.Second
 	}
-
-	return nil
-}
-
-func (r *Client) reconnect() error {
-	if err := r.Client.Ping(r.ctx).Err(); err != nil {
-		return r.connect()
-	}
-
-	go r.reconnectHandler()
-	return nil
-}
-
-func (r *Client) reconnectHandler() {
-	ticker := time.NewTicker(1 * time.Second)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-r.ctx.Done():
-			logger.Info.Println("Reconnect handler shutting down...")
+			logger.Info.Println("Redis health monitor shutting down...")
 			return
 		case <-ticker.C:
-			if err := r.Client.Ping(r.ctx).Err(); err != nil {
-				logger.Warning.Printf("IRedis connection lost: %v. Attempting to reconnect...", err)
-
-				attempt := 1
-				for {
-					logger.Warning.Printf("Reconnect attempt #%d...", attempt)
-					// Reinitialize the IRedis general
-					if err = r.reconnect(); err == nil {
-						logger.Info.Println("Reconnected to IRedis.")
-						break
-					}
-					time.Sleep(time.Duration(attempt) * time.Second) // Exponential backoff
-					logger.Warning.Printf("Reconnect attempt failed: %v", err)
-					attempt++
-				}
-				return
-			}
+			r.check(interval)
 		}
 	}
 }
 
+// check pings Redis and moves the state, logging every change
+func (r *Client) check(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
+	err := r.Client.Ping(ctx).Err()
+	cancel()
+
+	r.mu.Lock()
+	if r.state == StateClosed {
+		r.mu.Unlock()
+		return
+	}
+	previous := r.state
+	if err == nil {
+		r.failures = 0
+		r.state = StateConnected
+	} else {
+		r.failures++
+		r.state = StateDegraded
+		if r.failures >= disconnectedAfter {
+			r.state = StateDisconnected
+		}
+	}
+	state, failures := r.state, r.failures
+	r.mu.Unlock()
+
+	if state == previous {
+		return
+	}
+	switch state {
+	case StateConnected:
+		logger.Info.Println("Redis connection restored")
+	case StateDegraded:
+		logger.Warning.Printf("Redis health check failed: %v", err)
+	case StateDisconnected:
+		logger.Error.Printf("Redis unreachable after %d checks: %v", failures, err)
+	}
+}
+
+// State is the state of the connection as of the last health check
+func (r *Client) State() State {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.state
+}
+
+// Healthy reports whether the last health check reached Redis
+func (r *Client) Healthy() bool {
+	return r.State() == StateConnected
+}
+
 // Close gracefully shuts down the IRedis general connection.
 func (r *Client) Close() error {
+	r.mu.Lock()
+	r.state = StateClosed
+	r.mu.Unlock()
+
 	r.cancel()
 	return r.Client.Close()
 }
@@ -100,13 +126,10 @@ func (r *Client) Set(key string, value any, expiration time.Duration) error {
 	if err != nil {
 		return err
 	}
-	err = r.Client.Set(r.ctx, key, data, expiration).Err()
-	if err != nil {
-		if err = r.reconnect(); err != nil {
-			return fmt.Errorf("failed to set key %s: %w", key, err)
-		}
+	if err = r.Client.Set(r.ctx, key, data, expiration).Err(); err != nil {
+		return fmt.Errorf("failed to set key %s: %w", key, err)
 	}
-	return err
+	return nil
 }
 
 // Get retrieves the value of a key.
@@ -116,9 +139,7 @@ func (r *Client) Get(key string) (string, error) {
 		if errors.Is(err, NilType) {
 			return "", nil // Key does not exist
 		}
-		if err = r.reconnect(); err != nil {
-			return "", fmt.Errorf("failed to get key %s: %w", key, err)
-		}
+		return "", fmt.Errorf("failed to get key %s: %w", key, err)
 	}
 	return result, nil
 }
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RunScript runs a Lua script, a nil reply is returned as nil without error
+func (r *Client) RunScript(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	result, err := script.Run(ctx, r.Client, keys, args...).Result()
+	if errors.Is(err, NilType) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run script: %w", err)
+	}
+	return result, nil
+}
+
+// Pipelined sends the commands queued by fn in one round trip. They are not
+// atomic, use TxPipelined for that.
+func (r *Client) Pipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
+	cmds, err := r.Client.Pipelined(ctx, fn)
+	if err != nil && !errors.Is(err, NilType) {
+		return cmds, fmt.Errorf("failed to run pipeline: %w", err)
+	}
+	return cmds, nil
+}
+
+// TxPipelined sends the commands queued by fn wrapped in MULTI/EXEC
+func (r *Client) TxPipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
+	cmds, err := r.Client.TxPipelined(ctx, fn)
+	if err != nil && !errors.Is(err, NilType) {
+		return cmds, fmt.Errorf("failed to run transaction: %w", err)
+	}
+	return cmds, nil
+}
+
+// Watch runs fn as an optimistic transaction on keys. It fails with
+// TxFailedErr when a key changed before fn's TxPipelined executed, the caller
+// decides whether to retry.
+func (r *Client) Watch(ctx context.Context, fn func(*Tx) error, keys ...string) error {
+	if err := r.Client.Watch(ctx, fn, keys...); err != nil {
+		return fmt.Errorf("failed to run watched transaction: %w", err)
+	}
+	return nil
+}
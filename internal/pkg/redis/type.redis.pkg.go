@@ -2,34 +2,179 @@ package redis
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	_redis "github.com/redis/go-redis/v9"
 )
 
+// Mode is how the client reaches Redis
+type Mode string
+
+const (
+	// ModeSingle connects to one server at Host and Port
+	ModeSingle Mode = "single"
+	// ModeSentinel asks the sentinels at Addrs for the master MasterName and
+	// follows it on failover
+	ModeSentinel Mode = "sentinel"
+	// ModeCluster discovers the cluster from the seed nodes at Addrs
+	ModeCluster Mode = "cluster"
+)
+
 type Config struct {
+	// Mode is ModeSingle when empty
+	Mode     Mode
 	Host     string
-	Username string
 	Port     int
+	Username string
 	Password string
 	PoolSize int
+	// DB is ignored in cluster mode, a cluster only has database 0
+	DB int
+
+	// Addrs are host:port of the sentinels or the cluster seed nodes
+	Addrs            []string
+	MasterName       string
+	SentinelUsername string
+	SentinelPassword string
+
+	// TLS is used when not nil
+	TLS *TLSConfig
+
+	// Timeouts of go-redis apply when zero
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// HealthInterval is how often the connection is checked, every second
+	// when zero
+	HealthInterval time.Duration
+}
+
+type TLSConfig struct {
+	// ServerName is verified against the certificate, the host is used when
+	// empty
+	ServerName string
+	// CAFile is a PEM bundle trusted besides the system roots, managed
+	// services often sign with their own CA
+	CAFile string
+	// CertFile and KeyFile are a client certificate for mutual TLS
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// State is the health of the connection as last checked
+type State int32
+
+const (
+	StateConnected State = iota
+	// StateDegraded follows a failed check, commands may still work while
+	// go-redis redials or the sentinels fail over
+	StateDegraded
+	// StateDisconnected follows several failed checks in a row
+	StateDisconnected
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateDegraded:
+		return "degraded"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
 }
 
 type Client struct {
-	Client *_redis.Client
+	// Client is a *redis.Client, *redis.ClusterClient or a failover client
+	// depending on the mode, it pools and redials connections itself
+	Client _redis.UniversalClient
 	config *Config
 	cancel context.CancelFunc
 	ctx    context.Context
+
+	mu       sync.RWMutex
+	state    State
+	failures int
 }
 
 type IRedis interface {
 	Close() error
+	// Healthy reports whether the last health check reached Redis
+	Healthy() bool
+	State() State
 	Set(key string, value interface{}, expiration time.Duration) error
 	Get(key string) (string, error)
 	Del(key string) error
 	Expire(key string, expiration time.Duration) error
+
+	// Keys and counters. In cluster mode DelWithContext, MGet and MSet split
+	// their keys by hash slot, MSet is then atomic only per slot.
+	SetWithContext(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	GetWithContext(ctx context.Context, key string) (string, error)
+	DelWithContext(ctx context.Context, keys ...string) error
+	ExpireWithContext(ctx context.Context, key string, expiration time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	IncrBy(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error)
+	MGet(ctx context.Context, keys ...string) (map[string]string, error)
+	MSet(ctx context.Context, values map[string]interface{}, expiration time.Duration) error
+
+	// Hashes
+	HSet(ctx context.Context, key string, values map[string]interface{}) error
+	HGet(ctx context.Context, key, field string) (string, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HDel(ctx context.Context, key string, fields ...string) error
+	HIncrBy(ctx context.Context, key, field string, delta int64) (int64, error)
+
+	// Lists
+	LPush(ctx context.Context, key string, values ...interface{}) (int64, error)
+	RPush(ctx context.Context, key string, values ...interface{}) (int64, error)
+	LPop(ctx context.Context, key string) (string, error)
+	RPop(ctx context.Context, key string) (string, error)
+	LRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+	LLen(ctx context.Context, key string) (int64, error)
+
+	// Sorted sets
+	ZAdd(ctx context.Context, key string, members ...Z) error
+	ZIncrBy(ctx context.Context, key string, delta float64, member string) (float64, error)
+	ZScore(ctx context.Context, key, member string) (float64, bool, error)
+	ZRangeByScore(ctx context.Context, key string, by *ZRangeBy) ([]string, error)
+	ZRem(ctx context.Context, key string, members ...string) error
+	ZRemRangeByScore(ctx context.Context, key, min, max string) (int64, error)
+	ZCard(ctx context.Context, key string) (int64, error)
+
+	// Scripts, pipelines and transactions
+	RunScript(ctx context.Context, script *Script, keys []string, args ...interface{}) (interface{}, error)
+	Pipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error)
+	TxPipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error)
+	Watch(ctx context.Context, fn func(*Tx) error, keys ...string) error
 }
 
-type ClientType = _redis.Client
+type ClientType = _redis.UniversalClient
+
+// Types of the go-redis API the interface exposes
+type (
+	Z         = _redis.Z
+	ZRangeBy  = _redis.ZRangeBy
+	Script    = _redis.Script
+	Pipeliner = _redis.Pipeliner
+	Cmder     = _redis.Cmder
+	Tx        = _redis.Tx
+)
 
 const NilType = _redis.Nil
+
+// TxFailedErr is returned by Watch when a watched key changed before EXEC
+const TxFailedErr = _redis.TxFailedErr
+
+// NewScript loads a Lua script, it runs through EVALSHA once cached
+func NewScript(src string) *Script {
+	return _redis.NewScript(src)
+}
@@ -0,0 +1,325 @@
+package redisstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/rabbitmq"
+	"go-boilerplate/internal/pkg/redis"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	_redis "github.com/redis/go-redis/v9"
+)
+
+// ErrExchangeUnsupported is returned for PublishOptions with an Exchange,
+// streams are addressed by queue name only
+var ErrExchangeUnsupported = errors.New("redis streams: exchanges are not supported")
+
+type Options struct {
+	// Prefix is prepended to every key
+	Prefix string
+	// BlockTimeout bounds one XREADGROUP, Stop waits for it
+	BlockTimeout time.Duration
+	// Messages pending longer than ClaimMinIdle, their consumer died or
+	// hangs, are claimed every ClaimInterval
+	ClaimInterval time.Duration
+	ClaimMinIdle  time.Duration
+	// MaxDeliveries dead-letters a message claimed that many times, it keeps
+	// crashing its consumers
+	MaxDeliveries int64
+	// RetryPoll is how often delayed retries are moved back to their stream
+	RetryPoll time.Duration
+	// ReplyTTL bounds how long an RPC reply waits for its caller
+	ReplyTTL time.Duration
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Prefix:        "stream:",
+		BlockTimeout:  2 * time.Second,
+		ClaimInterval: 30 * time.Second,
+		ClaimMinIdle:  time.Minute,
+		MaxDeliveries: 5,
+		RetryPoll:     time.Second,
+		ReplyTTL:      time.Minute,
+	}
+}
+
+// Broker carries events over Redis Streams with the contract of the rabbitmq
+// package, services and the consumer registry take it in place of RabbitMQ.
+// Every queue is a stream read by one consumer group named after the queue.
+// Handlers get an amqp.Delivery built from the entry and ack it as usual:
+// acked entries are deleted, failed ones wait in a sorted set until their
+// retry and end in the DeadLetterKey stream. Exchanges and priorities are
+// not supported.
+type Broker struct {
+	redis  *redis.Client
+	opts   *Options
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var (
+	_ rabbitmq.MessagePublisher = (*Broker)(nil)
+	_ rabbitmq.Broker           = (*Broker)(nil)
+)
+
+func NewBroker(ctx context.Context, client *redis.Client, opts *Options) *Broker {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Broker{redis: client, opts: opts, ctx: ctx, cancel: cancel}
+}
+
+// StreamKey is the stream of queue. The queue is a hash tag, so its stream and
+// retries share a cluster slot.
+func (b *Broker) StreamKey(queue string) string {
+	return b.opts.Prefix + "{" + queue + "}"
+}
+
+func (b *Broker) retryKey(queue string) string {
+	return b.StreamKey(queue) + ":retry"
+}
+
+// DeadLetterKey is the stream the entries of queue out of retries move to. It
+// shares the hash tag of queue, so the move is one transaction in a cluster.
+func (b *Broker) DeadLetterKey(queue string) string {
+	return b.StreamKey(queue) + ":fail"
+}
+
+// retryEntriesKey holds the fields of the entries waiting in retryKey
+func (b *Broker) retryEntriesKey(queue string) string {
+	return b.StreamKey(queue) + ":retry:entries"
+}
+
+func (b *Broker) replyKey(correlationID string) string {
+	return b.opts.Prefix + "reply:" + correlationID
+}
+
+// Healthy reports whether Redis answered its last health check
+func (b *Broker) Healthy() bool {
+	return b.redis.Healthy()
+}
+
+func (b *Broker) Publish(msg *rabbitmq.Message, opts *rabbitmq.PublishOptions) (interface{}, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, timeout)
+	defer cancel()
+	return b.PublishWithContext(ctx, msg, opts)
+}
+
+// PublishWithContext adds msg to the stream of opts.QueueName, or for RPC
+// adds it and waits for the reply until ctx is done (opts.Timeout when ctx
+// has no deadline)
+func (b *Broker) PublishWithContext(ctx context.Context, msg *rabbitmq.Message, opts *rabbitmq.PublishOptions) (*rabbitmq.RPCResponse, error) {
+	if opts.Exchange != "" {
+		return nil, ErrExchangeUnsupported
+	}
+	if opts.IsRPC {
+		if _, ok := ctx.Deadline(); !ok && opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+		return b.call(ctx, msg, opts)
+	}
+
+	payload := msg.GeneratePayload()
+	payload.Type = opts.Pattern
+	if err := b.redis.Client.XAdd(ctx, b.addArgs(opts, payload)).Err(); err != nil {
+		return nil, fmt.Errorf("failed to add message to stream: %w", err)
+	}
+	return nil, nil
+}
+
+func (b *Broker) addArgs(opts *rabbitmq.PublishOptions, payload *amqp.Publishing) *_redis.XAddArgs {
+	args := &_redis.XAddArgs{Stream: b.StreamKey(opts.QueueName), Values: entryValues(payload)}
+	if opts.QueueOpts != nil && opts.QueueOpts.MaxLength > 0 {
+		args.MaxLen = int64(opts.QueueOpts.MaxLength)
+		args.Approx = true
+	}
+	return args
+}
+
+func (b *Broker) call(ctx context.Context, msg *rabbitmq.Message, opts *rabbitmq.PublishOptions) (*rabbitmq.RPCResponse, error) {
+	stream := b.StreamKey(opts.QueueName)
+
+	// Like RabbitMQ a pattern no service consumes fails at once
+	groups, err := b.redis.Client.XInfoGroups(ctx, stream).Result()
+	if err != nil || len(groups) == 0 {
+		return nil, fmt.Errorf("rpc %s: %w", opts.Pattern, rabbitmq.ErrUnroutable)
+	}
+
+	payload := msg.GenerateRPCPayload(b.replyKey(msg.ID), opts.Pattern)
+	if err := b.redis.Client.XAdd(ctx, &_redis.XAddArgs{Stream: stream, Values: entryValues(payload)}).Err(); err != nil {
+		return nil, fmt.Errorf("failed to add request to stream: %w", err)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("rpc %s: %w", opts.Pattern, err)
+		}
+
+		// short waits notice ctx without relying on the connection deadline
+		reply, err := b.redis.Client.BLPop(ctx, time.Second, payload.ReplyTo).Result()
+		if errors.Is(err, redis.NilType) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("rpc %s: %w", opts.Pattern, ctx.Err())
+			}
+			return nil, fmt.Errorf("failed to read reply: %w", err)
+		}
+
+		var response rabbitmq.RPCResponse
+		if err := json.Unmarshal([]byte(reply[1]), &response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		return &response, nil
+	}
+}
+
+// PublishBatch adds msgs in one pipeline, each message gets its own result
+func (b *Broker) PublishBatch(ctx context.Context, msgs []*rabbitmq.Message, opts *rabbitmq.PublishOptions) ([]rabbitmq.PublishResult, error) {
+	if opts.IsRPC {
+		return nil, errors.New("batch publishing does not support RPC")
+	}
+	if opts.Exchange != "" {
+		return nil, ErrExchangeUnsupported
+	}
+
+	pipe := b.redis.Client.Pipeline()
+	cmds := make([]*_redis.StringCmd, len(msgs))
+	for i, msg := range msgs {
+		payload := msg.GeneratePayload()
+		payload.Type = opts.Pattern
+		cmds[i] = pipe.XAdd(ctx, b.addArgs(opts, payload))
+	}
+	_, _ = pipe.Exec(ctx)
+
+	results := make([]rabbitmq.PublishResult, len(msgs))
+	failed := 0
+	for i, cmd := range cmds {
+		err := cmd.Err()
+		results[i] = rabbitmq.PublishResult{MessageID: msgs[i].ID, Acked: err == nil, Attempts: 1, Err: err}
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d messages were not added", failed, len(msgs))
+	}
+	return results, nil
+}
+
+// Subscribe creates a consumer of the stream of opts.QueueName, it reads once
+// started
+func (b *Broker) Subscribe(ctx context.Context, handler rabbitmq.MessageHandler, opts *rabbitmq.SubscribeOptions) (rabbitmq.MessageSubscriber, error) {
+	if opts.WorkerCount <= 0 {
+		return nil, errors.New("subscriber needs at least one worker")
+	}
+	return newSubscriber(ctx, b, handler, opts), nil
+}
+
+// Close stops the running calls and subscribers, the Redis client stays open
+func (b *Broker) Close() error {
+	b.cancel()
+	return nil
+}
+
+// entryValues are the fields of the stream entry of a message
+func entryValues(p *amqp.Publishing) map[string]interface{} {
+	headers, err := json.Marshal(p.Headers)
+	if err != nil {
+		headers = []byte("{}")
+	}
+
+	values := map[string]interface{}{
+		"id":           p.MessageId,
+		"type":         p.Type,
+		"content_type": p.ContentType,
+		"timestamp":    p.Timestamp.UnixMilli(),
+		"headers":      headers,
+		"body":         p.Body,
+	}
+	if p.CorrelationId != "" {
+		values["correlation_id"] = p.CorrelationId
+	}
+	if p.ReplyTo != "" {
+		values["reply_to"] = p.ReplyTo
+	}
+	if p.Expiration != "" {
+		values["expiration"] = p.Expiration
+	}
+	return values
+}
+
+// publishingOf is the message of a stream entry
+func publishingOf(values map[string]interface{}) amqp.Publishing {
+	field := func(name string) string {
+		s, _ := values[name].(string)
+		return s
+	}
+
+	p := amqp.Publishing{
+		MessageId:     field("id"),
+		Type:          field("type"),
+		ContentType:   field("content_type"),
+		CorrelationId: field("correlation_id"),
+		ReplyTo:       field("reply_to"),
+		Expiration:    field("expiration"),
+		Headers:       decodeHeaders(field("headers")),
+		Body:          []byte(field("body")),
+		DeliveryMode:  amqp.Persistent,
+	}
+	if ms, err := strconv.ParseInt(field("timestamp"), 10, 64); err == nil {
+		p.Timestamp = time.UnixMilli(ms)
+	}
+	return p
+}
+
+// decodeHeaders keeps whole numbers integers, x-retry-count and the other
+// counters are read as int64 like from AMQP
+func decodeHeaders(data string) amqp.Table {
+	headers := make(amqp.Table)
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&headers); err != nil {
+		return headers
+	}
+	for key, value := range headers {
+		headers[key] = numbers(value)
+	}
+	return headers
+}
+
+func numbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = numbers(item)
+		}
+		return amqp.Table(v)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = numbers(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,573 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/rabbitmq"
+	"go-boilerplate/internal/pkg/redis"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	_redis "github.com/redis/go-redis/v9"
+)
+
+// moveRetriesScript adds the retries due by ARGV[1] back to the stream. The
+// set KEYS[1] scores entry ids by due time and the hash KEYS[3] holds their
+// fields, length prefixed by encodeRetry so binary bodies survive the wait.
+var moveRetriesScript = redis.NewScript(`
+local function decode(payload)
+	local fields, i = {}, 1
+	while i <= #payload do
+		local colon = string.find(payload, ":", i, true)
+		local n = tonumber(string.sub(payload, i, colon - 1))
+		table.insert(fields, string.sub(payload, colon + 1, colon + n))
+		i = colon + n + 1
+	end
+	return fields
+end
+
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 100)
+for _, id in ipairs(due) do
+	local payload = redis.call("HGET", KEYS[3], id)
+	if payload then
+		redis.call("XADD", KEYS[2], "*", unpack(decode(payload)))
+	end
+	redis.call("HDEL", KEYS[3], id)
+	redis.call("ZREM", KEYS[1], id)
+end
+return #due
+`)
+
+// subscriber consumes the stream of a queue and settles entries the way
+// rabbitmq.Subscriber settles messages
+type subscriber struct {
+	broker   *Broker
+	handler  rabbitmq.MessageHandler
+	opts     *rabbitmq.SubscribeOptions
+	stream   string
+	consumer string
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	claimed chan _redis.XMessage
+
+	mu      sync.Mutex
+	tag     uint64
+	pending map[uint64]_redis.XMessage
+
+	isRunning      atomic.Bool
+	runningWorkers atomic.Int32
+}
+
+var _ amqp.Acknowledger = (*subscriber)(nil)
+
+func newSubscriber(ctx context.Context, b *Broker, handler rabbitmq.MessageHandler, opts *rabbitmq.SubscribeOptions) *subscriber {
+	ctx, cancel := context.WithCancel(ctx)
+	host, _ := os.Hostname()
+	return &subscriber{
+		broker:   b,
+		handler:  handler,
+		opts:     opts,
+		stream:   b.StreamKey(opts.QueueName),
+		consumer: fmt.Sprintf("%s-%s-%s", opts.ConsumerName, host, uuid.NewString()[:8]),
+		ctx:      ctx,
+		cancel:   cancel,
+		claimed:  make(chan _redis.XMessage),
+		pending:  make(map[uint64]_redis.XMessage),
+	}
+}
+
+// group is the consumer group of the stream, consumers of the same queue
+// share its entries like consumers of a RabbitMQ queue
+func (s *subscriber) group() string {
+	return s.opts.QueueName
+}
+
+func (s *subscriber) Start() error {
+	if s.isRunning.Swap(true) {
+		return fmt.Errorf("subscriber is already running")
+	}
+
+	// "0" hands the group the entries added before its first consumer, like
+	// messages waiting in a declared queue
+	err := s.broker.redis.Client.XGroupCreateMkStream(s.broker.ctx, s.stream, s.group(), "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		s.isRunning.Store(false)
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	for i := 0; i < s.opts.WorkerCount; i++ {
+		s.wg.Add(1)
+		go s.runWorker()
+	}
+
+	s.wg.Add(2)
+	go s.every(s.broker.opts.ClaimInterval, s.claimStuck)
+	go s.every(s.broker.opts.RetryPoll, s.moveRetries)
+	return nil
+}
+
+func (s *subscriber) every(interval time.Duration, fn func() error) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.broker.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(); err != nil && s.ctx.Err() == nil {
+				logger.Warning.Printf("Stream %s: %v", s.stream, err)
+			}
+		}
+	}
+}
+
+func (s *subscriber) runWorker() {
+	defer s.wg.Done()
+	s.runningWorkers.Add(1)
+	defer s.runningWorkers.Add(-1)
+
+	for s.ctx.Err() == nil && s.broker.ctx.Err() == nil {
+		select {
+		case entry := <-s.claimed:
+			s.processMessage(entry, true)
+			continue
+		default:
+		}
+
+		streams, err := s.broker.redis.Client.XReadGroup(s.ctx, &_redis.XReadGroupArgs{
+			Group:    s.group(),
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    1,
+			Block:    s.broker.opts.BlockTimeout,
+		}).Result()
+		if errors.Is(err, redis.NilType) {
+			continue
+		}
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			logger.Warning.Printf("Failed to read stream %s: %v", s.stream, err)
+			select {
+			case <-s.ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				s.processMessage(msg, false)
+			}
+		}
+	}
+}
+
+func (s *subscriber) processMessage(entry _redis.XMessage, redelivered bool) {
+	msg := s.delivery(entry, redelivered)
+	defer func() {
+		// Left pending like a panicking worker of Subscriber, it is claimed
+		// again after ClaimMinIdle
+		if r := recover(); r != nil {
+			s.settle(msg.DeliveryTag)
+			logger.Error.Printf("Message processor panic: %v\n", r)
+		}
+	}()
+
+	if expired(msg) {
+		logger.Warning.Printf("Message %s on %s expired, dropping it", msg.MessageId, s.opts.QueueName)
+		_ = msg.Reject(false)
+		return
+	}
+	if s.opts.AutoAck {
+		if err := msg.Ack(false); err != nil {
+			logger.Error.Printf("Failed to acknowledge message %s: %v\n", msg.MessageId, err)
+		}
+	}
+
+	count := rabbitmq.DeliveryCount(msg)
+	response, err := s.handler(msg)
+	if err != nil {
+		err = s.handleProcessingError(msg, err, count)
+	} else {
+		err = s.handleSuccessfulProcessing(msg, response)
+	}
+	if err != nil {
+		logger.Error.Printf("Failed to process message %s: %v\n", msg.MessageId, err)
+	}
+}
+
+// delivery is the entry as the handler sees it, acks go to the subscriber
+func (s *subscriber) delivery(entry _redis.XMessage, redelivered bool) *amqp.Delivery {
+	p := publishingOf(entry.Values)
+
+	s.mu.Lock()
+	s.tag++
+	tag := s.tag
+	s.pending[tag] = entry
+	s.mu.Unlock()
+
+	return &amqp.Delivery{
+		Acknowledger:  s,
+		Headers:       p.Headers,
+		ContentType:   p.ContentType,
+		DeliveryMode:  p.DeliveryMode,
+		CorrelationId: p.CorrelationId,
+		ReplyTo:       p.ReplyTo,
+		Expiration:    p.Expiration,
+		MessageId:     p.MessageId,
+		Timestamp:     p.Timestamp,
+		Type:          p.Type,
+		ConsumerTag:   s.consumer,
+		DeliveryTag:   tag,
+		Redelivered:   redelivered,
+		RoutingKey:    s.opts.QueueName,
+		Body:          p.Body,
+	}
+}
+
+func expired(msg *amqp.Delivery) bool {
+	if msg.Expiration == "" || msg.Timestamp.IsZero() {
+		return false
+	}
+	ms, err := strconv.ParseInt(msg.Expiration, 10, 64)
+	return err == nil && time.Since(msg.Timestamp) > time.Duration(ms)*time.Millisecond
+}
+
+func (s *subscriber) handleProcessingError(msg *amqp.Delivery, handlerErr error, count int) error {
+	if msg.CorrelationId != "" {
+		if msg.ReplyTo != "" {
+			if err := s.reply(msg, &rabbitmq.RPCResponse{Status: "error", Err: handlerErr.Error()}); err != nil {
+				logger.Error.Printf("Failed to handle RPC error: %v", err)
+			}
+		}
+		return s.ack(msg)
+	}
+
+	if count >= s.opts.MaxRetryAttempts {
+		if !s.opts.EnableDeadLetter {
+			if err := msg.Reject(false); err != nil {
+				return fmt.Errorf("failed to reject message: %w", err)
+			}
+			return nil
+		}
+		return s.deadLetter(msg, handlerErr)
+	}
+
+	if err := s.retry(msg, count+1); err != nil {
+		return err
+	}
+	return fmt.Errorf("handler error on attempt %d: %w", count+1, handlerErr)
+}
+
+func (s *subscriber) handleSuccessfulProcessing(msg *amqp.Delivery, response interface{}) error {
+	if msg.CorrelationId != "" && msg.ReplyTo != "" {
+		if err := s.reply(msg, &rabbitmq.RPCResponse{IsDisposed: true, Response: response}); err != nil {
+			return fmt.Errorf("failed to handle successful RPC: %w", err)
+		}
+	}
+	return s.ack(msg)
+}
+
+func (s *subscriber) reply(delivery *amqp.Delivery, response *rabbitmq.RPCResponse) error {
+	msg, err := rabbitmq.NewMessage(response, &delivery.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to create reply payload: %w", err)
+	}
+	payload := msg.GenerateRPCReplyPayload(delivery.CorrelationId)
+
+	_, err = s.broker.redis.Client.TxPipelined(s.broker.ctx, func(pipe _redis.Pipeliner) error {
+		pipe.RPush(s.broker.ctx, delivery.ReplyTo, payload.Body)
+		pipe.Expire(s.broker.ctx, delivery.ReplyTo, s.broker.opts.ReplyTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	return nil
+}
+
+func (s *subscriber) ack(msg *amqp.Delivery) error {
+	if s.opts.AutoAck {
+		return nil
+	}
+	if err := msg.Ack(false); err != nil {
+		return fmt.Errorf("failed to acknowledge message: %w", err)
+	}
+	return nil
+}
+
+// retry parks the message in the retry set until its delay passed. It is
+// removed from the stream in the same transaction, so it is never lost or
+// doubled.
+func (s *subscriber) retry(msg *amqp.Delivery, retryCount int) error {
+	entry, ok := s.settle(msg.DeliveryTag)
+	if !ok {
+		return nil
+	}
+
+	p := publishingOf(entry.Values)
+	if p.Headers == nil {
+		p.Headers = make(amqp.Table)
+	}
+	p.Headers["x-retry-count"] = retryCount
+	p.Expiration = ""
+
+	queue := s.opts.QueueName
+	due := time.Now().Add(s.opts.RetryDelay(retryCount)).UnixMilli()
+	_, err := s.broker.redis.Client.TxPipelined(s.broker.ctx, func(pipe _redis.Pipeliner) error {
+		pipe.HSet(s.broker.ctx, s.broker.retryEntriesKey(queue), entry.ID, encodeRetry(entryValues(&p)))
+		pipe.ZAdd(s.broker.ctx, s.broker.retryKey(queue), _redis.Z{Score: float64(due), Member: entry.ID})
+		s.remove(pipe, entry.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule retry: %w", err)
+	}
+	return nil
+}
+
+// encodeRetry flattens the fields of an entry as <length>:<bytes> pairs for
+// moveRetriesScript to read back
+func encodeRetry(values map[string]interface{}) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	write := func(field string) {
+		b.WriteString(strconv.Itoa(len(field)))
+		b.WriteByte(':')
+		b.WriteString(field)
+	}
+	for _, name := range names {
+		write(name)
+		switch v := values[name].(type) {
+		case string:
+			write(v)
+		case []byte:
+			write(string(v))
+		default:
+			write(fmt.Sprint(v))
+		}
+	}
+	return b.String()
+}
+
+// deadLetter moves the message to the dead letter stream with the headers
+// rabbitmq.Subscriber sets, so cmd/dlq style tooling reads both the same
+func (s *subscriber) deadLetter(msg *amqp.Delivery, cause error) error {
+	entry, ok := s.settle(msg.DeliveryTag)
+	if !ok {
+		return nil
+	}
+	return s.moveToDeadLetter(entry, cause)
+}
+
+func (s *subscriber) moveToDeadLetter(entry _redis.XMessage, cause error) error {
+	p := publishingOf(entry.Values)
+	p.Headers = s.opts.MarkDead(p.Headers, cause)
+
+	_, err := s.broker.redis.Client.TxPipelined(s.broker.ctx, func(pipe _redis.Pipeliner) error {
+		pipe.XAdd(s.broker.ctx, &_redis.XAddArgs{Stream: s.broker.DeadLetterKey(s.opts.QueueName), Values: entryValues(&p)})
+		s.remove(pipe, entry.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to dead letter stream: %w", err)
+	}
+	return nil
+}
+
+// remove acks and deletes an entry, the group is the only reader of the
+// stream so nobody else needs it
+func (s *subscriber) remove(pipe _redis.Pipeliner, id string) {
+	pipe.XAck(s.broker.ctx, s.stream, s.group(), id)
+	pipe.XDel(s.broker.ctx, s.stream, id)
+}
+
+// settle forgets the entry of tag, false when it was settled before
+func (s *subscriber) settle(tag uint64) (_redis.XMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.pending[tag]
+	delete(s.pending, tag)
+	return entry, ok
+}
+
+// Ack removes the entry from the stream, multiple is not supported
+func (s *subscriber) Ack(tag uint64, multiple bool) error {
+	entry, ok := s.settle(tag)
+	if !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	_, err := s.broker.redis.Client.TxPipelined(s.broker.ctx, func(pipe _redis.Pipeliner) error {
+		s.remove(pipe, entry.ID)
+		return nil
+	})
+	return err
+}
+
+// Nack with requeue adds the entry again at the end of the stream, without
+// it drops the entry
+func (s *subscriber) Nack(tag uint64, multiple bool, requeue bool) error {
+	if !requeue {
+		return s.Ack(tag, multiple)
+	}
+
+	entry, ok := s.settle(tag)
+	if !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	_, err := s.broker.redis.Client.TxPipelined(s.broker.ctx, func(pipe _redis.Pipeliner) error {
+		pipe.XAdd(s.broker.ctx, &_redis.XAddArgs{Stream: s.stream, Values: entry.Values})
+		s.remove(pipe, entry.ID)
+		return nil
+	})
+	return err
+}
+
+func (s *subscriber) Reject(tag uint64, requeue bool) error {
+	return s.Nack(tag, false, requeue)
+}
+
+// claimStuck takes over the entries other consumers left pending for
+// ClaimMinIdle and dead-letters those delivered MaxDeliveries times
+func (s *subscriber) claimStuck() error {
+	ctx := s.broker.ctx
+	start := "0-0"
+	for s.ctx.Err() == nil {
+		msgs, next, err := s.broker.redis.Client.XAutoClaim(ctx, &_redis.XAutoClaimArgs{
+			Stream:   s.stream,
+			Group:    s.group(),
+			MinIdle:  s.broker.opts.ClaimMinIdle,
+			Start:    start,
+			Count:    int64(s.opts.WorkerCount),
+			Consumer: s.consumer,
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to claim entries: %w", err)
+		}
+
+		if len(msgs) > 0 {
+			deliveries, err := s.deliveries(ctx, msgs[0].ID, msgs[len(msgs)-1].ID)
+			if err != nil {
+				return err
+			}
+
+			for _, msg := range msgs {
+				if msg.Values == nil {
+					continue // deleted while pending
+				}
+				count := deliveries[msg.ID]
+				if count >= s.broker.opts.MaxDeliveries {
+					err := fmt.Errorf("delivered %d times without an ack", count)
+					if err := s.moveToDeadLetter(msg, err); err != nil {
+						logger.Error.Printf("Failed to dead-letter stuck entry %s: %v", msg.ID, err)
+					}
+					continue
+				}
+
+				logger.Warning.Printf("Claimed entry %s of %s, delivery %d", msg.ID, s.stream, count)
+				select {
+				case s.claimed <- msg:
+				case <-s.ctx.Done():
+					return nil
+				}
+			}
+		}
+
+		if next == "0-0" || next == "" {
+			return nil
+		}
+		start = next
+	}
+	return nil
+}
+
+// deliveries is the delivery count of the entries this consumer holds
+// between the ids
+func (s *subscriber) deliveries(ctx context.Context, start, end string) (map[string]int64, error) {
+	pending, err := s.broker.redis.Client.XPendingExt(ctx, &_redis.XPendingExtArgs{
+		Stream:   s.stream,
+		Group:    s.group(),
+		Start:    start,
+		End:      end,
+		Count:    int64(s.opts.WorkerCount),
+		Consumer: s.consumer,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending entries: %w", err)
+	}
+
+	counts := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		counts[p.ID] = p.RetryCount
+	}
+	return counts, nil
+}
+
+func (s *subscriber) moveRetries() error {
+	queue := s.opts.QueueName
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	_, err := s.broker.redis.RunScript(s.broker.ctx, moveRetriesScript, []string{s.broker.retryKey(queue), s.stream, s.broker.retryEntriesKey(queue)}, now)
+	return err
+}
+
+// Stop lets the workers finish their messages. Entries read but not acked
+// stay pending and are claimed by another consumer after ClaimMinIdle.
+func (s *subscriber) Stop() error {
+	if !s.isRunning.Swap(false) {
+		return nil
+	}
+
+	s.cancel()
+
+	drainTimeout := s.opts.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = time.Second * 30
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(drainTimeout):
+		return fmt.Errorf("timeout waiting for workers to stop")
+	}
+}
+
+func (s *subscriber) GetRunningWorkers() int {
+	return int(s.runningWorkers.Load())
+}
+
+func (s *subscriber) GetWorkerCapacity() int {
+	return s.opts.WorkerCount
+}
+
+func (s *subscriber) IsHealthy() bool {
+	return s.isRunning.Load() && s.broker.ctx.Err() == nil
+}
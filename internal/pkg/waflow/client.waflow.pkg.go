@@ -0,0 +1,142 @@
+package waflow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The functions in this file implement the WhatsApp client side of the
+// protocol. They are used to exercise the endpoint without a phone.
+
+// LoadPublicKey loads an RSA public key from a PEM file. The file may hold a
+// PKIX or PKCS#1 public key, or a private key whose public half is returned.
+// The passphrase is only used for encrypted private keys.
+func LoadPublicKey(path string, passphrase string) (*rsa.PublicKey, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	if strings.Contains(block.Type, "PRIVATE KEY") {
+		privateKey, err := ParsePrivateKey(keyData, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return &privateKey.PublicKey, nil
+	}
+
+	// Try PKIX first, fallback to PKCS#1
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		rsaKey, err2 := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err2 != nil {
+			return nil, fmt.Errorf("failed to parse public key (PKIX: %v, PKCS#1: %v)", err, err2)
+		}
+		return rsaKey, nil
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not RSA")
+	}
+	return rsaKey, nil
+}
+
+// EncryptRequest encrypts a request the way the WhatsApp client does: a fresh
+// AES-128 key and IV, the key wrapped with RSA-OAEP (SHA-256).
+// Returns the encrypted body, AES key, and IV for use in decrypting the response
+func EncryptRequest(publicKey *rsa.PublicKey, request DecryptedRequest) (*EncryptedRequest, []byte, []byte, error) {
+	// 1. Generate AES key and IV
+	aesKey := make([]byte, 16)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate AES key: %w", err)
+	}
+
+	iv := make([]byte, 16)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	// 2. RSA-OAEP encrypt the AES key
+	encryptedAESKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, aesKey, nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to encrypt AES key: %w", err)
+	}
+
+	// 3. JSON marshal and AES-GCM encrypt the request
+	plaintext, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, nil)
+
+	// 4. Base64 encode all fields
+	return &EncryptedRequest{
+		EncryptedFlowData: base64.StdEncoding.EncodeToString(sealed),
+		EncryptedAESKey:   base64.StdEncoding.EncodeToString(encryptedAESKey),
+		InitialVector:     base64.StdEncoding.EncodeToString(iv),
+	}, aesKey, iv, nil
+}
+
+// DecryptResponse decrypts a base64 response produced by EncryptResponse
+func DecryptResponse(aesKey []byte, iv []byte, body string) (*FlowResponse, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Responses are encrypted with the flipped IV
+	flippedIV := make([]byte, len(iv))
+	for i := range iv {
+		flippedIV[i] = ^iv[i]
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, flippedIV, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt response: %w", err)
+	}
+
+	var response FlowResponse
+	if err := json.Unmarshal(plaintext, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return &response, nil
+}
+
+func newGCM(aesKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
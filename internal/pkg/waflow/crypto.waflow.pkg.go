@@ -6,14 +6,16 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
-	"os"
 )
 
+// ErrKeyMismatch means none of the private keys could decrypt the AES key.
+// WhatsApp expects HTTP 421 in that case and re-fetches the public key.
+var ErrKeyMismatch = errors.New("request was not encrypted with any active key")
+
 // EncryptedRequest represents the incoming encrypted body from WhatsApp Flows
 type EncryptedRequest struct {
 	EncryptedFlowData string `json:"encrypted_flow_data"`
@@ -36,38 +38,16 @@ type FlowResponse struct {
 	Data   map[string]interface{} `json:"data,omitempty"`
 }
 
-// LoadPrivateKey loads an RSA private key from a PEM file
+// LoadPrivateKey loads an unencrypted RSA private key from a PEM file
 func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
-	keyData, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %w", err)
-	}
-
-	block, _ := pem.Decode(keyData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block")
-	}
-
-	// Try PKCS#8 first, fallback to PKCS#1
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-	if err != nil {
-		rsaKey, err2 := x509.ParsePKCS1PrivateKey(block.Bytes)
-		if err2 != nil {
-			return nil, fmt.Errorf("failed to parse private key (PKCS#8: %v, PKCS#1: %v)", err, err2)
-		}
-		return rsaKey, nil
-	}
-
-	rsaKey, ok := key.(*rsa.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("private key is not RSA")
-	}
-	return rsaKey, nil
+	return LoadPrivateKeyWithPassphrase(path, "")
 }
 
-// DecryptRequest decrypts the incoming WhatsApp Flows encrypted request
+// DecryptRequest decrypts the incoming WhatsApp Flows encrypted request.
+// Keys are tried in order, so a new key can be served while clients still
+// encrypt with the previous public key.
 // Returns the decrypted request, AES key, and IV for use in encrypting the response
-func DecryptRequest(privateKey *rsa.PrivateKey, body EncryptedRequest) (*DecryptedRequest, []byte, []byte, error) {
+func DecryptRequest(privateKeys []*rsa.PrivateKey, body EncryptedRequest) (*DecryptedRequest, []byte, []byte, error) {
 	// 1. Base64 decode all fields
 	encryptedAESKey, err := base64.StdEncoding.DecodeString(body.EncryptedAESKey)
 	if err != nil {
@@ -84,10 +64,10 @@ func DecryptRequest(privateKey *rsa.PrivateKey, body EncryptedRequest) (*Decrypt
 		return nil, nil, nil, fmt.Errorf("failed to decode encrypted_flow_data: %w", err)
 	}
 
-	// 2. RSA-OAEP decrypt the AES key
-	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedAESKey, nil)
+	// 2. RSA-OAEP decrypt the AES key with the first key that fits
+	aesKey, err := decryptAESKey(privateKeys, encryptedAESKey)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to decrypt AES key: %w", err)
+		return nil, nil, nil, err
 	}
 
 	// 3. Create AES-GCM cipher with nonce size 16 (WhatsApp uses 128-bit IV)
@@ -116,6 +96,22 @@ func DecryptRequest(privateKey *rsa.PrivateKey, body EncryptedRequest) (*Decrypt
 	return &decrypted, aesKey, iv, nil
 }
 
+func decryptAESKey(privateKeys []*rsa.PrivateKey, encryptedAESKey []byte) ([]byte, error) {
+	if len(privateKeys) == 0 {
+		return nil, errors.New("no private key configured")
+	}
+
+	var lastErr error
+	for _, privateKey := range privateKeys {
+		aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedAESKey, nil)
+		if err == nil {
+			return aesKey, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("%w: tried %d key(s): %v", ErrKeyMismatch, len(privateKeys), lastErr)
+}
+
 // EncryptResponse encrypts the response to send back to WhatsApp Flows
 func EncryptResponse(aesKey []byte, iv []byte, response FlowResponse) (string, error) {
 	// 1. JSON marshal response
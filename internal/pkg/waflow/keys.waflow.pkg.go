@@ -0,0 +1,210 @@
+package waflow
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go-boilerplate/internal/pkg/logger"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// LoadPrivateKeyWithPassphrase loads an RSA private key from a PEM file.
+// Supports unencrypted PKCS#1/PKCS#8, encrypted PKCS#8 ("ENCRYPTED PRIVATE
+// KEY", as produced by `openssl genrsa -des3`) and legacy encrypted PEM.
+func LoadPrivateKeyWithPassphrase(path string, passphrase string) (*rsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	return ParsePrivateKey(keyData, passphrase)
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key, decrypting it with
+// the passphrase when the key is encrypted
+func ParsePrivateKey(keyData []byte, passphrase string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	der := block.Bytes
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key is encrypted but no passphrase is configured")
+		}
+		plain, err := decryptPKCS8(der, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		der = plain
+
+	//nolint:staticcheck // legacy encrypted PEM is still produced by OpenSSL 1.x
+	case x509.IsEncryptedPEMBlock(block):
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key is encrypted but no passphrase is configured")
+		}
+		//nolint:staticcheck // see above
+		plain, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, ErrIncorrectPassphrase
+			}
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		der = plain
+	}
+
+	// Try PKCS#8 first, fallback to PKCS#1
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		rsaKey, err2 := x509.ParsePKCS1PrivateKey(der)
+		if err2 != nil {
+			return nil, fmt.Errorf("failed to parse private key (PKCS#8: %v, PKCS#1: %v)", err, err2)
+		}
+		return rsaKey, nil
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA")
+	}
+	return rsaKey, nil
+}
+
+// GenerateKeyPair creates a new RSA key pair for WhatsApp Flows. The private
+// key is PKCS#8, encrypted with the passphrase unless it is empty. The public
+// key is the PKIX PEM to upload to Meta.
+func GenerateKeyPair(bits int, passphrase string) (privatePEM []byte, publicPEM []byte, err error) {
+	if bits < 2048 {
+		return nil, nil, fmt.Errorf("key size must be at least 2048 bits")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	privateBlock := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	if passphrase != "" {
+		encrypted, err := encryptPKCS8(der, passphrase)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt private key: %w", err)
+		}
+		privateBlock = &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	return pem.EncodeToMemory(privateBlock), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), nil
+}
+
+// ParseKeyPaths splits a comma separated WA_PRIVATE_KEY_PATH value
+func ParseKeyPaths(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// KeyRing holds the active private keys in priority order. During a
+// rotation the new key is listed first and the old key stays until every
+// WhatsApp client has picked up the new public key.
+type KeyRing struct {
+	mu         sync.RWMutex
+	paths      []string
+	passphrase string
+	keys       []*rsa.PrivateKey
+}
+
+// NewKeyRing loads every key in paths, all keys share the same passphrase
+func NewKeyRing(paths []string, passphrase string) (*KeyRing, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no private key path configured")
+	}
+
+	k := &KeyRing{
+		paths:      paths,
+		passphrase: passphrase,
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload re-reads every key file. Keys are swapped only if all of them load,
+// so a bad file never leaves the endpoint without keys.
+func (k *KeyRing) Reload() error {
+	keys := make([]*rsa.PrivateKey, 0, len(k.paths))
+	for _, path := range k.paths {
+		key, err := LoadPrivateKeyWithPassphrase(path, k.passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Keys returns a snapshot of the active keys
+func (k *KeyRing) Keys() []*rsa.PrivateKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]*rsa.PrivateKey(nil), k.keys...)
+}
+
+// Paths returns the key files in priority order
+func (k *KeyRing) Paths() []string {
+	return append([]string(nil), k.paths...)
+}
+
+// DecryptRequest decrypts with the active keys, see DecryptRequest
+func (k *KeyRing) DecryptRequest(body EncryptedRequest) (*DecryptedRequest, []byte, []byte, error) {
+	return DecryptRequest(k.Keys(), body)
+}
+
+// ReloadOnSignal reloads the keys whenever one of the signals is received
+// (typically SIGHUP) until ctx is done
+func (k *KeyRing) ReloadOnSignal(ctx context.Context, signals ...os.Signal) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, signals...)
+
+	go func() {
+		defer signal.Stop(sigChan)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigChan:
+				if err := k.Reload(); err != nil {
+					logger.Error.Printf("WA Flows key reload on %v failed, keeping previous keys: %v", sig, err)
+					continue
+				}
+				logger.Info.Printf("WA Flows keys reloaded on %v (%d active)", sig, len(k.paths))
+			}
+		}
+	}()
+}
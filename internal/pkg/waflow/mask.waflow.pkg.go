@@ -0,0 +1,120 @@
+package waflow
+
+import (
+	"regexp"
+	"strings"
+)
+
+// piiKeys are substrings of field names that hold personal data. Values of
+// these fields are masked before they are logged or stored.
+var piiKeys = []string{
+	"nama", "name",
+	"phone", "handphone", "telepon", "hp", "wa_id",
+	"alamat", "address", "shipping",
+	"email",
+	"kode_pos", "postal", "zip",
+	"nik", "ktp",
+}
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+	phonePattern = regexp.MustCompile(`^\+?[\d\s\-()]{8,}$`)
+)
+
+// MaskData returns a copy of flow data with personal data masked. Fields are
+// masked by name (see piiKeys) and string values that look like an email or
+// phone number are masked whatever their field is called.
+func MaskData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	masked := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		masked[key] = maskValue(isPIIKey(key), value)
+	}
+	return masked
+}
+
+func maskValue(pii bool, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if pii {
+			masked := make(map[string]interface{}, len(v))
+			for key, nested := range v {
+				masked[key] = maskValue(true, nested)
+			}
+			return masked
+		}
+		return MaskData(v)
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskValue(pii, item)
+		}
+		return masked
+	case string:
+		if pii || emailPattern.MatchString(v) || phonePattern.MatchString(v) {
+			return MaskString(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// MaskString hides most of a value: emails keep the first letter and the
+// domain, phone numbers keep the last 3 digits, anything else keeps the
+// first and last character of every word.
+func MaskString(value string) string {
+	switch {
+	case value == "":
+		return value
+	case emailPattern.MatchString(value):
+		local, domain, _ := strings.Cut(value, "@")
+		return maskWord(local) + "@" + domain
+	case phonePattern.MatchString(value):
+		digits := 0
+		for _, r := range value {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		var b strings.Builder
+		seen := 0
+		for _, r := range value {
+			if r >= '0' && r <= '9' {
+				seen++
+				if seen <= digits-3 {
+					r = '*'
+				}
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	default:
+		words := strings.Fields(value)
+		for i, word := range words {
+			words[i] = maskWord(word)
+		}
+		return strings.Join(words, " ")
+	}
+}
+
+func maskWord(word string) string {
+	runes := []rune(word)
+	if len(runes) <= 2 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-2) + string(runes[len(runes)-1])
+}
+
+func isPIIKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pii := range piiKeys {
+		if strings.Contains(key, pii) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,421 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Component is an element of a screen layout
+type Component interface {
+	ComponentType() string
+}
+
+// InputComponent is a component whose value is exposed as `${form.<name>}`
+type InputComponent interface {
+	Component
+	FieldName() string
+}
+
+// ActionComponent is a component that triggers an action when tapped
+type ActionComponent interface {
+	Component
+	ClickAction() *Action
+}
+
+// ActionName is the name of a Flow JSON action
+type ActionName string
+
+const (
+	ActionNavigate     ActionName = "navigate"
+	ActionDataExchange ActionName = "data_exchange"
+	ActionComplete     ActionName = "complete"
+	ActionUpdateData   ActionName = "update_data"
+	ActionOpenURL      ActionName = "open_url"
+)
+
+func (a ActionName) IsValid() bool {
+	switch a {
+	case ActionNavigate, ActionDataExchange, ActionComplete, ActionUpdateData, ActionOpenURL:
+		return true
+	}
+	return false
+}
+
+// Action is the on-click action of a Footer, OptIn or EmbeddedLink
+type Action struct {
+	Name    ActionName `json:"name"`
+	Next    *Next      `json:"next,omitempty"`
+	URL     string     `json:"url,omitempty"`
+	Payload Payload    `json:"payload,omitempty"`
+}
+
+// Next is the navigation target of a navigate action
+type Next struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// PayloadField is a single key of an action payload
+type PayloadField struct {
+	Key   string
+	Value any
+}
+
+// Payload is the ordered payload of an action
+type Payload []PayloadField
+
+// Keys returns the payload keys in declaration order
+func (p Payload) Keys() []string {
+	keys := make([]string, 0, len(p))
+	for _, field := range p {
+		keys = append(keys, field.Key)
+	}
+	return keys
+}
+
+func (p Payload) MarshalJSON() ([]byte, error) {
+	fields := make([]orderedField, 0, len(p))
+	for _, field := range p {
+		fields = append(fields, orderedField(field))
+	}
+	return marshalObject(fields)
+}
+
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	*p = nil
+	return decodeObject(data, func(key string, raw json.RawMessage) error {
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("payload.%s: %w", key, err)
+		}
+		*p = append(*p, PayloadField{Key: key, Value: value})
+		return nil
+	})
+}
+
+// NavigateTo builds a navigate action to another screen
+func NavigateTo(screen string, payload ...PayloadField) Action {
+	return Action{Name: ActionNavigate, Next: &Next{Type: "screen", Name: screen}, Payload: payload}
+}
+
+// DataExchange builds an action that posts the payload to the flow endpoint
+func DataExchange(payload ...PayloadField) Action {
+	return Action{Name: ActionDataExchange, Payload: payload}
+}
+
+// Complete builds an action that ends the flow and sends the payload to the chat
+func Complete(payload ...PayloadField) Action {
+	return Action{Name: ActionComplete, Payload: payload}
+}
+
+// Field builds a payload entry
+func Field(key string, value any) PayloadField {
+	return PayloadField{Key: key, Value: value}
+}
+
+/*----------- Text -----------*/
+
+type TextHeading struct {
+	Text string `json:"text"`
+}
+
+type TextSubheading struct {
+	Text string `json:"text"`
+}
+
+type TextBody struct {
+	Text          string `json:"text"`
+	FontWeight    string `json:"font-weight,omitempty"`
+	Strikethrough bool   `json:"strikethrough,omitempty"`
+	Markdown      bool   `json:"markdown,omitempty"`
+}
+
+type TextCaption struct {
+	Text          string `json:"text"`
+	FontWeight    string `json:"font-weight,omitempty"`
+	Strikethrough bool   `json:"strikethrough,omitempty"`
+}
+
+/*----------- Inputs -----------*/
+
+// InputType is the keyboard type of a TextInput
+type InputType string
+
+const (
+	InputText     InputType = "text"
+	InputNumber   InputType = "number"
+	InputEmail    InputType = "email"
+	InputPassword InputType = "password"
+	InputPasscode InputType = "passcode"
+	InputPhone    InputType = "phone"
+)
+
+func (t InputType) IsValid() bool {
+	switch t {
+	case InputText, InputNumber, InputEmail, InputPassword, InputPasscode, InputPhone:
+		return true
+	}
+	return false
+}
+
+type TextInput struct {
+	Name       string    `json:"name"`
+	Label      string    `json:"label"`
+	InputType  InputType `json:"input-type,omitempty"`
+	Required   bool      `json:"required,omitempty"`
+	MinChars   int       `json:"min-chars,omitempty"`
+	MaxChars   int       `json:"max-chars,omitempty"`
+	HelperText string    `json:"helper-text,omitempty"`
+	InitValue  string    `json:"init-value,omitempty"`
+}
+
+type TextArea struct {
+	Name       string `json:"name"`
+	Label      string `json:"label"`
+	Required   bool   `json:"required,omitempty"`
+	MaxLength  int    `json:"max-length,omitempty"`
+	HelperText string `json:"helper-text,omitempty"`
+	InitValue  string `json:"init-value,omitempty"`
+}
+
+// Option is an entry of a Dropdown, RadioButtonsGroup or CheckboxGroup
+type Option struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// DataSource is either a static option list or a `${data.x}` binding
+type DataSource any
+
+type Dropdown struct {
+	Name       string     `json:"name"`
+	Label      string     `json:"label"`
+	DataSource DataSource `json:"data-source"`
+	Required   bool       `json:"required,omitempty"`
+}
+
+type RadioButtonsGroup struct {
+	Name       string     `json:"name"`
+	Label      string     `json:"label"`
+	DataSource DataSource `json:"data-source"`
+	Required   bool       `json:"required,omitempty"`
+}
+
+type CheckboxGroup struct {
+	Name       string     `json:"name"`
+	Label      string     `json:"label"`
+	DataSource DataSource `json:"data-source"`
+	Required   bool       `json:"required,omitempty"`
+}
+
+type OptIn struct {
+	Name          string  `json:"name"`
+	Label         string  `json:"label"`
+	Required      bool    `json:"required,omitempty"`
+	OnClickAction *Action `json:"on-click-action,omitempty"`
+}
+
+/*----------- Actions -----------*/
+
+type Footer struct {
+	Label         string `json:"label"`
+	LeftCaption   string `json:"left-caption,omitempty"`
+	CenterCaption string `json:"center-caption,omitempty"`
+	RightCaption  string `json:"right-caption,omitempty"`
+	OnClickAction Action `json:"on-click-action"`
+}
+
+type EmbeddedLink struct {
+	Text          string `json:"text"`
+	OnClickAction Action `json:"on-click-action"`
+}
+
+// RawComponent keeps a component this package does not model, so that
+// parsing never drops data and validation can report the unknown type
+type RawComponent struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+func (TextHeading) ComponentType() string       { return "TextHeading" }
+func (TextSubheading) ComponentType() string    { return "TextSubheading" }
+func (TextBody) ComponentType() string          { return "TextBody" }
+func (TextCaption) ComponentType() string       { return "TextCaption" }
+func (TextInput) ComponentType() string         { return "TextInput" }
+func (TextArea) ComponentType() string          { return "TextArea" }
+func (Dropdown) ComponentType() string          { return "Dropdown" }
+func (RadioButtonsGroup) ComponentType() string { return "RadioButtonsGroup" }
+func (CheckboxGroup) ComponentType() string     { return "CheckboxGroup" }
+func (OptIn) ComponentType() string             { return "OptIn" }
+func (Footer) ComponentType() string            { return "Footer" }
+func (EmbeddedLink) ComponentType() string      { return "EmbeddedLink" }
+func (c RawComponent) ComponentType() string    { return c.Type }
+
+func (c TextInput) FieldName() string         { return c.Name }
+func (c TextArea) FieldName() string          { return c.Name }
+func (c Dropdown) FieldName() string          { return c.Name }
+func (c RadioButtonsGroup) FieldName() string { return c.Name }
+func (c CheckboxGroup) FieldName() string     { return c.Name }
+func (c OptIn) FieldName() string             { return c.Name }
+
+func (c Footer) ClickAction() *Action       { return &c.OnClickAction }
+func (c EmbeddedLink) ClickAction() *Action { return &c.OnClickAction }
+func (c OptIn) ClickAction() *Action        { return c.OnClickAction }
+
+// componentFactories creates an empty value for every modelled component type
+var componentFactories = map[string]func() Component{
+	"TextHeading":       func() Component { return &TextHeading{} },
+	"TextSubheading":    func() Component { return &TextSubheading{} },
+	"TextBody":          func() Component { return &TextBody{} },
+	"TextCaption":       func() Component { return &TextCaption{} },
+	"TextInput":         func() Component { return &TextInput{} },
+	"TextArea":          func() Component { return &TextArea{} },
+	"Dropdown":          func() Component { return &Dropdown{} },
+	"RadioButtonsGroup": func() Component { return &RadioButtonsGroup{} },
+	"CheckboxGroup":     func() Component { return &CheckboxGroup{} },
+	"OptIn":             func() Component { return &OptIn{} },
+	"Footer":            func() Component { return &Footer{} },
+	"EmbeddedLink":      func() Component { return &EmbeddedLink{} },
+}
+
+// IsKnownComponent reports whether the component type is modelled by this package
+func IsKnownComponent(componentType string) bool {
+	_, ok := componentFactories[componentType]
+	return ok
+}
+
+func decodeComponent(data []byte) (Component, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+
+	factory, ok := componentFactories[head.Type]
+	if !ok {
+		return RawComponent{Type: head.Type, Raw: append(json.RawMessage(nil), data...)}, nil
+	}
+
+	ptr := factory()
+	if err := json.Unmarshal(data, ptr); err != nil {
+		return nil, fmt.Errorf("%s: %w", head.Type, err)
+	}
+
+	// Components are used by value, dereference the pointer the factory returned
+	switch c := ptr.(type) {
+	case *TextHeading:
+		return *c, nil
+	case *TextSubheading:
+		return *c, nil
+	case *TextBody:
+		return *c, nil
+	case *TextCaption:
+		return *c, nil
+	case *TextInput:
+		return *c, nil
+	case *TextArea:
+		return *c, nil
+	case *Dropdown:
+		return *c, nil
+	case *RadioButtonsGroup:
+		return *c, nil
+	case *CheckboxGroup:
+		return *c, nil
+	case *OptIn:
+		return *c, nil
+	case *Footer:
+		return *c, nil
+	case *EmbeddedLink:
+		return *c, nil
+	}
+	return ptr, nil
+}
+
+// withType prepends the "type" key to the JSON encoding of a component
+func withType(componentType string, v any) ([]byte, error) {
+	body, err := marshalCompact(v)
+	if err != nil {
+		return nil, err
+	}
+	head, err := marshalCompact(componentType)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(body)+len(head)+8)
+	out = append(out, `{"type":`...)
+	out = append(out, head...)
+	if len(body) > 2 {
+		out = append(out, ',')
+		out = append(out, body[1:]...)
+	} else {
+		out = append(out, '}')
+	}
+	return out, nil
+}
+
+func (c TextHeading) MarshalJSON() ([]byte, error) {
+	type alias TextHeading
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c TextSubheading) MarshalJSON() ([]byte, error) {
+	type alias TextSubheading
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c TextBody) MarshalJSON() ([]byte, error) {
+	type alias TextBody
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c TextCaption) MarshalJSON() ([]byte, error) {
+	type alias TextCaption
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c TextInput) MarshalJSON() ([]byte, error) {
+	type alias TextInput
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c TextArea) MarshalJSON() ([]byte, error) {
+	type alias TextArea
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c Dropdown) MarshalJSON() ([]byte, error) {
+	type alias Dropdown
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c RadioButtonsGroup) MarshalJSON() ([]byte, error) {
+	type alias RadioButtonsGroup
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c CheckboxGroup) MarshalJSON() ([]byte, error) {
+	type alias CheckboxGroup
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c OptIn) MarshalJSON() ([]byte, error) {
+	type alias OptIn
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c Footer) MarshalJSON() ([]byte, error) {
+	type alias Footer
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c EmbeddedLink) MarshalJSON() ([]byte, error) {
+	type alias EmbeddedLink
+	return withType(c.ComponentType(), alias(c))
+}
+
+func (c RawComponent) MarshalJSON() ([]byte, error) {
+	return c.Raw, nil
+}
@@ -0,0 +1,262 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// Version is the Flow JSON version emitted by flows built with this package
+	Version = "7.3"
+	// DataAPIVersion is the data endpoint version for flows backed by our endpoint
+	DataAPIVersion = "3.0"
+	// SingleColumnLayout is the only layout type supported by Flow JSON
+	SingleColumnLayout = "SingleColumnLayout"
+)
+
+// Flow is the root of a WhatsApp Flow JSON document
+type Flow struct {
+	Version        string       `json:"version"`
+	DataAPIVersion string       `json:"data_api_version,omitempty"`
+	RoutingModel   RoutingModel `json:"routing_model,omitempty"`
+	Screens        []Screen     `json:"screens"`
+}
+
+// Screen is a single page of a flow
+type Screen struct {
+	ID       string `json:"id"`
+	Title    string `json:"title,omitempty"`
+	Terminal bool   `json:"terminal,omitempty"`
+	Success  bool   `json:"success,omitempty"`
+	Data     Data   `json:"data,omitempty"`
+	Layout   Layout `json:"layout"`
+}
+
+// Layout holds the components rendered on a screen
+type Layout struct {
+	Type     string      `json:"type"`
+	Children []Component `json:"children"`
+}
+
+// Route lists the screens reachable from a screen
+type Route struct {
+	From string
+	To   []string
+}
+
+// RoutingModel declares screen transitions, preserving declaration order
+type RoutingModel []Route
+
+// DataType is the type of a screen data declaration
+type DataType string
+
+const (
+	TypeString  DataType = "string"
+	TypeNumber  DataType = "number"
+	TypeBoolean DataType = "boolean"
+	TypeObject  DataType = "object"
+	TypeArray   DataType = "array"
+)
+
+func (t DataType) IsValid() bool {
+	switch t {
+	case TypeString, TypeNumber, TypeBoolean, TypeObject, TypeArray:
+		return true
+	}
+	return false
+}
+
+// DataField declares a value a screen expects to receive, with the
+// `__example__` value used by the Flow Builder preview
+type DataField struct {
+	Name       string
+	Type       DataType
+	Items      *DataField
+	Properties []DataField
+	Example    any
+}
+
+// Data is the ordered list of data declarations of a screen
+type Data []DataField
+
+// NewFlow creates an empty flow using the default versions
+func NewFlow() *Flow {
+	return &Flow{
+		Version:        Version,
+		DataAPIVersion: DataAPIVersion,
+	}
+}
+
+// Parse decodes a Flow JSON document
+func Parse(data []byte) (*Flow, error) {
+	var f Flow
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse flow json: %w", err)
+	}
+	return &f, nil
+}
+
+// Marshal encodes the flow in the same layout as the hand-written flow.json:
+// four-space indentation with scalar arrays kept on a single line
+func (f *Flow) Marshal() ([]byte, error) {
+	return marshalIndent(f)
+}
+
+// Screen returns the screen with the given id, or nil when it does not exist
+func (f *Flow) Screen(id string) *Screen {
+	for i := range f.Screens {
+		if f.Screens[i].ID == id {
+			return &f.Screens[i]
+		}
+	}
+	return nil
+}
+
+// AddScreen appends a screen and registers its outgoing routes
+func (f *Flow) AddScreen(screen Screen, routes ...string) *Flow {
+	f.Screens = append(f.Screens, screen)
+	f.RoutingModel = append(f.RoutingModel, Route{From: screen.ID, To: routes})
+	return f
+}
+
+// Routes returns the routing model entry of a screen
+func (r RoutingModel) Routes(from string) ([]string, bool) {
+	for _, route := range r {
+		if route.From == from {
+			return route.To, true
+		}
+	}
+	return nil, false
+}
+
+// Field returns the data declaration with the given name, or nil when it does not exist
+func (d Data) Field(name string) *DataField {
+	for i := range d {
+		if d[i].Name == name {
+			return &d[i]
+		}
+	}
+	return nil
+}
+
+// String declares a string data field
+func String(name string, example string) DataField {
+	return DataField{Name: name, Type: TypeString, Example: example}
+}
+
+// Number declares a number data field
+func Number(name string, example float64) DataField {
+	return DataField{Name: name, Type: TypeNumber, Example: example}
+}
+
+// Boolean declares a boolean data field
+func Boolean(name string, example bool) DataField {
+	return DataField{Name: name, Type: TypeBoolean, Example: example}
+}
+
+// FormRef returns the binding expression for a form field of the current screen
+func FormRef(name string) string {
+	return "${form." + name + "}"
+}
+
+// DataRef returns the binding expression for a data field of the current screen
+func DataRef(name string) string {
+	return "${data." + name + "}"
+}
+
+func (r RoutingModel) MarshalJSON() ([]byte, error) {
+	fields := make([]orderedField, 0, len(r))
+	for _, route := range r {
+		to := route.To
+		if to == nil {
+			to = []string{}
+		}
+		fields = append(fields, orderedField{Key: route.From, Value: to})
+	}
+	return marshalObject(fields)
+}
+
+func (r *RoutingModel) UnmarshalJSON(data []byte) error {
+	*r = nil
+	return decodeObject(data, func(key string, raw json.RawMessage) error {
+		var to []string
+		if err := json.Unmarshal(raw, &to); err != nil {
+			return fmt.Errorf("routing_model.%s: %w", key, err)
+		}
+		*r = append(*r, Route{From: key, To: to})
+		return nil
+	})
+}
+
+func (d Data) MarshalJSON() ([]byte, error) {
+	fields := make([]orderedField, 0, len(d))
+	for _, field := range d {
+		fields = append(fields, orderedField{Key: field.Name, Value: field})
+	}
+	return marshalObject(fields)
+}
+
+func (d *Data) UnmarshalJSON(data []byte) error {
+	*d = nil
+	return decodeObject(data, func(key string, raw json.RawMessage) error {
+		var field DataField
+		if err := json.Unmarshal(raw, &field); err != nil {
+			return fmt.Errorf("data.%s: %w", key, err)
+		}
+		field.Name = key
+		*d = append(*d, field)
+		return nil
+	})
+}
+
+func (f DataField) MarshalJSON() ([]byte, error) {
+	fields := []orderedField{{Key: "type", Value: f.Type}}
+	if f.Items != nil {
+		fields = append(fields, orderedField{Key: "items", Value: f.Items})
+	}
+	if len(f.Properties) > 0 {
+		fields = append(fields, orderedField{Key: "properties", Value: Data(f.Properties)})
+	}
+	if f.Example != nil {
+		fields = append(fields, orderedField{Key: "__example__", Value: f.Example})
+	}
+	return marshalObject(fields)
+}
+
+func (f *DataField) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type       DataType   `json:"type"`
+		Items      *DataField `json:"items"`
+		Properties Data       `json:"properties"`
+		Example    any        `json:"__example__"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.Type = raw.Type
+	f.Items = raw.Items
+	f.Properties = raw.Properties
+	f.Example = raw.Example
+	return nil
+}
+
+func (l *Layout) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type     string            `json:"type"`
+		Children []json.RawMessage `json:"children"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	l.Type = raw.Type
+	l.Children = make([]Component, 0, len(raw.Children))
+	for i, child := range raw.Children {
+		component, err := decodeComponent(child)
+		if err != nil {
+			return fmt.Errorf("children[%d]: %w", i, err)
+		}
+		l.Children = append(l.Children, component)
+	}
+	return nil
+}
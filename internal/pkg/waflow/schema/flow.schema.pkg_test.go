@@ -0,0 +1,171 @@
+package schema
+
+import "testing"
+
+// orderedFlowJSON keeps keys in declaration order, not sorted, and leaves
+// <, > and & unescaped
+const orderedFlowJSON = `{
+    "version": "7.3",
+    "data_api_version": "3.0",
+    "routing_model": {
+        "WELCOME": ["CART"],
+        "CART": []
+    },
+    "screens": [
+        {
+            "id": "WELCOME",
+            "layout": {
+                "type": "SingleColumnLayout",
+                "children": [
+                    {
+                        "type": "Footer",
+                        "label": "Start",
+                        "on-click-action": {
+                            "name": "navigate",
+                            "next": {
+                                "type": "screen",
+                                "name": "CART"
+                            }
+                        }
+                    }
+                ]
+            }
+        },
+        {
+            "id": "CART",
+            "terminal": true,
+            "data": {
+                "total": {
+                    "type": "number",
+                    "__example__": 38800
+                },
+                "note": {
+                    "type": "string",
+                    "__example__": "<no sugar> & ice"
+                }
+            },
+            "layout": {
+                "type": "SingleColumnLayout",
+                "children": [
+                    {
+                        "type": "TextBody",
+                        "text": "${data.note}"
+                    },
+                    {
+                        "type": "Footer",
+                        "label": "Pay",
+                        "on-click-action": {
+                            "name": "complete",
+                            "payload": {
+                                "total": "${data.total}",
+                                "note": "${data.note}"
+                            }
+                        }
+                    }
+                ]
+            }
+        }
+    ]
+}`
+
+func orderedFlow() *Flow {
+	f := NewFlow()
+	f.AddScreen(Screen{
+		ID: "WELCOME",
+		Layout: Layout{Type: SingleColumnLayout, Children: []Component{
+			Footer{Label: "Start", OnClickAction: NavigateTo("CART")},
+		}},
+	}, "CART")
+	f.AddScreen(Screen{
+		ID:       "CART",
+		Terminal: true,
+		Data:     Data{Number("total", 38800), String("note", "<no sugar> & ice")},
+		Layout: Layout{Type: SingleColumnLayout, Children: []Component{
+			TextBody{Text: DataRef("note")},
+			Footer{Label: "Pay", OnClickAction: Complete(Field("total", DataRef("total")), Field("note", DataRef("note")))},
+		}},
+	})
+	return f
+}
+
+func TestMarshalKeepsOrder(t *testing.T) {
+	got, err := orderedFlow().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != orderedFlowJSON {
+		t.Errorf("got\n%s\nwant\n%s", got, orderedFlowJSON)
+	}
+}
+
+func TestParseMarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"ordered flow", orderedFlowJSON},
+		{"unknown component is kept", `{
+    "version": "7.3",
+    "screens": [
+        {
+            "id": "WELCOME",
+            "terminal": true,
+            "layout": {
+                "type": "SingleColumnLayout",
+                "children": [
+                    {
+                        "type": "Carousel",
+                        "images": ["a.png", "b.png"]
+                    }
+                ]
+            }
+        }
+    ]
+}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse([]byte(tt.json))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.json {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.json)
+			}
+
+			// marshalling twice gives the same bytes
+			again, err := f.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != string(got) {
+				t.Error("marshal is not stable")
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"not json", `{"version":`},
+		{"routing model is not an object", `{"version": "7.3", "routing_model": ["WELCOME"], "screens": []}`},
+		{"route is not a list", `{"version": "7.3", "routing_model": {"WELCOME": "CART"}, "screens": []}`},
+		{"bad component", `{"version": "7.3", "screens": [{"id": "WELCOME", "layout": {"type": "SingleColumnLayout", "children": [{"type": "TextBody", "text": 1}]}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.json)); err == nil {
+				t.Error("Parse() succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const indentUnit = "    "
+
+// orderedField is a key/value pair of a JSON object whose key order matters
+type orderedField struct {
+	Key   string
+	Value any
+}
+
+// marshalCompact encodes v without escaping <, > and &, which appear in
+// labels and must be kept readable in flow.json
+func marshalCompact(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func marshalObject(fields []orderedField) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshalCompact(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalCompact(field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Key, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeObject walks a JSON object in document order
+func decodeObject(data []byte, fn func(key string, raw json.RawMessage) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected JSON object, got %v", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", tok)
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if err := fn(key, raw); err != nil {
+			return err
+		}
+	}
+
+	_, err = dec.Token()
+	return err
+}
+
+// marshalIndent renders v with four-space indentation. Arrays that only hold
+// scalars are written on one line, e.g. `"ORDER_FORM": ["SUMMARY_ORDER"]`
+func marshalIndent(v any) ([]byte, error) {
+	compact, err := marshalCompact(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	depth := 0
+	newline := func() {
+		out.WriteByte('\n')
+		out.WriteString(strings.Repeat(indentUnit, depth))
+	}
+
+	for i := 0; i < len(compact); i++ {
+		c := compact[i]
+		switch c {
+		case '"':
+			end := skipString(compact, i)
+			out.Write(compact[i:end])
+			i = end - 1
+		case '{', '[':
+			end := matchingBracket(compact, i)
+			inner := compact[i+1 : end-1]
+			switch {
+			case len(inner) == 0:
+				out.Write(compact[i:end])
+				i = end - 1
+			case c == '[' && isScalarList(inner):
+				out.WriteByte('[')
+				writeInlineList(&out, inner)
+				out.WriteByte(']')
+				i = end - 1
+			default:
+				out.WriteByte(c)
+				depth++
+				newline()
+			}
+		case '}', ']':
+			depth--
+			newline()
+			out.WriteByte(c)
+		case ',':
+			out.WriteByte(',')
+			newline()
+		case ':':
+			out.WriteString(": ")
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// skipString returns the index just past the string literal starting at i
+func skipString(data []byte, i int) int {
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(data)
+}
+
+// matchingBracket returns the index just past the bracket closing the one at i
+func matchingBracket(data []byte, i int) int {
+	depth := 0
+	for j := i; j < len(data); j++ {
+		switch data[j] {
+		case '"':
+			j = skipString(data, j) - 1
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(data)
+}
+
+func isScalarList(inner []byte) bool {
+	for j := 0; j < len(inner); j++ {
+		switch inner[j] {
+		case '"':
+			j = skipString(inner, j) - 1
+		case '{', '[':
+			return false
+		}
+	}
+	return true
+}
+
+func writeInlineList(out *bytes.Buffer, inner []byte) {
+	for j := 0; j < len(inner); j++ {
+		switch inner[j] {
+		case '"':
+			end := skipString(inner, j)
+			out.Write(inner[j:end])
+			j = end - 1
+		case ',':
+			out.WriteString(", ")
+		default:
+			out.WriteByte(inner[j])
+		}
+	}
+}
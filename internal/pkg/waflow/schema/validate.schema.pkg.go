@@ -0,0 +1,526 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	screenIDPattern  = regexp.MustCompile(`^[A-Za-z_]+$`)
+	fieldNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	bindingPattern   = regexp.MustCompile(`\$\{([^}]*)\}`)
+)
+
+// Issue is a single validation problem, located by a JSON-ish path
+type Issue struct {
+	Path    string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Path, i.Message)
+}
+
+// ValidationError collects every issue found in a flow
+type ValidationError []Issue
+
+func (e ValidationError) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, issue := range e {
+		lines = append(lines, issue.String())
+	}
+	return fmt.Sprintf("flow json has %d issue(s):\n  %s", len(e), strings.Join(lines, "\n  "))
+}
+
+type validator struct {
+	flow   *Flow
+	issues ValidationError
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.issues) == 0 {
+		return nil
+	}
+	return v.issues
+}
+
+// Validate checks routing, component names, required fields and data
+// bindings. It returns a ValidationError listing every issue found.
+func (f *Flow) Validate() error {
+	v := &validator{flow: f}
+
+	if f.Version == "" {
+		v.addf("version", "is required")
+	}
+	if len(f.Screens) == 0 {
+		v.addf("screens", "at least one screen is required")
+	}
+
+	seen := make(map[string]bool, len(f.Screens))
+	hasTerminal := false
+	for i := range f.Screens {
+		screen := &f.Screens[i]
+		path := fmt.Sprintf("screens[%d]", i)
+		if screen.ID != "" {
+			path = fmt.Sprintf("screens[%s]", screen.ID)
+		}
+
+		switch {
+		case screen.ID == "":
+			v.addf(path+".id", "is required")
+		case !screenIDPattern.MatchString(screen.ID):
+			v.addf(path+".id", "%q may only contain letters and underscores", screen.ID)
+		case screen.ID == "SUCCESS":
+			v.addf(path+".id", "SUCCESS is reserved by WhatsApp")
+		case seen[screen.ID]:
+			v.addf(path+".id", "duplicate screen id %q", screen.ID)
+		}
+		seen[screen.ID] = true
+
+		if screen.Terminal {
+			hasTerminal = true
+		}
+		v.validateScreen(path, screen)
+	}
+	if len(f.Screens) > 0 && !hasTerminal {
+		v.addf("screens", "at least one screen must be terminal")
+	}
+
+	v.validateRouting()
+
+	return v.err()
+}
+
+func (v *validator) validateRouting() {
+	f := v.flow
+	if len(f.RoutingModel) == 0 {
+		if f.DataAPIVersion != "" {
+			v.addf("routing_model", "is required when data_api_version is set")
+		}
+		return
+	}
+
+	declared := make(map[string]bool, len(f.RoutingModel))
+	for _, route := range f.RoutingModel {
+		path := "routing_model." + route.From
+		if f.Screen(route.From) == nil {
+			v.addf(path, "unknown screen %q", route.From)
+		}
+		if declared[route.From] {
+			v.addf(path, "declared more than once")
+		}
+		declared[route.From] = true
+
+		targets := make(map[string]bool, len(route.To))
+		for _, to := range route.To {
+			switch {
+			case f.Screen(to) == nil:
+				v.addf(path, "routes to unknown screen %q", to)
+			case to == route.From:
+				v.addf(path, "screen cannot route to itself")
+			case targets[to]:
+				v.addf(path, "duplicate route to %q", to)
+			}
+			targets[to] = true
+		}
+	}
+
+	for _, screen := range f.Screens {
+		if screen.ID != "" && !declared[screen.ID] {
+			v.addf("routing_model", "screen %q is missing", screen.ID)
+		}
+	}
+}
+
+func (v *validator) validateScreen(path string, screen *Screen) {
+	if screen.Success && !screen.Terminal {
+		v.addf(path+".success", "is only allowed on terminal screens")
+	}
+
+	for _, field := range screen.Data {
+		v.validateDataField(fmt.Sprintf("%s.data.%s", path, field.Name), field)
+	}
+
+	if screen.Layout.Type != SingleColumnLayout {
+		v.addf(path+".layout.type", "must be %s, got %q", SingleColumnLayout, screen.Layout.Type)
+	}
+	if len(screen.Layout.Children) == 0 {
+		v.addf(path+".layout.children", "at least one component is required")
+	}
+
+	inputs := make(map[string]bool)
+	footers := 0
+	for i, child := range screen.Layout.Children {
+		childPath := fmt.Sprintf("%s.layout.children[%d]", path, i)
+		if child == nil {
+			v.addf(childPath, "component is nil")
+			continue
+		}
+
+		if _, ok := child.(RawComponent); ok {
+			if child.ComponentType() == "" {
+				v.addf(childPath+".type", "is required")
+			} else {
+				v.addf(childPath+".type", "unknown component %q", child.ComponentType())
+			}
+			continue
+		}
+
+		if input, ok := child.(InputComponent); ok {
+			name := input.FieldName()
+			switch {
+			case name == "":
+				v.addf(childPath+".name", "is required")
+			case !fieldNamePattern.MatchString(name):
+				v.addf(childPath+".name", "%q may only contain letters, digits and underscores", name)
+			case inputs[name]:
+				v.addf(childPath+".name", "duplicate input name %q", name)
+			}
+			inputs[name] = true
+		}
+
+		if _, ok := child.(Footer); ok {
+			footers++
+		}
+
+		v.validateComponent(childPath, screen, child)
+	}
+
+	if footers > 1 {
+		v.addf(path+".layout.children", "only one Footer is allowed per screen, found %d", footers)
+	}
+	if screen.Terminal && footers == 0 {
+		v.addf(path+".layout.children", "terminal screens must have a Footer")
+	}
+
+	for i, child := range screen.Layout.Children {
+		if child == nil {
+			continue
+		}
+		if _, ok := child.(RawComponent); ok {
+			continue
+		}
+		v.validateBindings(fmt.Sprintf("%s.layout.children[%d]", path, i), screen, inputs, child)
+	}
+}
+
+func (v *validator) validateDataField(path string, field DataField) {
+	if !fieldNamePattern.MatchString(field.Name) {
+		v.addf(path, "name may only contain letters, digits and underscores")
+	}
+	if !field.Type.IsValid() {
+		v.addf(path+".type", "unsupported type %q", field.Type)
+	}
+	if field.Type == TypeArray && field.Items == nil {
+		v.addf(path+".items", "is required for array fields")
+	}
+	if field.Example == nil {
+		v.addf(path+".__example__", "is required")
+	}
+}
+
+func (v *validator) validateComponent(path string, screen *Screen, component Component) {
+	required := func(field, value string) {
+		if value == "" {
+			v.addf(path+"."+field, "is required")
+		}
+	}
+
+	switch c := component.(type) {
+	case TextHeading:
+		required("text", c.Text)
+	case TextSubheading:
+		required("text", c.Text)
+	case TextBody:
+		required("text", c.Text)
+	case TextCaption:
+		required("text", c.Text)
+	case TextInput:
+		required("label", c.Label)
+		if c.InputType != "" && !c.InputType.IsValid() {
+			v.addf(path+".input-type", "unsupported input type %q", c.InputType)
+		}
+		if c.MinChars > 0 && c.MaxChars > 0 && c.MinChars > c.MaxChars {
+			v.addf(path, "min-chars is greater than max-chars")
+		}
+	case TextArea:
+		required("label", c.Label)
+	case Dropdown:
+		required("label", c.Label)
+		if c.DataSource == nil {
+			v.addf(path+".data-source", "is required")
+		}
+	case RadioButtonsGroup:
+		required("label", c.Label)
+		if c.DataSource == nil {
+			v.addf(path+".data-source", "is required")
+		}
+	case CheckboxGroup:
+		required("label", c.Label)
+		if c.DataSource == nil {
+			v.addf(path+".data-source", "is required")
+		}
+	case OptIn:
+		required("label", c.Label)
+	case Footer:
+		required("label", c.Label)
+	case EmbeddedLink:
+		required("text", c.Text)
+	}
+
+	if ac, ok := component.(ActionComponent); ok {
+		if action := ac.ClickAction(); action != nil {
+			v.validateAction(path+".on-click-action", screen, action)
+		}
+	}
+}
+
+func (v *validator) validateAction(path string, screen *Screen, action *Action) {
+	f := v.flow
+
+	if !action.Name.IsValid() {
+		v.addf(path+".name", "unsupported action %q", action.Name)
+		return
+	}
+
+	switch action.Name {
+	case ActionNavigate:
+		if action.Next == nil || action.Next.Name == "" {
+			v.addf(path+".next", "is required for navigate")
+			return
+		}
+		if f.Screen(action.Next.Name) == nil {
+			v.addf(path+".next.name", "unknown screen %q", action.Next.Name)
+			return
+		}
+		if routes, ok := f.RoutingModel.Routes(screen.ID); ok && len(f.RoutingModel) > 0 {
+			found := false
+			for _, to := range routes {
+				if to == action.Next.Name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				v.addf(path+".next.name", "route %s -> %s is not in routing_model", screen.ID, action.Next.Name)
+			}
+		}
+	case ActionDataExchange:
+		if f.DataAPIVersion == "" {
+			v.addf(path+".name", "data_exchange requires data_api_version")
+		}
+	case ActionComplete:
+		if !screen.Terminal {
+			v.addf(path+".name", "complete is only allowed on terminal screens")
+		}
+	case ActionOpenURL:
+		if action.URL == "" {
+			v.addf(path+".url", "is required for open_url")
+		}
+	}
+}
+
+// validateBindings checks every `${...}` expression found in the component
+func (v *validator) validateBindings(path string, screen *Screen, inputs map[string]bool, component Component) {
+	body, err := json.Marshal(component)
+	if err != nil {
+		v.addf(path, "failed to encode component: %v", err)
+		return
+	}
+
+	var tree any
+	if err := json.Unmarshal(body, &tree); err != nil {
+		v.addf(path, "failed to decode component: %v", err)
+		return
+	}
+
+	walkStrings(path, tree, func(p, s string) {
+		for _, match := range bindingPattern.FindAllStringSubmatch(s, -1) {
+			v.validateBinding(p, screen, inputs, match[1])
+		}
+	})
+}
+
+func (v *validator) validateBinding(path string, screen *Screen, inputs map[string]bool, expr string) {
+	parts := strings.Split(expr, ".")
+
+	// ${screen.<ID>.data.<name>} and ${screen.<ID>.form.<name>} reference another screen
+	if len(parts) == 4 && parts[0] == "screen" {
+		target := v.flow.Screen(parts[1])
+		if target == nil {
+			v.addf(path, "${%s} references unknown screen %q", expr, parts[1])
+			return
+		}
+		screen = target
+		inputs = inputNames(target)
+		parts = parts[2:]
+	}
+
+	if len(parts) != 2 || parts[1] == "" {
+		v.addf(path, "malformed binding ${%s}", expr)
+		return
+	}
+
+	switch parts[0] {
+	case "data":
+		if screen.Data.Field(parts[1]) == nil {
+			v.addf(path, "${%s} is not declared in %s data", expr, screen.ID)
+		}
+	case "form":
+		if !inputs[parts[1]] {
+			v.addf(path, "${%s} does not match any input on %s", expr, screen.ID)
+		}
+	default:
+		v.addf(path, "unknown binding scope in ${%s}", expr)
+	}
+}
+
+func inputNames(screen *Screen) map[string]bool {
+	names := make(map[string]bool)
+	for _, child := range screen.Layout.Children {
+		if input, ok := child.(InputComponent); ok {
+			names[input.FieldName()] = true
+		}
+	}
+	return names
+}
+
+func walkStrings(path string, node any, fn func(path, value string)) {
+	switch n := node.(type) {
+	case string:
+		fn(path, n)
+	case map[string]any:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkStrings(path+"."+k, n[k], fn)
+		}
+	case []any:
+		for i, item := range n {
+			walkStrings(fmt.Sprintf("%s[%d]", path, i), item, fn)
+		}
+	}
+}
+
+// CheckPayload verifies that the on-click action of the screen sends exactly
+// the JSON fields of v, so the flow cannot drift from the struct the
+// endpoint decodes it into
+func (f *Flow) CheckPayload(screenID string, action ActionName, v any) error {
+	val := &validator{flow: f}
+	path := fmt.Sprintf("screens[%s]", screenID)
+
+	screen := f.Screen(screenID)
+	if screen == nil {
+		val.addf(path, "screen does not exist")
+		return val.err()
+	}
+
+	var payload Payload
+	found := false
+	for i, child := range screen.Layout.Children {
+		ac, ok := child.(ActionComponent)
+		if !ok || ac.ClickAction() == nil || ac.ClickAction().Name != action {
+			continue
+		}
+		payload = ac.ClickAction().Payload
+		path = fmt.Sprintf("%s.layout.children[%d].on-click-action.payload", path, i)
+		found = true
+		break
+	}
+	if !found {
+		val.addf(path, "no %s action found", action)
+		return val.err()
+	}
+
+	val.compareFields(path, payload.Keys(), JSONFields(v), true)
+	return val.err()
+}
+
+// CheckData verifies that the screen declares every JSON field of v, which
+// is what the endpoint returns for that screen
+func (f *Flow) CheckData(screenID string, v any) error {
+	val := &validator{flow: f}
+	path := fmt.Sprintf("screens[%s].data", screenID)
+
+	screen := f.Screen(screenID)
+	if screen == nil {
+		val.addf(path, "screen does not exist")
+		return val.err()
+	}
+
+	declared := make([]string, 0, len(screen.Data))
+	for _, field := range screen.Data {
+		declared = append(declared, field.Name)
+	}
+
+	val.compareFields(path, declared, JSONFields(v), false)
+	return val.err()
+}
+
+func (v *validator) compareFields(path string, actual, expected []string, exact bool) {
+	has := make(map[string]bool, len(actual))
+	for _, name := range actual {
+		has[name] = true
+	}
+	want := make(map[string]bool, len(expected))
+	for _, name := range expected {
+		want[name] = true
+		if !has[name] {
+			v.addf(path, "missing field %q", name)
+		}
+	}
+	if !exact {
+		return
+	}
+	for _, name := range actual {
+		if !want[name] {
+			v.addf(path, "unexpected field %q", name)
+		}
+	}
+}
+
+// JSONFields returns the JSON names of the exported fields of a struct,
+// including fields promoted from embedded structs
+func JSONFields(v any) []string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var names []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			names = append(names, JSONFields(reflect.New(field.Type).Interface())...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
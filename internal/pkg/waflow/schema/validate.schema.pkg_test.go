@@ -0,0 +1,352 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// validFlow is a two screen order flow that passes Validate
+func validFlow() *Flow {
+	f := NewFlow()
+	f.AddScreen(Screen{
+		ID:    "ORDER_FORM",
+		Title: "Order",
+		Data:  Data{String("product", "Kopi Susu")},
+		Layout: Layout{Type: SingleColumnLayout, Children: []Component{
+			TextHeading{Text: DataRef("product")},
+			TextInput{Name: "qty", Label: "Quantity", InputType: InputNumber, Required: true},
+			Footer{Label: "Next", OnClickAction: NavigateTo("SUMMARY", Field("qty", FormRef("qty")))},
+		}},
+	}, "SUMMARY")
+	f.AddScreen(Screen{
+		ID:       "SUMMARY",
+		Title:    "Summary",
+		Terminal: true,
+		Success:  true,
+		Data:     Data{Number("total", 38800)},
+		Layout: Layout{Type: SingleColumnLayout, Children: []Component{
+			TextBody{Text: "Total ${data.total} for ${screen.ORDER_FORM.form.qty} items"},
+			Footer{Label: "Pay", OnClickAction: Complete(Field("total", DataRef("total")))},
+		}},
+	})
+	return f
+}
+
+func TestValidFlow(t *testing.T) {
+	if err := validFlow().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateReportsIssues(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(f *Flow)
+		want   string
+	}{
+		{
+			name:   "missing version",
+			mutate: func(f *Flow) { f.Version = "" },
+			want:   "version: is required",
+		},
+		{
+			name:   "no screens",
+			mutate: func(f *Flow) { f.Screens, f.RoutingModel = nil, nil },
+			want:   "screens: at least one screen is required",
+		},
+		{
+			name:   "invalid screen id",
+			mutate: func(f *Flow) { f.Screens[0].ID = "order-form" },
+			want:   `screens[order-form].id: "order-form" may only contain letters and underscores`,
+		},
+		{
+			name:   "reserved screen id",
+			mutate: func(f *Flow) { f.Screens[1].ID = "SUCCESS" },
+			want:   "screens[SUCCESS].id: SUCCESS is reserved by WhatsApp",
+		},
+		{
+			name:   "duplicate screen id",
+			mutate: func(f *Flow) { f.Screens[1].ID = "ORDER_FORM" },
+			want:   `screens[ORDER_FORM].id: duplicate screen id "ORDER_FORM"`,
+		},
+		{
+			name:   "no terminal screen",
+			mutate: func(f *Flow) { f.Screens[1].Terminal = false },
+			want:   "screens: at least one screen must be terminal",
+		},
+		{
+			name:   "success on a screen that is not terminal",
+			mutate: func(f *Flow) { f.Screens[0].Success = true },
+			want:   "screens[ORDER_FORM].success: is only allowed on terminal screens",
+		},
+		{
+			name:   "data field without example",
+			mutate: func(f *Flow) { f.Screens[0].Data[0].Example = nil },
+			want:   "screens[ORDER_FORM].data.product.__example__: is required",
+		},
+		{
+			name: "array field without items",
+			mutate: func(f *Flow) {
+				f.Screens[0].Data = append(f.Screens[0].Data, DataField{Name: "items", Type: TypeArray, Example: []any{}})
+			},
+			want: "screens[ORDER_FORM].data.items.items: is required for array fields",
+		},
+		{
+			name:   "wrong layout",
+			mutate: func(f *Flow) { f.Screens[0].Layout.Type = "TwoColumnLayout" },
+			want:   `screens[ORDER_FORM].layout.type: must be SingleColumnLayout, got "TwoColumnLayout"`,
+		},
+		{
+			name:   "routing model missing with data api",
+			mutate: func(f *Flow) { f.RoutingModel = nil },
+			want:   "routing_model: is required when data_api_version is set",
+		},
+		{
+			name:   "screen missing from routing model",
+			mutate: func(f *Flow) { f.RoutingModel = f.RoutingModel[:1] },
+			want:   `routing_model: screen "SUMMARY" is missing`,
+		},
+		{
+			name:   "route to unknown screen",
+			mutate: func(f *Flow) { f.RoutingModel[0].To = []string{"SUMMARY", "PAYMENT"} },
+			want:   `routing_model.ORDER_FORM: routes to unknown screen "PAYMENT"`,
+		},
+		{
+			name:   "route to itself",
+			mutate: func(f *Flow) { f.RoutingModel[0].To = []string{"SUMMARY", "ORDER_FORM"} },
+			want:   "routing_model.ORDER_FORM: screen cannot route to itself",
+		},
+		{
+			name:   "navigate outside the routing model",
+			mutate: func(f *Flow) { f.RoutingModel[0].To = []string{} },
+			want:   "screens[ORDER_FORM].layout.children[2].on-click-action.next.name: route ORDER_FORM -> SUMMARY is not in routing_model",
+		},
+		{
+			name: "navigate to unknown screen",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children[2] = Footer{Label: "Next", OnClickAction: NavigateTo("PAYMENT")}
+			},
+			want: `screens[ORDER_FORM].layout.children[2].on-click-action.next.name: unknown screen "PAYMENT"`,
+		},
+		{
+			name: "complete on a screen that is not terminal",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children[2] = Footer{Label: "Next", OnClickAction: Complete()}
+			},
+			want: "screens[ORDER_FORM].layout.children[2].on-click-action.name: complete is only allowed on terminal screens",
+		},
+		{
+			name: "data exchange without data api",
+			mutate: func(f *Flow) {
+				f.DataAPIVersion = ""
+				f.Screens[0].Layout.Children[2] = Footer{Label: "Next", OnClickAction: DataExchange()}
+			},
+			want: "screens[ORDER_FORM].layout.children[2].on-click-action.name: data_exchange requires data_api_version",
+		},
+		{
+			name: "unsupported action",
+			mutate: func(f *Flow) {
+				f.Screens[1].Layout.Children[1] = Footer{Label: "Pay", OnClickAction: Action{Name: "submit"}}
+			},
+			want: `screens[SUMMARY].layout.children[1].on-click-action.name: unsupported action "submit"`,
+		},
+		{
+			name: "open url without url",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children = append(f.Screens[0].Layout.Children, EmbeddedLink{Text: "Terms", OnClickAction: Action{Name: ActionOpenURL}})
+			},
+			want: "screens[ORDER_FORM].layout.children[3].on-click-action.url: is required for open_url",
+		},
+		{
+			name: "two footers",
+			mutate: func(f *Flow) {
+				f.Screens[1].Layout.Children = append(f.Screens[1].Layout.Children, Footer{Label: "Again", OnClickAction: Complete()})
+			},
+			want: "screens[SUMMARY].layout.children: only one Footer is allowed per screen, found 2",
+		},
+		{
+			name:   "terminal screen without footer",
+			mutate: func(f *Flow) { f.Screens[1].Layout.Children = f.Screens[1].Layout.Children[:1] },
+			want:   "screens[SUMMARY].layout.children: terminal screens must have a Footer",
+		},
+		{
+			name:   "no components",
+			mutate: func(f *Flow) { f.Screens[0].Layout.Children = nil },
+			want:   "screens[ORDER_FORM].layout.children: at least one component is required",
+		},
+		{
+			name: "unknown component",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children = append(f.Screens[0].Layout.Children, RawComponent{Type: "Carousel"})
+			},
+			want: `screens[ORDER_FORM].layout.children[3].type: unknown component "Carousel"`,
+		},
+		{
+			name:   "input without label",
+			mutate: func(f *Flow) { f.Screens[0].Layout.Children[1] = TextInput{Name: "qty"} },
+			want:   "screens[ORDER_FORM].layout.children[1].label: is required",
+		},
+		{
+			name:   "invalid input name",
+			mutate: func(f *Flow) { f.Screens[0].Layout.Children[1] = TextInput{Name: "qty-1", Label: "Quantity"} },
+			want:   `screens[ORDER_FORM].layout.children[1].name: "qty-1" may only contain letters, digits and underscores`,
+		},
+		{
+			name: "duplicate input name",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children = append(f.Screens[0].Layout.Children, TextInput{Name: "qty", Label: "Again"})
+			},
+			want: `screens[ORDER_FORM].layout.children[3].name: duplicate input name "qty"`,
+		},
+		{
+			name: "unsupported input type",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children[1] = TextInput{Name: "qty", Label: "Quantity", InputType: "date"}
+			},
+			want: `screens[ORDER_FORM].layout.children[1].input-type: unsupported input type "date"`,
+		},
+		{
+			name: "min chars above max chars",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children[1] = TextInput{Name: "qty", Label: "Quantity", MinChars: 5, MaxChars: 2}
+			},
+			want: "screens[ORDER_FORM].layout.children[1]: min-chars is greater than max-chars",
+		},
+		{
+			name:   "dropdown without data source",
+			mutate: func(f *Flow) { f.Screens[0].Layout.Children[1] = Dropdown{Name: "qty", Label: "Quantity"} },
+			want:   "screens[ORDER_FORM].layout.children[1].data-source: is required",
+		},
+		{
+			name:   "undeclared data binding",
+			mutate: func(f *Flow) { f.Screens[0].Layout.Children[0] = TextHeading{Text: DataRef("price")} },
+			want:   "screens[ORDER_FORM].layout.children[0].text: ${data.price} is not declared in ORDER_FORM data",
+		},
+		{
+			name: "form binding without input",
+			mutate: func(f *Flow) {
+				f.Screens[0].Layout.Children[2] = Footer{Label: "Next", OnClickAction: NavigateTo("SUMMARY", Field("qty", FormRef("quantity")))}
+			},
+			want: "screens[ORDER_FORM].layout.children[2].on-click-action.payload.qty: ${form.quantity} does not match any input on ORDER_FORM",
+		},
+		{
+			name:   "binding to unknown screen",
+			mutate: func(f *Flow) { f.Screens[1].Layout.Children[0] = TextBody{Text: "${screen.CART.data.total}"} },
+			want:   `screens[SUMMARY].layout.children[0].text: ${screen.CART.data.total} references unknown screen "CART"`,
+		},
+		{
+			name:   "binding to another screen's missing input",
+			mutate: func(f *Flow) { f.Screens[1].Layout.Children[0] = TextBody{Text: "${screen.ORDER_FORM.form.size}"} },
+			want:   "screens[SUMMARY].layout.children[0].text: ${screen.ORDER_FORM.form.size} does not match any input on ORDER_FORM",
+		},
+		{
+			name:   "malformed binding",
+			mutate: func(f *Flow) { f.Screens[1].Layout.Children[0] = TextBody{Text: "${data}"} },
+			want:   "screens[SUMMARY].layout.children[0].text: malformed binding ${data}",
+		},
+		{
+			name:   "unknown binding scope",
+			mutate: func(f *Flow) { f.Screens[1].Layout.Children[0] = TextBody{Text: "${env.total}"} },
+			want:   "screens[SUMMARY].layout.children[0].text: unknown binding scope in ${env.total}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := validFlow()
+			tt.mutate(f)
+
+			var issues ValidationError
+			if err := f.Validate(); !errors.As(err, &issues) {
+				t.Fatalf("Validate() = %v, want a ValidationError", err)
+			}
+			for _, issue := range issues {
+				if issue.String() == tt.want {
+					return
+				}
+			}
+			t.Errorf("missing issue %q in\n%s", tt.want, issues.Error())
+		})
+	}
+}
+
+func TestValidateListsEveryIssue(t *testing.T) {
+	f := validFlow()
+	f.Version = ""
+	f.Screens[0].Success = true
+	f.Screens[1].Layout.Children = f.Screens[1].Layout.Children[:1]
+
+	err := f.Validate()
+	var issues ValidationError
+	if !errors.As(err, &issues) || len(issues) != 3 {
+		t.Fatalf("Validate() = %v, want 3 issues", err)
+	}
+	if !strings.HasPrefix(err.Error(), "flow json has 3 issue(s):") {
+		t.Errorf("error = %q", err.Error())
+	}
+}
+
+func TestCheckPayload(t *testing.T) {
+	type orderPayload struct {
+		Qty string `json:"qty"`
+	}
+	type extraPayload struct {
+		Qty  string `json:"qty"`
+		Note string `json:"note"`
+	}
+	type fewerPayload struct{}
+
+	tests := []struct {
+		name   string
+		screen string
+		action ActionName
+		v      any
+		want   string
+	}{
+		{"matches", "ORDER_FORM", ActionNavigate, orderPayload{}, ""},
+		{"missing field", "ORDER_FORM", ActionNavigate, extraPayload{}, `screens[ORDER_FORM].layout.children[2].on-click-action.payload: missing field "note"`},
+		{"unexpected field", "ORDER_FORM", ActionNavigate, fewerPayload{}, `screens[ORDER_FORM].layout.children[2].on-click-action.payload: unexpected field "qty"`},
+		{"no such action", "ORDER_FORM", ActionDataExchange, orderPayload{}, "screens[ORDER_FORM]: no data_exchange action found"},
+		{"no such screen", "CART", ActionNavigate, orderPayload{}, "screens[CART]: screen does not exist"},
+	}
+
+	f := validFlow()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := f.CheckPayload(tt.screen, tt.action, tt.v)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var issues ValidationError
+			if !errors.As(err, &issues) || len(issues) != 1 || issues[0].String() != tt.want {
+				t.Errorf("CheckPayload() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckData(t *testing.T) {
+	type Summary struct {
+		Total int `json:"total"`
+	}
+	// fields of an embedded struct count too
+	type summaryWithFee struct {
+		Summary
+		Fee int `json:"fee"`
+	}
+
+	f := validFlow()
+	if err := f.CheckData("SUMMARY", Summary{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var issues ValidationError
+	err := f.CheckData("SUMMARY", summaryWithFee{})
+	if !errors.As(err, &issues) || len(issues) != 1 || issues[0].String() != `screens[SUMMARY].data: missing field "fee"` {
+		t.Errorf("CheckData() = %v, want the missing fee", err)
+	}
+}
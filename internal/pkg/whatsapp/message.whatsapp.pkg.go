@@ -0,0 +1,280 @@
+package whatsapp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// message is the body of POST /{phone-number-id}/messages
+type message struct {
+	MessagingProduct string       `json:"messaging_product"`
+	RecipientType    string       `json:"recipient_type"`
+	To               string       `json:"to"`
+	Type             string       `json:"type"`
+	Text             *textBody    `json:"text,omitempty"`
+	Template         *Template    `json:"template,omitempty"`
+	Interactive      *interactive `json:"interactive,omitempty"`
+	Image            *Media       `json:"image,omitempty"`
+	Document         *Media       `json:"document,omitempty"`
+}
+
+type textBody struct {
+	Body       string `json:"body"`
+	PreviewURL bool   `json:"preview_url,omitempty"`
+}
+
+type interactive struct {
+	Type   string             `json:"type"`
+	Header *interactiveHeader `json:"header,omitempty"`
+	Body   *textField         `json:"body,omitempty"`
+	Footer *textField         `json:"footer,omitempty"`
+	Action interactiveAction  `json:"action"`
+}
+
+type interactiveHeader struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+type textField struct {
+	Text string `json:"text"`
+}
+
+type interactiveAction struct {
+	Name       string      `json:"name"`
+	Parameters interface{} `json:"parameters"`
+}
+
+// Media is an image or document, sent by public link or uploaded media id
+type Media struct {
+	ID       string `json:"id,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"` // documents only
+}
+
+// Template is a pre-approved message template
+type Template struct {
+	Name       string              `json:"name"`
+	Language   TemplateLanguage    `json:"language"`
+	Components []TemplateComponent `json:"components,omitempty"`
+}
+
+type TemplateLanguage struct {
+	Code string `json:"code"`
+}
+
+type TemplateComponent struct {
+	Type       string              `json:"type"`
+	SubType    string              `json:"sub_type,omitempty"`
+	Index      string              `json:"index,omitempty"`
+	Parameters []TemplateParameter `json:"parameters"`
+}
+
+type TemplateParameter struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// NewTemplate creates a template message in the given language
+func NewTemplate(name, language string, components ...TemplateComponent) Template {
+	return Template{
+		Name:       name,
+		Language:   TemplateLanguage{Code: language},
+		Components: components,
+	}
+}
+
+// Template creates a template message in the configured language
+func (c *Client) Template(name string, components ...TemplateComponent) Template {
+	return NewTemplate(name, c.cfg.TemplateLanguage, components...)
+}
+
+// BodyParams fills the {{1}}, {{2}}, ... placeholders of the template body
+func BodyParams(values ...string) TemplateComponent {
+	params := make([]TemplateParameter, 0, len(values))
+	for _, value := range values {
+		params = append(params, TemplateParameter{Type: "text", Text: value})
+	}
+	return TemplateComponent{Type: "body", Parameters: params}
+}
+
+// URLButtonParam fills the dynamic suffix of a URL button
+func URLButtonParam(index int, suffix string) TemplateComponent {
+	return TemplateComponent{
+		Type:       "button",
+		SubType:    "url",
+		Index:      strconv.Itoa(index),
+		Parameters: []TemplateParameter{{Type: "text", Text: suffix}},
+	}
+}
+
+// FlowMessage opens a published WhatsApp Flow
+type FlowMessage struct {
+	FlowID    string
+	FlowCTA   string // button label
+	Header    string
+	Body      string
+	Footer    string
+	FlowToken string // minted when empty
+	Draft     bool   // send the draft version of the flow
+
+	// Screen and Data start the flow on a screen with initial data
+	// (flow_action navigate). Without a screen the client asks the endpoint
+	// with INIT (flow_action data_exchange).
+	Screen string
+	Data   map[string]interface{}
+}
+
+type flowParameters struct {
+	FlowMessageVersion string             `json:"flow_message_version"`
+	FlowToken          string             `json:"flow_token"`
+	FlowID             string             `json:"flow_id"`
+	FlowCTA            string             `json:"flow_cta"`
+	FlowAction         string             `json:"flow_action"`
+	Mode               string             `json:"mode,omitempty"`
+	FlowActionPayload  *flowActionPayload `json:"flow_action_payload,omitempty"`
+}
+
+type flowActionPayload struct {
+	Screen string                 `json:"screen"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// PaymentLink is an interactive message with a single URL button
+type PaymentLink struct {
+	Header     string
+	Body       string
+	Footer     string
+	ButtonText string
+	URL        string
+}
+
+type ctaURLParameters struct {
+	DisplayText string `json:"display_text"`
+	URL         string `json:"url"`
+}
+
+// SendText sends a plain text message. Free-form messages are only
+// delivered inside the 24 hour customer service window.
+func (c *Client) SendText(ctx context.Context, to, body string) (*SendResult, error) {
+	return c.send(ctx, &message{
+		To:   to,
+		Type: "text",
+		Text: &textBody{Body: body, PreviewURL: true},
+	})
+}
+
+// SendTemplate sends a pre-approved template, allowed outside the 24 hour window
+func (c *Client) SendTemplate(ctx context.Context, to string, template Template) (*SendResult, error) {
+	if template.Name == "" {
+		return nil, fmt.Errorf("template name is required")
+	}
+	return c.send(ctx, &message{
+		To:       to,
+		Type:     "template",
+		Template: &template,
+	})
+}
+
+// SendFlow sends an interactive flow message. The flow_token is returned in
+// the result so it can be matched with the endpoint requests.
+func (c *Client) SendFlow(ctx context.Context, to string, flow FlowMessage) (*SendResult, error) {
+	if flow.FlowID == "" || flow.FlowCTA == "" || flow.Body == "" {
+		return nil, fmt.Errorf("flow id, CTA and body are required")
+	}
+
+	if flow.FlowToken == "" {
+		token, err := NewFlowToken()
+		if err != nil {
+			return nil, err
+		}
+		flow.FlowToken = token
+	}
+
+	params := flowParameters{
+		FlowMessageVersion: "3",
+		FlowToken:          flow.FlowToken,
+		FlowID:             flow.FlowID,
+		FlowCTA:            flow.FlowCTA,
+		FlowAction:         "data_exchange",
+	}
+	if flow.Screen != "" {
+		params.FlowAction = "navigate"
+		params.FlowActionPayload = &flowActionPayload{Screen: flow.Screen, Data: flow.Data}
+	}
+	if flow.Draft {
+		params.Mode = "draft"
+	}
+
+	result, err := c.send(ctx, &message{
+		To:          to,
+		Type:        "interactive",
+		Interactive: newInteractive("flow", flow.Header, flow.Body, flow.Footer, "flow", params),
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.FlowToken = flow.FlowToken
+	return result, nil
+}
+
+// SendPaymentLink sends a CTA URL button, e.g. the Snap payment page
+func (c *Client) SendPaymentLink(ctx context.Context, to string, link PaymentLink) (*SendResult, error) {
+	if link.URL == "" || link.Body == "" {
+		return nil, fmt.Errorf("payment link URL and body are required")
+	}
+	if link.ButtonText == "" {
+		link.ButtonText = "Bayar Sekarang"
+	}
+
+	return c.send(ctx, &message{
+		To:   to,
+		Type: "interactive",
+		Interactive: newInteractive("cta_url", link.Header, link.Body, link.Footer, "cta_url", ctaURLParameters{
+			DisplayText: link.ButtonText,
+			URL:         link.URL,
+		}),
+	})
+}
+
+// SendImage sends an image by link or media id
+func (c *Client) SendImage(ctx context.Context, to string, image Media) (*SendResult, error) {
+	if image.ID == "" && image.Link == "" {
+		return nil, fmt.Errorf("image id or link is required")
+	}
+	image.Filename = ""
+	return c.send(ctx, &message{
+		To:    to,
+		Type:  "image",
+		Image: &image,
+	})
+}
+
+// SendDocument sends a document (e.g. an invoice PDF) by link or media id
+func (c *Client) SendDocument(ctx context.Context, to string, document Media) (*SendResult, error) {
+	if document.ID == "" && document.Link == "" {
+		return nil, fmt.Errorf("document id or link is required")
+	}
+	return c.send(ctx, &message{
+		To:       to,
+		Type:     "document",
+		Document: &document,
+	})
+}
+
+func newInteractive(kind, header, body, footer, actionName string, params interface{}) *interactive {
+	i := &interactive{
+		Type:   kind,
+		Body:   &textField{Text: body},
+		Action: interactiveAction{Name: actionName, Parameters: params},
+	}
+	if header != "" {
+		i.Header = &interactiveHeader{Type: "text", Text: header}
+	}
+	if footer != "" {
+		i.Footer = &textField{Text: footer}
+	}
+	return i
+}
@@ -0,0 +1,157 @@
+package whatsapp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the raw body, keyed with the app secret
+const SignatureHeader = "X-Hub-Signature-256"
+
+// WebhookPayload is the body of a webhook notification
+type WebhookPayload struct {
+	Object string         `json:"object"`
+	Entry  []WebhookEntry `json:"entry"`
+}
+
+type WebhookEntry struct {
+	ID      string          `json:"id"`
+	Changes []WebhookChange `json:"changes"`
+}
+
+type WebhookChange struct {
+	Field string       `json:"field"`
+	Value WebhookValue `json:"value"`
+}
+
+type WebhookValue struct {
+	MessagingProduct string           `json:"messaging_product"`
+	Metadata         WebhookMetadata  `json:"metadata"`
+	Contacts         []WebhookContact `json:"contacts,omitempty"`
+	Messages         []InboundMessage `json:"messages,omitempty"`
+	Statuses         []MessageStatus  `json:"statuses,omitempty"`
+}
+
+type WebhookMetadata struct {
+	DisplayPhoneNumber string `json:"display_phone_number"`
+	PhoneNumberID      string `json:"phone_number_id"`
+}
+
+type WebhookContact struct {
+	WAID    string `json:"wa_id"`
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+}
+
+// InboundMessage is a message sent by a customer
+type InboundMessage struct {
+	ID          string              `json:"id"`
+	From        string              `json:"from"`
+	Timestamp   string              `json:"timestamp"`
+	Type        string              `json:"type"`
+	Text        *InboundText        `json:"text,omitempty"`
+	Interactive *InboundInteractive `json:"interactive,omitempty"`
+	Button      *InboundButton      `json:"button,omitempty"`
+	Image       *Media              `json:"image,omitempty"`
+	Document    *Media              `json:"document,omitempty"`
+}
+
+type InboundText struct {
+	Body string `json:"body"`
+}
+
+type InboundInteractive struct {
+	Type        string     `json:"type"` // nfm_reply, button_reply, list_reply
+	NFMReply    *NFMReply  `json:"nfm_reply,omitempty"`
+	ButtonReply *ReplyItem `json:"button_reply,omitempty"`
+	ListReply   *ReplyItem `json:"list_reply,omitempty"`
+}
+
+// NFMReply is sent when a customer completes a flow
+type NFMReply struct {
+	Name         string `json:"name"`
+	Body         string `json:"body"`
+	ResponseJSON string `json:"response_json"`
+}
+
+type ReplyItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// InboundButton is a quick reply button of a template
+type InboundButton struct {
+	Payload string `json:"payload"`
+	Text    string `json:"text"`
+}
+
+// MessageStatus reports the delivery of a sent message
+type MessageStatus struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"` // sent, delivered, read, failed
+	Timestamp   string `json:"timestamp"`
+	RecipientID string `json:"recipient_id"`
+	Errors      []struct {
+		Code  int    `json:"code"`
+		Title string `json:"title"`
+	} `json:"errors,omitempty"`
+}
+
+// FlowResponse decodes the response_json of a completed flow
+func (r *NFMReply) FlowResponse() (map[string]interface{}, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(r.ResponseJSON), &data); err != nil {
+		return nil, fmt.Errorf("failed to parse flow response: %w", err)
+	}
+	return data, nil
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header ("sha256=<hex>")
+// against the raw request body
+func (c *Client) VerifySignature(body []byte, signature string) bool {
+	if c.cfg.AppSecret == "" {
+		return false
+	}
+
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.cfg.AppSecret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// VerifyChallenge checks the hub.mode and hub.verify_token of the GET
+// subscription request
+func (c *Client) VerifyChallenge(mode, token string) bool {
+	if c.cfg.VerifyToken == "" || mode != "subscribe" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.cfg.VerifyToken)) == 1
+}
+
+// WebhookConfigured reports whether inbound webhooks can be verified
+func (c *Client) WebhookConfigured() bool {
+	return c != nil && c.cfg.AppSecret != ""
+}
+
+// ParseWebhook decodes a verified webhook body
+func ParseWebhook(body []byte) (*WebhookPayload, error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+	return &payload, nil
+}
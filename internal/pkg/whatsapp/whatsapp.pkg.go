@@ -0,0 +1,198 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL    = "https://graph.facebook.com"
+	DefaultAPIVersion = "v21.0"
+)
+
+type Config struct {
+	BaseURL       string // Graph API host, point it at a local stub in development
+	APIVersion    string
+	PhoneNumberID string
+	AccessToken   string
+
+	// Webhook settings
+	AppSecret   string // signs X-Hub-Signature-256
+	VerifyToken string // echoed back by the GET challenge
+
+	// DefaultCountryCode replaces the leading 0 of local numbers (e.g. "62")
+	DefaultCountryCode string
+	TemplateLanguage   string // language code used by Template, e.g. "id"
+	Timeout            time.Duration
+}
+
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// SendResult is the Graph API answer to a sent message
+type SendResult struct {
+	MessageID string `json:"message_id"`
+	WAID      string `json:"wa_id"`
+	FlowToken string `json:"flow_token,omitempty"` // only set for flow messages
+}
+
+// APIError is the error object returned by the Graph API
+type APIError struct {
+	StatusCode   int    `json:"-"`
+	Message      string `json:"message"`
+	Type         string `json:"type"`
+	Code         int    `json:"code"`
+	ErrorSubcode int    `json:"error_subcode"`
+	FBTraceID    string `json:"fbtrace_id"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("whatsapp api error (status %d, code %d): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// ErrCodeReengagement is returned for a free-form message sent more than 24
+// hours after the customer's last message, only templates are allowed then
+const ErrCodeReengagement = 131047
+
+// IsOutsideWindow reports whether err is the Graph API refusing a free-form
+// message outside the 24 hour customer service window. Retrying does not help.
+func IsOutsideWindow(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == ErrCodeReengagement
+}
+
+func Setup(cfg *Config) *Client {
+	c := *cfg
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+	if c.APIVersion == "" {
+		c.APIVersion = DefaultAPIVersion
+	}
+	if c.TemplateLanguage == "" {
+		c.TemplateLanguage = "id"
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 15 * time.Second
+	}
+
+	return &Client{
+		cfg:  c,
+		http: &http.Client{Timeout: c.Timeout},
+	}
+}
+
+// Enabled reports whether messages can be sent
+func (c *Client) Enabled() bool {
+	return c != nil && c.cfg.PhoneNumberID != "" && c.cfg.AccessToken != ""
+}
+
+// NormalizePhone turns a customer phone number into the digits-only
+// international format the Cloud API expects
+func (c *Client) NormalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	if c.cfg.DefaultCountryCode != "" && strings.HasPrefix(digits, "0") {
+		digits = c.cfg.DefaultCountryCode + strings.TrimPrefix(digits, "0")
+	}
+	return digits
+}
+
+// NewFlowToken mints an unguessable flow_token
+func NewFlowToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate flow token: %w", err)
+	}
+	return "ft_" + hex.EncodeToString(b), nil
+}
+
+func (c *Client) messagesURL() string {
+	return fmt.Sprintf("%s/%s/%s/messages", c.cfg.BaseURL, c.cfg.APIVersion, c.cfg.PhoneNumberID)
+}
+
+// send posts a message to the messages endpoint
+func (c *Client) send(ctx context.Context, msg *message) (*SendResult, error) {
+	if !c.Enabled() {
+		return nil, fmt.Errorf("whatsapp client is not configured")
+	}
+
+	msg.MessagingProduct = "whatsapp"
+	msg.RecipientType = "individual"
+	msg.To = c.NormalizePhone(msg.To)
+	if msg.To == "" {
+		return nil, fmt.Errorf("recipient phone number is empty")
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.messagesURL(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.cfg.AccessToken)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		var errResp struct {
+			Error *APIError `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &errResp); err != nil || errResp.Error == nil {
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+		}
+		errResp.Error.StatusCode = resp.StatusCode
+		return nil, errResp.Error
+	}
+
+	var sent struct {
+		Contacts []struct {
+			WAID string `json:"wa_id"`
+		} `json:"contacts"`
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(respBody, &sent); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	result := &SendResult{}
+	if len(sent.Messages) > 0 {
+		result.MessageID = sent.Messages[0].ID
+	}
+	if len(sent.Contacts) > 0 {
+		result.WAID = sent.Contacts[0].WAID
+	}
+	return result, nil
+}
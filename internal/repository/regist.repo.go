@@ -2,9 +2,11 @@ package repository
 
 import (
 	paymentRepo "go-boilerplate/internal/repository/payment"
+	waflowRepo "go-boilerplate/internal/repository/waflow"
 )
 
 // IRepository is a container for all repository interfaces
 type IRepository struct {
 	Payment paymentRepo.IRepository
+	WAFlow  waflowRepo.IRepository
 }
@@ -0,0 +1,53 @@
+package waflow
+
+import (
+	"context"
+	"go-boilerplate/internal/common/models"
+	database "go-boilerplate/internal/pkg/db"
+	"time"
+)
+
+type IRepository interface {
+	CreateEvent(ctx context.Context, event *models.FlowEvent) error
+	FindEvents(ctx context.Context, flow string, from, to time.Time) ([]models.FlowEvent, error)
+	FindLatestByFlowToken(ctx context.Context, flowToken string) (*models.FlowEvent, error)
+}
+
+type Repository struct {
+	db *database.Database
+}
+
+func NewRepo(db *database.Database) IRepository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateEvent(ctx context.Context, event *models.FlowEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// FindEvents returns the events needed for analytics in chronological order,
+// without the masked payloads. An empty flow matches every flow.
+func (r *Repository) FindEvents(ctx context.Context, flow string, from, to time.Time) ([]models.FlowEvent, error) {
+	var events []models.FlowEvent
+	query := r.db.WithContext(ctx).
+		Select("flow", "flow_token", "action", "screen", "next_screen", "latency_ms", "error", "created_at").
+		Where("created_at >= ? AND created_at < ?", from, to)
+	if flow != "" {
+		query = query.Where("flow = ?", flow)
+	}
+
+	err := query.Order("created_at ASC").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *Repository) FindLatestByFlowToken(ctx context.Context, flowToken string) (*models.FlowEvent, error) {
+	var event models.FlowEvent
+	err := r.db.WithContext(ctx).Where("flow_token = ?", flowToken).Order("created_at DESC").First(&event).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -2,9 +2,9 @@ package serverApp
 
 import (
 	"context"
-	"crypto/rsa"
 	"net/url"
 	"strings"
+	"syscall"
 
 	ai "go-boilerplate/internal/pkg/ai-connector"
 	database "go-boilerplate/internal/pkg/db"
@@ -15,14 +15,19 @@ import (
 	"go-boilerplate/internal/pkg/redis"
 	s3aws "go-boilerplate/internal/pkg/storage/s3"
 	"go-boilerplate/internal/pkg/waflow"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
 	"go-boilerplate/internal/repository"
 	paymentRepo "go-boilerplate/internal/repository/payment"
+	waflowRepo "go-boilerplate/internal/repository/waflow"
 	"sync"
 
 	xampleHandler "go-boilerplate/internal/handler/example"
 	paymentHandler "go-boilerplate/internal/handler/payment"
+	waflowHandler "go-boilerplate/internal/handler/waflow"
+	whatsappHandler "go-boilerplate/internal/handler/whatsapp"
 	xampleService "go-boilerplate/internal/service/example"
 	paymentService "go-boilerplate/internal/service/payment"
+	waflowService "go-boilerplate/internal/service/waflow"
 
 	"go-boilerplate/docs"
 
@@ -39,12 +44,16 @@ func Setup(
 	db *database.Database,
 	redisClient redis.IRedis,
 	rb *rabbitmq.ConnectionManager,
-	publisher *rabbitmq.Publisher,
+	broker rabbitmq.Broker,
+	publisher rabbitmq.MessagePublisher,
 	s3 *s3aws.Is3,
 	ai *ai.AiClient,
 	mt *midtransPkg.MidtransClient,
+	wa *whatsappPkg.Client,
 	baseURL string,
 	waPrivateKeyPath string,
+	waPrivateKeyPassphrase string,
+	waPaidTemplate string,
 ) {
 	engine.RedirectTrailingSlash = false
 	engine.RedirectFixedPath = false
@@ -72,16 +81,17 @@ func Setup(
 		rabbitmqHealth := "unhealthy"
 		redisHealth := "unhealthy"
 		databaseHealth := "unhealthy"
-		rbCon := rb.GetConnection()
-
 		if db != nil && !db.IsCloseConnection() {
 			databaseHealth = "healthy"
 		}
 
-		if rbCon != nil && !rbCon.IsClosed() {
+		// rb is nil when events go over Redis Streams
+		if rb == nil {
+			rabbitmqHealth = "disabled"
+		} else if rbCon := rb.GetConnection(); rbCon != nil && !rbCon.IsClosed() {
 			rabbitmqHealth = "healthy"
 		}
-		if redisClient != nil && redisClient.Close() == nil {
+		if redisClient != nil && redisClient.Healthy() {
 			redisHealth = "healthy"
 		}
 		c.JSON(200, gin.H{
@@ -103,7 +113,7 @@ func Setup(
 	engine.HEAD("/health", healthHandler)
 
 	e := engine.Group(BasePath())
-	InitRoutes(e, engine, ctx, wg, db, redisClient, rb, publisher, s3, ai, mt, baseURL, waPrivateKeyPath)
+	InitRoutes(e, engine, ctx, wg, db, redisClient, broker, publisher, s3, ai, mt, wa, baseURL, waPrivateKeyPath, waPrivateKeyPassphrase, waPaidTemplate)
 }
 
 // BasePath returns the base API path
@@ -112,7 +122,7 @@ func BasePath() string {
 }
 
 // InitMiddleware initializes global middleware
-func InitMiddleware(e *gin.Engine, publisher *rabbitmq.Publisher) {
+func InitMiddleware(e *gin.Engine, publisher rabbitmq.MessagePublisher) {
 	e.Use(middleware.CorsMiddleware())
 	e.Use(middleware.RequestInit())
 	e.Use(middleware.ResponseInit())
@@ -125,40 +135,56 @@ func InitRoutes(
 	wg *sync.WaitGroup,
 	db *database.Database,
 	redisClient redis.IRedis,
-	rb *rabbitmq.ConnectionManager,
-	publisher *rabbitmq.Publisher,
+	broker rabbitmq.Broker,
+	publisher rabbitmq.MessagePublisher,
 	s3 *s3aws.Is3,
 	ai *ai.AiClient,
 	mt *midtransPkg.MidtransClient,
+	wa *whatsappPkg.Client,
 	baseURL string,
 	waPrivateKeyPath string,
+	waPrivateKeyPassphrase string,
+	waPaidTemplate string,
 ) {
 
 	// setup repo
 	rp := repository.IRepository{
 		Payment: paymentRepo.NewRepo(db),
+		WAFlow:  waflowRepo.NewRepo(db),
 	}
 
 	// === Example ===
-	XampleService := xampleService.NewService(ctx, redisClient, rb, publisher, rp)
-	XampleHandler := xampleHandler.NewHandler(ctx, rb, XampleService)
+	XampleService := xampleService.NewService(ctx, redisClient, broker, publisher, rp)
+	XampleHandler := xampleHandler.NewHandler(ctx, broker, XampleService)
 	XampleHandler.NewRoutes(e)
 
-	// === Load WA Flows private key (optional) ===
-	var waPrivateKey *rsa.PrivateKey
-	if waPrivateKeyPath != "" {
+	// === Load WA Flows private keys (optional) ===
+	// WA_PRIVATE_KEY_PATH is a comma separated list, new key first. SIGHUP
+	// reloads the files so a rotation does not need a restart.
+	var waKeys *waflow.KeyRing
+	if paths := waflow.ParseKeyPaths(waPrivateKeyPath); len(paths) > 0 {
 		var err error
-		waPrivateKey, err = waflow.LoadPrivateKey(waPrivateKeyPath)
+		waKeys, err = waflow.NewKeyRing(paths, waPrivateKeyPassphrase)
 		if err != nil {
 			logger.Error.Printf("Failed to load WA Flows private key: %v", err)
 		} else {
-			logger.Info.Printf("WA Flows private key loaded from %s", waPrivateKeyPath)
+			logger.Info.Printf("WA Flows private keys loaded from %s", strings.Join(paths, ", "))
+			waKeys.ReloadOnSignal(ctx, syscall.SIGHUP)
 		}
 	}
 
+	// === WA Flow analytics ===
+	WAFlowService := waflowService.NewService(ctx, wg, rp)
+	WAFlowHandler := waflowHandler.NewHandler(ctx, WAFlowService)
+	WAFlowHandler.NewRoutes(e)
+
 	// === Payment ===
-	PaymentService := paymentService.NewService(ctx, rp, mt, baseURL)
-	PaymentHandler := paymentHandler.NewHandler(ctx, PaymentService, mt, baseURL, waPrivateKey)
+	PaymentService := paymentService.NewService(ctx, redisClient, rp, mt, wa, publisher, baseURL, waPaidTemplate)
+	PaymentHandler := paymentHandler.NewHandler(ctx, redisClient, PaymentService, WAFlowService, mt, baseURL, waKeys)
 	PaymentHandler.NewRoutes(e)
 	PaymentHandler.NewPageRoutes(engine)
+
+	// === WhatsApp webhook ===
+	WhatsAppHandler := whatsappHandler.NewHandler(ctx, wa, WAFlowService)
+	WhatsAppHandler.NewRoutes(e)
 }
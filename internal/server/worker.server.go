@@ -4,55 +4,51 @@ import (
 	"context"
 	"fmt"
 	database "go-boilerplate/internal/pkg/db"
-	"go-boilerplate/internal/pkg/logger"
+	midtransPkg "go-boilerplate/internal/pkg/midtrans"
 	"go-boilerplate/internal/pkg/rabbitmq"
 	"go-boilerplate/internal/pkg/redis"
 	s3aws "go-boilerplate/internal/pkg/storage/s3"
-	"time"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
+	"go-boilerplate/internal/repository"
+	paymentRepo "go-boilerplate/internal/repository/payment"
+	waflowRepo "go-boilerplate/internal/repository/waflow"
 
-	"github.com/panjf2000/ants"
+	paymentHandler "go-boilerplate/internal/handler/payment"
+	paymentService "go-boilerplate/internal/service/payment"
 )
 
-// InitWorker initializes background workers
-// Add your worker initialization here following the example:
+// InitWorker builds the registry of every module's consumers. It starts
+// nothing, cmd/worker (or the API with APP_RUN_WORKERS) starts the registry.
+// Add your consumers here following the payment example:
 //
-//	err = pool.Submit(func() {
-//	    // Your worker logic here
-//	    if err := myWorker.Subscribe(); err != nil {
-//	        logger.Error.Printf("Failed to initialize worker: %v\n", err)
-//	    }
-//	})
+//	if err := myHandler.RegisterConsumers(registry, myService); err != nil {
+//	    return nil, fmt.Errorf("failed to register my consumers: %w", err)
+//	}
 func InitWorker(
 	ctx context.Context,
 	redisClient redis.IRedis,
 	db *database.Database,
 	rb *rabbitmq.ConnectionManager,
-	publisher *rabbitmq.Publisher,
+	publisher rabbitmq.MessagePublisher,
 	s3 *s3aws.Is3,
-) {
-	poolOpts := ants.Options{
-		ExpiryDuration: time.Hour,
-		PreAlloc:       true,
-		Nonblocking:    true,
-		PanicHandler: func(i interface{}) {
-			logger.Error.Printf("Worker panic: %v\n", i)
-		},
-	}
+	mt *midtransPkg.MidtransClient,
+	wa *whatsappPkg.Client,
+	baseURL string,
+	waPaidTemplate string,
+) (*rabbitmq.Registry, error) {
+	registry := rabbitmq.NewRegistry()
 
-	pool, err := ants.NewPool(100, ants.WithOptions(poolOpts))
-	if err != nil {
-		panic(fmt.Errorf("failed to create worker pool: %w", err))
+	// setup repo
+	rp := repository.IRepository{
+		Payment: paymentRepo.NewRepo(db),
+		WAFlow:  waflowRepo.NewRepo(db),
 	}
-	defer pool.Release()
 
-	// TODO: Add your workers here
-	// Example:
-	// err = pool.Submit(func() {
-	//     if err := myWorker.Subscribe(); err != nil {
-	//         logger.Error.Printf("Failed to initialize worker: %v\n", err)
-	//     }
-	// })
-	if err != nil {
-		panic(fmt.Errorf("failed to submit task to pool: %w", err))
+	// === Payment ===
+	PaymentService := paymentService.NewService(ctx, redisClient, rp, mt, wa, publisher, baseURL, waPaidTemplate)
+	if err := paymentHandler.RegisterConsumers(registry, PaymentService); err != nil {
+		return nil, fmt.Errorf("failed to register payment consumers: %w", err)
 	}
+
+	return registry, nil
 }
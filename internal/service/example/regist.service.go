@@ -12,15 +12,15 @@ type Service struct {
 	ctx       context.Context
 	redis     redis.IRedis
 	rp        repository.IRepository
-	rabbitmq  *rabbitmq.ConnectionManager
-	publisher *rabbitmq.Publisher
+	rabbitmq  rabbitmq.Broker
+	publisher rabbitmq.MessagePublisher
 }
 
 type IService interface {
 	XampleService() *types.Response
 }
 
-func NewService(ctx context.Context, redis redis.IRedis, rabbitmq *rabbitmq.ConnectionManager, publisher *rabbitmq.Publisher, repository repository.IRepository) IService {
+func NewService(ctx context.Context, redis redis.IRedis, rabbitmq rabbitmq.Broker, publisher rabbitmq.MessagePublisher, repository repository.IRepository) IService {
 	return &Service{
 		ctx:       ctx,
 		redis:     redis,
@@ -1,16 +1,22 @@
 package payment
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go-boilerplate/internal/common/models"
 	types "go-boilerplate/internal/common/type"
+	"go-boilerplate/internal/pkg/cache"
 	"go-boilerplate/internal/pkg/helper"
 	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/rabbitmq"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/midtrans/midtrans-go"
@@ -93,6 +99,9 @@ func (s *Service) CreatePayment(req *CreatePaymentRequest) *types.Response {
 		})
 	}
 
+	// a status lookup made before the order existed may be cached as missing
+	_ = s.cache.Invalidate(s.ctx, statusCacheKey(req.OrderID))
+
 	return helper.ParseResponse(&types.Response{
 		Code:    http.StatusCreated,
 		Message: "Payment created successfully",
@@ -106,81 +115,88 @@ func (s *Service) CreatePayment(req *CreatePaymentRequest) *types.Response {
 	})
 }
 
+// CheckPaymentStatus answers from the status cache, so the status page of
+// every open browser costs one Midtrans check per order per statusCacheTTL
 func (s *Service) CheckPaymentStatus(orderID string) *types.Response {
-	// Check from Midtrans directly (real-time)
-	transactionStatusResp, midErr := s.midtrans.CoreAPI.CheckTransaction(orderID)
-	if midErr != nil {
-		// Fallback to database
-		trx, err := s.rp.Payment.FindByOrderID(s.ctx, orderID)
-		if err != nil {
-			return helper.ParseResponse(&types.Response{
-				Code:    http.StatusNotFound,
-				Message: "Transaction not found",
-				Error:   err,
-			})
-		}
+	status, err := cache.GetOrLoad(s.ctx, s.cache, statusCacheKey(orderID), statusCacheTTL, func(ctx context.Context) (PaymentStatusResponse, error) {
+		return s.loadStatus(ctx, orderID)
+	})
+	if err != nil {
 		return helper.ParseResponse(&types.Response{
-			Code: http.StatusOK,
-			Data: PaymentStatusResponse{
-				OrderID:     trx.OrderID,
-				Status:      trx.Status,
-				Amount:      trx.GrossAmount,
-				PaymentType: trx.PaymentType,
-			},
+			Code:    http.StatusNotFound,
+			Message: "Transaction not found",
+			Error:   err,
 		})
 	}
 
-	// Update database if status changed
-	s.updateTransactionStatus(orderID, transactionStatusResp)
-
-	// Get amount from DB (Midtrans returns string)
-	trx, _ := s.rp.Payment.FindByOrderID(s.ctx, orderID)
-	var amount int64
-	if trx != nil {
-		amount = trx.GrossAmount
-	}
-
 	return helper.ParseResponse(&types.Response{
 		Code: http.StatusOK,
-		Data: PaymentStatusResponse{
-			OrderID:       orderID,
-			Status:        transactionStatusResp.TransactionStatus,
-			PaymentType:   transactionStatusResp.PaymentType,
-			Amount:        amount,
-			TransactionID: transactionStatusResp.TransactionID,
-		},
+		Data: status,
 	})
 }
 
+// loadStatus asks Midtrans for the status and stores it, the stored status is
+// used when Midtrans cannot be reached
+func (s *Service) loadStatus(ctx context.Context, orderID string) (PaymentStatusResponse, error) {
+	// Check from Midtrans directly (real-time) and update the database if the
+	// status changed. The status is cached as loaded, so the change must not
+	// invalidate it.
+	transactionStatusResp, err := s.syncStatus(orderID, false)
+	if transactionStatusResp == nil {
+		logger.Warning.Printf("Failed to check order %s with Midtrans, answering from the database: %v", orderID, err)
+		// Fallback to database
+		trx, err := s.rp.Payment.FindByOrderID(ctx, orderID)
+		if err != nil {
+			return PaymentStatusResponse{}, fmt.Errorf("order %s: %w", orderID, cache.ErrNotFound)
+		}
+		return PaymentStatusResponse{
+			OrderID:     trx.OrderID,
+			Status:      trx.Status,
+			Amount:      trx.GrossAmount,
+			PaymentType: trx.PaymentType,
+		}, nil
+	}
+	if err != nil {
+		logger.Error.Printf("Failed to update transaction status for order %s: %v", orderID, err)
+	}
+
+	return s.statusResponse(ctx, orderID, transactionStatusResp), nil
+}
+
+// statusResponse answers with the stored status, which stays paid when resp
+// reported an older status. Amount comes from the DB, Midtrans returns a string.
+func (s *Service) statusResponse(ctx context.Context, orderID string, resp *coreapi.TransactionStatusResponse) PaymentStatusResponse {
+	status := PaymentStatusResponse{
+		OrderID:       orderID,
+		Status:        resp.TransactionStatus,
+		PaymentType:   resp.PaymentType,
+		TransactionID: resp.TransactionID,
+	}
+	if trx, err := s.rp.Payment.FindByOrderID(ctx, orderID); err == nil {
+		status.Status = trx.Status
+		status.Amount = trx.GrossAmount
+	}
+	return status
+}
+
 func (s *Service) HandlePayment(req *PaymentResultRequest) *types.Response {
 	// Data from frontend CANNOT be trusted — always verify with Midtrans API
-	transactionStatusResp, midErr := s.midtrans.CoreAPI.CheckTransaction(req.OrderID)
-	if midErr != nil {
+	transactionStatusResp, err := s.syncStatus(req.OrderID, true)
+	if transactionStatusResp == nil {
 		return helper.ParseResponse(&types.Response{
 			Code:    http.StatusInternalServerError,
 			Message: "Failed to verify payment",
-			Error:   fmt.Errorf("midtrans check error: %s", midErr.GetMessage()),
+			Error:   err,
 		})
 	}
-
-	s.updateTransactionStatus(req.OrderID, transactionStatusResp)
-
-	trx, _ := s.rp.Payment.FindByOrderID(s.ctx, req.OrderID)
-	var amount int64
-	if trx != nil {
-		amount = trx.GrossAmount
+	if err != nil {
+		logger.Error.Printf("Failed to update transaction status for order %s: %v", req.OrderID, err)
 	}
 
 	return helper.ParseResponse(&types.Response{
 		Code:    http.StatusOK,
 		Message: "Payment processed",
-		Data: PaymentStatusResponse{
-			OrderID:       req.OrderID,
-			Status:        transactionStatusResp.TransactionStatus,
-			PaymentType:   transactionStatusResp.PaymentType,
-			Amount:        amount,
-			TransactionID: transactionStatusResp.TransactionID,
-		},
+		Data:    s.statusResponse(s.ctx, req.OrderID, transactionStatusResp),
 	})
 }
 
@@ -193,17 +209,6 @@ func (s *Service) MidtransCallback(payload map[string]any) *types.Response {
 		})
 	}
 
-	// Verify with Midtrans API (mandatory)
-	transactionStatusResp, midErr := s.midtrans.CoreAPI.CheckTransaction(orderID)
-	if midErr != nil {
-		logger.Error.Printf("Failed to verify callback for order %s: %s", orderID, midErr.GetMessage())
-		return helper.ParseResponse(&types.Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to verify notification",
-			Error:   fmt.Errorf("midtrans check error: %s", midErr.GetMessage()),
-		})
-	}
-
 	// Verify signature key
 	if signatureKey, exists := payload["signature_key"].(string); exists {
 		serverKey := s.midtrans.Snap.ServerKey
@@ -218,10 +223,24 @@ func (s *Service) MidtransCallback(payload map[string]any) *types.Response {
 		}
 	}
 
-	s.updateTransactionStatus(orderID, transactionStatusResp)
-
-	if transactionStatusResp.TransactionStatus == "settlement" || transactionStatusResp.TransactionStatus == "capture" {
-		go s.notifyWhatsApp(orderID)
+	// Verify with Midtrans API (mandatory). Midtrans retries the callback
+	// until it gets a 200.
+	transactionStatusResp, err := s.syncStatus(orderID, true)
+	if errors.Is(err, errCheckTransaction) {
+		logger.Error.Printf("Failed to verify callback for order %s: %v", orderID, err)
+		return helper.ParseResponse(&types.Response{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to verify notification",
+			Error:   err,
+		})
+	}
+	if err != nil {
+		logger.Error.Printf("Failed to update transaction status for order %s: %v", orderID, err)
+		return helper.ParseResponse(&types.Response{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to update transaction",
+			Error:   err,
+		})
 	}
 
 	logger.Info.Printf("Callback processed for order %s: status=%s", orderID, transactionStatusResp.TransactionStatus)
@@ -258,9 +277,53 @@ func (s *Service) GetTransactionByToken(snapToken string) *types.Response {
 	})
 }
 
-func (s *Service) updateTransactionStatus(orderID string, resp *coreapi.TransactionStatusResponse) {
-	if resp == nil {
-		return
+// errCheckTransaction is returned by syncStatus when Midtrans could not be
+// asked for the status
+var errCheckTransaction = errors.New("midtrans check error")
+
+// syncStatus asks Midtrans for the status of an order and stores it. The
+// callback, the payment redirect and status polling race on the same order,
+// the order lock makes each fetch and apply its snapshot in turn, so an older
+// snapshot is never applied over a newer one. invalidate drops the cached
+// status when it changed, the status loader passes false since it caches the
+// new status itself. The response is nil when Midtrans was not asked.
+func (s *Service) syncStatus(orderID string, invalidate bool) (*coreapi.TransactionStatusResponse, error) {
+	var resp *coreapi.TransactionStatusResponse
+	sync := func(ctx context.Context) error {
+		status, midErr := s.midtrans.CoreAPI.CheckTransaction(orderID)
+		if midErr != nil {
+			return fmt.Errorf("%w: %s", errCheckTransaction, midErr.GetMessage())
+		}
+		resp = status
+		// the lock was lost during the check, a newer snapshot may be applied
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("failed to update order %s: %w", orderID, err)
+		}
+		return s.updateTransactionStatus(ctx, orderID, status, invalidate)
+	}
+
+	if s.locker == nil {
+		return resp, sync(s.ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, orderLockWait)
+	defer cancel()
+	err := s.locker.WithLock(ctx, orderLockKey(orderID), sync)
+	return resp, err
+}
+
+func (s *Service) updateTransactionStatus(ctx context.Context, orderID string, resp *coreapi.TransactionStatusResponse, invalidate bool) error {
+	wasPaid, changed := false, true
+	if trx, err := s.rp.Payment.FindByOrderID(ctx, orderID); err == nil {
+		// paid_at is set once, whatever the status did since
+		wasPaid = isPaid(trx.Status) || trx.PaidAt != nil
+		changed = trx.Status != resp.TransactionStatus
+
+		// a snapshot fetched before the payment must not reopen the order
+		if wasPaid && !isPaid(resp.TransactionStatus) && !afterPayment(resp.TransactionStatus) {
+			logger.Warning.Printf("Ignoring status %s of paid order %s", resp.TransactionStatus, orderID)
+			return nil
+		}
 	}
 
 	updates := map[string]any{
@@ -272,46 +335,130 @@ func (s *Service) updateTransactionStatus(orderID string, resp *coreapi.Transact
 		"signature_key":  resp.SignatureKey,
 	}
 
-	if resp.TransactionStatus == "settlement" || resp.TransactionStatus == "capture" {
+	paid := isPaid(resp.TransactionStatus) && !wasPaid
+	if paid {
 		now := time.Now()
 		updates["paid_at"] = &now
 	}
 
-	if err := s.rp.Payment.UpdateStatus(s.ctx, orderID, updates); err != nil {
-		logger.Error.Printf("Failed to update transaction status for order %s: %v", orderID, err)
+	if err := s.rp.Payment.UpdateStatus(ctx, orderID, updates); err != nil {
+		return fmt.Errorf("failed to update order %s: %w", orderID, err)
+	}
+
+	// status pages polling the order see the change at once
+	if changed && invalidate {
+		if err := s.cache.Invalidate(ctx, statusCacheKey(orderID)); err != nil {
+			logger.Warning.Printf("Failed to invalidate status of order %s: %v", orderID, err)
+		}
 	}
+
+	if paid {
+		s.publishPaid(orderID)
+	}
+	return nil
+}
+
+func isPaid(status string) bool {
+	return status == "settlement" || status == "capture"
+}
+
+// afterPayment are the statuses a paid order can move on to
+func afterPayment(status string) bool {
+	switch status {
+	case "refund", "partial_refund", "chargeback", "partial_chargeback":
+		return true
+	}
+	return false
+}
+
+func orderLockKey(orderID string) string {
+	return "payment:order:" + orderID
 }
 
-func (s *Service) notifyWhatsApp(orderID string) {
-	url := "https://channel-middleware-3a-agentspace-dev.omnix.co.id/ai-unifam/middleware/whatsapp/order-status/fafd19dd-0d92-490f-89b5-ede179676065"
+func statusCacheKey(orderID string) string {
+	return "payment:status:" + orderID
+}
 
-	body := map[string]string{
-		"tenant_id":  "onx_unifarm",
-		"account_id": "6282198918484",
-		"idOrder":    orderID,
-		"status":     "PAID",
+// publishPaid hands the side effects of a paid order to the worker. They run
+// here in the background when the event cannot be published.
+func (s *Service) publishPaid(orderID string) {
+	if s.publisher != nil {
+		msg, err := rabbitmq.NewMessage(PaidEvent{OrderID: orderID}, nil)
+		if err == nil {
+			// Midtrans repeats callbacks, the same id lets the worker skip them
+			msg.ID = PaidPattern + ":" + orderID
+			msg.Priority = PaidPriority
+
+			opts := rabbitmq.DefaultPublishOptions(PaidQueue, PaidPattern, false)
+			opts.QueueOpts = PaidQueueConfig()
+			_, err = s.publisher.Publish(msg, opts)
+		}
+		if err == nil {
+			return
+		}
+		logger.Error.Printf("Failed to publish %s for order %s, notifying in process: %v", PaidPattern, orderID, err)
 	}
 
-	jsonBody, err := json.Marshal(body)
+	go func() {
+		if err := s.NotifyPaid(orderID); err != nil {
+			logger.Error.Printf("Failed to notify paid order %s: %v", orderID, err)
+		}
+	}()
+}
+
+// NotifyPaid sends the paid notification of an order to the customer
+func (s *Service) NotifyPaid(orderID string) error {
+	if !s.whatsapp.Enabled() {
+		logger.Warning.Printf("WhatsApp client not configured, skipping notification for order %s", orderID)
+		return nil
+	}
+
+	trx, err := s.rp.Payment.FindByOrderID(s.ctx, orderID)
 	if err != nil {
-		logger.Error.Printf("Failed to marshal WhatsApp notification body for order %s: %v", orderID, err)
-		return
+		return fmt.Errorf("failed to load order %s: %w", orderID, err)
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonBody))
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+
+	amount := formatRupiah(trx.GrossAmount)
+	var result *whatsappPkg.SendResult
+	if s.waPaidTemplate != "" {
+		template := s.whatsapp.Template(s.waPaidTemplate, whatsappPkg.BodyParams(trx.CustomerName, trx.OrderID, amount))
+		result, err = s.whatsapp.SendTemplate(ctx, trx.CustomerPhone, template)
+	} else {
+		text := fmt.Sprintf("Halo %s, pembayaran pesanan %s sebesar %s sudah kami terima. Terima kasih!\n\nStatus pesanan: %s/status/%s",
+			trx.CustomerName, trx.OrderID, amount, s.baseURL, trx.OrderID)
+		result, err = s.whatsapp.SendText(ctx, trx.CustomerPhone, text)
+		if whatsappPkg.IsOutsideWindow(err) {
+			logger.Error.Printf("WhatsApp notification for order %s not sent, the customer has not messaged in 24 hours and WA_PAID_TEMPLATE is not set: %v", orderID, err)
+			return nil
+		}
+	}
 	if err != nil {
-		logger.Error.Printf("Failed to send WhatsApp notification for order %s: %v", orderID, err)
-		return
+		return fmt.Errorf("failed to send WhatsApp notification for order %s: %w", orderID, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		logger.Error.Printf("WhatsApp notification failed for order %s: status %d", orderID, resp.StatusCode)
-		return
+	logger.Info.Printf("WhatsApp notification sent for order %s (message %s)", orderID, result.MessageID)
+	return nil
+}
+
+// formatRupiah formats an amount as "Rp 38.800"
+func formatRupiah(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
 	}
 
-	logger.Info.Printf("WhatsApp notification sent for order %s", orderID)
+	digits := strconv.FormatInt(amount, 10)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+	return sign + "Rp " + b.String()
 }
 
 func verifySignatureKey(orderID, statusCode, grossAmount, serverKey, signatureKey string) bool {
@@ -0,0 +1,381 @@
+package payment_test
+
+import (
+	"context"
+	"encoding/json"
+	"go-boilerplate/internal/common/models"
+	paymentHandler "go-boilerplate/internal/handler/payment"
+	"go-boilerplate/internal/pkg/logger"
+	midtransPkg "go-boilerplate/internal/pkg/midtrans"
+	"go-boilerplate/internal/pkg/rabbitmq"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
+	"go-boilerplate/internal/repository"
+	"go-boilerplate/internal/service/payment"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/midtrans/midtrans-go"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	logger.Setup()
+	os.Exit(m.Run())
+}
+
+// fakeRepo keeps transactions in memory
+type fakeRepo struct {
+	mu   sync.Mutex
+	trxs map[string]*models.Transaction
+}
+
+func (r *fakeRepo) Create(ctx context.Context, trx *models.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trxs[trx.OrderID] = trx
+	return nil
+}
+
+func (r *fakeRepo) FindByOrderID(ctx context.Context, orderID string) (*models.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	trx, ok := r.trxs[orderID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *trx
+	return &copied, nil
+}
+
+func (r *fakeRepo) FindBySnapToken(ctx context.Context, snapToken string) (*models.Transaction, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRepo) UpdateStatus(ctx context.Context, orderID string, updates map[string]any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	trx, ok := r.trxs[orderID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	trx.Status, _ = updates["status"].(string)
+	if paidAt, ok := updates["paid_at"].(*time.Time); ok {
+		trx.PaidAt = paidAt
+	}
+	return nil
+}
+
+// midtransStub answers every Core API call with status, checked is called
+// with each answer before it is returned
+type midtransStub struct {
+	mu      sync.Mutex
+	status  map[string]any
+	checked func()
+}
+
+// setStatus changes the transaction_status of later answers
+func (s *midtransStub) setStatus(transactionStatus string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := make(map[string]any, len(s.status))
+	for k, v := range s.status {
+		status[k] = v
+	}
+	status["transaction_status"] = transactionStatus
+	s.status = status
+}
+
+func (s *midtransStub) Call(method, url string, apiKey *string, options *midtrans.ConfigOptions, body io.Reader, result interface{}) *midtrans.Error {
+	s.mu.Lock()
+	status, checked := s.status, s.checked
+	s.checked = nil
+	s.mu.Unlock()
+	if checked != nil {
+		checked()
+	}
+
+	data, _ := json.Marshal(status)
+	if err := json.Unmarshal(data, result); err != nil {
+		return &midtrans.Error{Message: err.Error(), RawError: err}
+	}
+	return nil
+}
+
+// whatsappStub records the messages sent to the Graph API
+type whatsappStub struct {
+	mu       sync.Mutex
+	messages []string
+	refusal  string // error body answered with a 400 when set
+}
+
+func (s *whatsappStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.messages = append(s.messages, string(body))
+	refusal := s.refusal
+	s.mu.Unlock()
+	if refusal != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(refusal))
+		return
+	}
+	_, _ = w.Write([]byte(`{"contacts":[{"wa_id":"628123"}],"messages":[{"id":"wamid.1"}]}`))
+}
+
+func (s *whatsappStub) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+type fixture struct {
+	service  payment.IService
+	broker   *rabbitmq.MemoryBroker
+	repo     *fakeRepo
+	midtrans *midtransStub
+	whatsapp *whatsappStub
+}
+
+// newFixture wires the service to a MemoryBroker consumed by the worker's
+// payment consumers, with Midtrans reporting transactionStatus
+func newFixture(t *testing.T, transactionStatus string) *fixture {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	repo := &fakeRepo{trxs: map[string]*models.Transaction{
+		"ORDER-1": {ID: "1", OrderID: "ORDER-1", CustomerName: "Budi", CustomerPhone: "08123", GrossAmount: 38800, Status: "pending"},
+	}}
+
+	mt := &midtransPkg.MidtransClient{}
+	mt.Snap.ServerKey = "server-key"
+	midtrans := &midtransStub{status: map[string]any{
+		"order_id":           "ORDER-1",
+		"transaction_status": transactionStatus,
+		"status_code":        "200",
+		"gross_amount":       "38800.00",
+		"payment_type":       "qris",
+		"transaction_id":     "trx-1",
+	}}
+	mt.CoreAPI.HttpClient = midtrans
+
+	wa := &whatsappStub{}
+	server := httptest.NewServer(wa)
+	t.Cleanup(server.Close)
+	waClient := whatsappPkg.Setup(&whatsappPkg.Config{
+		BaseURL:            server.URL,
+		PhoneNumberID:      "phone-id",
+		AccessToken:        "token",
+		DefaultCountryCode: "62",
+	})
+
+	broker := rabbitmq.NewMemoryBroker()
+	service := payment.NewService(ctx, nil, repository.IRepository{Payment: repo}, mt, waClient, broker, "https://shop.example", "")
+
+	registry := rabbitmq.NewRegistry()
+	if err := paymentHandler.RegisterConsumers(registry, service); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Start(ctx, broker); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = registry.Stop() })
+
+	return &fixture{service: service, broker: broker, repo: repo, midtrans: midtrans, whatsapp: wa}
+}
+
+func (f *fixture) waitIdle(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.broker.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMidtransCallbackNotifiesPaidOrderOnce(t *testing.T) {
+	f := newFixture(t, "settlement")
+
+	// Midtrans repeats callbacks until it gets a 200
+	for i := 0; i < 2; i++ {
+		if resp := f.service.MidtransCallback(map[string]any{"order_id": "ORDER-1"}); resp.Code != http.StatusOK {
+			t.Fatalf("callback %d: code %d, %s", i, resp.Code, resp.Message)
+		}
+	}
+	f.waitIdle(t)
+
+	trx, _ := f.repo.FindByOrderID(context.Background(), "ORDER-1")
+	if trx.Status != "settlement" || trx.PaidAt == nil {
+		t.Errorf("transaction = %s paid at %v, want settlement with a paid time", trx.Status, trx.PaidAt)
+	}
+
+	sent := f.whatsapp.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d WhatsApp messages, want 1", len(sent))
+	}
+	for _, want := range []string{`"to":"628123"`, "ORDER-1", "Rp 38.800"} {
+		if !strings.Contains(sent[0], want) {
+			t.Errorf("message %s does not contain %s", sent[0], want)
+		}
+	}
+}
+
+func TestMidtransCallbackPendingDoesNotNotify(t *testing.T) {
+	f := newFixture(t, "pending")
+
+	if resp := f.service.MidtransCallback(map[string]any{"order_id": "ORDER-1"}); resp.Code != http.StatusOK {
+		t.Fatalf("callback: code %d, %s", resp.Code, resp.Message)
+	}
+	f.waitIdle(t)
+
+	if sent := f.whatsapp.sent(); len(sent) != 0 {
+		t.Errorf("sent %d WhatsApp messages for a pending order, want 0", len(sent))
+	}
+}
+
+func TestMidtransCallbackRejectsInvalidSignature(t *testing.T) {
+	f := newFixture(t, "settlement")
+
+	resp := f.service.MidtransCallback(map[string]any{
+		"order_id":      "ORDER-1",
+		"status_code":   "200",
+		"gross_amount":  "38800.00",
+		"signature_key": "forged",
+	})
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("callback: code %d, want %d", resp.Code, http.StatusForbidden)
+	}
+	f.waitIdle(t)
+
+	trx, _ := f.repo.FindByOrderID(context.Background(), "ORDER-1")
+	if trx.Status != "pending" {
+		t.Errorf("status = %s, want pending", trx.Status)
+	}
+	if sent := f.whatsapp.sent(); len(sent) != 0 {
+		t.Errorf("sent %d WhatsApp messages, want 0", len(sent))
+	}
+}
+
+func TestTextOutsideWindowIsNotRetried(t *testing.T) {
+	f := newFixture(t, "settlement")
+	f.whatsapp.refusal = `{"error":{"message":"Re-engagement message","code":131047}}`
+
+	msg, err := rabbitmq.NewMessage(payment.PaidEvent{OrderID: "ORDER-1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := rabbitmq.DefaultPublishOptions(payment.PaidQueue, payment.PaidPattern, false)
+	opts.QueueOpts = payment.PaidQueueConfig()
+	if _, err := f.broker.Publish(msg, opts); err != nil {
+		t.Fatal(err)
+	}
+	f.waitIdle(t)
+
+	// the window will not reopen on a retry, the event is acked
+	if sent := f.whatsapp.sent(); len(sent) != 1 {
+		t.Errorf("sent %d WhatsApp messages, want 1", len(sent))
+	}
+	if dead := f.broker.Messages(rabbitmq.DeadLetterQueueName(payment.PaidQueue)); len(dead) != 0 {
+		t.Errorf("%d paid events dead-lettered, want 0", len(dead))
+	}
+}
+
+func TestPaidEventIsConsumedByNotifyPaid(t *testing.T) {
+	f := newFixture(t, "settlement")
+
+	// the published event reaches the worker's consumer, which calls NotifyPaid
+	msg, err := rabbitmq.NewMessage(payment.PaidEvent{OrderID: "ORDER-1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := rabbitmq.DefaultPublishOptions(payment.PaidQueue, payment.PaidPattern, false)
+	opts.QueueOpts = payment.PaidQueueConfig()
+	if _, err := f.broker.Publish(msg, opts); err != nil {
+		t.Fatal(err)
+	}
+	f.waitIdle(t)
+
+	if sent := f.whatsapp.sent(); len(sent) != 1 {
+		t.Fatalf("sent %d WhatsApp messages, want 1", len(sent))
+	}
+	if dead := f.broker.Messages(rabbitmq.DeadLetterQueueName(payment.PaidQueue)); len(dead) != 0 {
+		t.Errorf("%d paid events dead-lettered, want 0", len(dead))
+	}
+}
+
+func TestStaleStatusDoesNotReopenPaidOrder(t *testing.T) {
+	f := newFixture(t, "pending")
+
+	// a status poll fetches pending, then waits while the callback settles
+	fetched, release := make(chan struct{}), make(chan struct{})
+	f.midtrans.mu.Lock()
+	f.midtrans.checked = func() {
+		close(fetched)
+		<-release
+	}
+	f.midtrans.mu.Unlock()
+
+	polled := make(chan string)
+	go func() {
+		resp := f.service.CheckPaymentStatus("ORDER-1")
+		status, _ := resp.Data.(payment.PaymentStatusResponse)
+		polled <- status.Status
+	}()
+	<-fetched
+
+	f.midtrans.setStatus("settlement")
+	if resp := f.service.MidtransCallback(map[string]any{"order_id": "ORDER-1"}); resp.Code != http.StatusOK {
+		t.Fatalf("callback: code %d, %s", resp.Code, resp.Message)
+	}
+	settled, _ := f.repo.FindByOrderID(context.Background(), "ORDER-1")
+
+	// the poll applies its pending snapshot last
+	close(release)
+	if status := <-polled; status != "settlement" {
+		t.Errorf("poll answered %s, want the stored settlement", status)
+	}
+
+	// a later sync must not see an unpaid order and notify again
+	if resp := f.service.MidtransCallback(map[string]any{"order_id": "ORDER-1"}); resp.Code != http.StatusOK {
+		t.Fatalf("second callback: code %d, %s", resp.Code, resp.Message)
+	}
+	f.waitIdle(t)
+
+	trx, _ := f.repo.FindByOrderID(context.Background(), "ORDER-1")
+	if trx.Status != "settlement" {
+		t.Errorf("status = %s, want settlement", trx.Status)
+	}
+	if trx.PaidAt == nil || !trx.PaidAt.Equal(*settled.PaidAt) {
+		t.Errorf("paid_at = %v, want the first %v", trx.PaidAt, settled.PaidAt)
+	}
+	if sent := f.whatsapp.sent(); len(sent) != 1 {
+		t.Errorf("sent %d WhatsApp messages, want 1", len(sent))
+	}
+}
+
+func TestRefundMovesPaidOrderOn(t *testing.T) {
+	f := newFixture(t, "settlement")
+	if resp := f.service.MidtransCallback(map[string]any{"order_id": "ORDER-1"}); resp.Code != http.StatusOK {
+		t.Fatalf("callback: code %d, %s", resp.Code, resp.Message)
+	}
+
+	f.midtrans.setStatus("refund")
+	if resp := f.service.MidtransCallback(map[string]any{"order_id": "ORDER-1"}); resp.Code != http.StatusOK {
+		t.Fatalf("refund callback: code %d, %s", resp.Code, resp.Message)
+	}
+	f.waitIdle(t)
+
+	trx, _ := f.repo.FindByOrderID(context.Background(), "ORDER-1")
+	if trx.Status != "refund" || trx.PaidAt == nil {
+		t.Errorf("transaction = %s paid at %v, want refund keeping the paid time", trx.Status, trx.PaidAt)
+	}
+	if sent := f.whatsapp.sent(); len(sent) != 1 {
+		t.Errorf("sent %d WhatsApp messages, want 1", len(sent))
+	}
+}
@@ -5,14 +5,53 @@ import (
 	"encoding/json"
 	types "go-boilerplate/internal/common/type"
 	midtransPkg "go-boilerplate/internal/pkg/midtrans"
+	"go-boilerplate/internal/pkg/cache"
+	"go-boilerplate/internal/pkg/logger"
+	"go-boilerplate/internal/pkg/rabbitmq"
+	"go-boilerplate/internal/pkg/redis"
+	whatsappPkg "go-boilerplate/internal/pkg/whatsapp"
 	"go-boilerplate/internal/repository"
+	"time"
 )
 
+// Paid orders are published to PaidQueue, the worker runs their side effects
+const (
+	PaidQueue   = "payment:paid"
+	PaidPattern = "payment.paid"
+	// PaidPriority puts paid-order notifications ahead of bulk sends sharing the queue
+	PaidPriority = 9
+)
+
+// orderLockWait bounds how long a status update waits for another update of
+// the same order
+const orderLockWait = 10 * time.Second
+
+// statusCacheTTL matches the polling interval of the status page
+const statusCacheTTL = 5 * time.Second
+
+// PaidQueueConfig is declared by both the publisher and the consumer of
+// PaidQueue, RabbitMQ refuses a second declare with other settings
+func PaidQueueConfig() *rabbitmq.QueueConfig {
+	config := rabbitmq.DefaultQueueConfig()
+	config.MaxPriority = 10
+	return config
+}
+
 type Service struct {
-	ctx      context.Context
-	rp       repository.IRepository
-	midtrans *midtransPkg.MidtransClient
-	baseURL  string
+	ctx       context.Context
+	rp        repository.IRepository
+	midtrans  *midtransPkg.MidtransClient
+	whatsapp  *whatsappPkg.Client
+	publisher rabbitmq.MessagePublisher
+	locker    *redis.Locker
+	cache     *cache.Cache
+	baseURL   string
+
+	// waPaidTemplate is the template sent once an order is paid, its body
+	// takes {{1}} customer name, {{2}} order id and {{3}} amount. A text
+	// message is sent when it is empty, it only reaches customers who
+	// messaged in the last 24 hours.
+	waPaidTemplate string
 }
 
 type IService interface {
@@ -21,19 +60,39 @@ type IService interface {
 	HandlePayment(req *PaymentResultRequest) *types.Response
 	MidtransCallback(payload map[string]any) *types.Response
 	GetTransactionByToken(snapToken string) *types.Response
+	NotifyPaid(orderID string) error
 }
 
-func NewService(ctx context.Context, rp repository.IRepository, midtrans *midtransPkg.MidtransClient, baseURL string) IService {
+func NewService(ctx context.Context, redisClient redis.IRedis, rp repository.IRepository, midtrans *midtransPkg.MidtransClient, whatsapp *whatsappPkg.Client, publisher rabbitmq.MessagePublisher, baseURL string, waPaidTemplate string) IService {
+	if whatsapp.Enabled() && waPaidTemplate == "" {
+		logger.Warning.Println("WA_PAID_TEMPLATE is not set, paid notifications are sent as text and only reach customers who messaged in the last 24 hours")
+	}
+
+	var locker *redis.Locker
+	if redisClient != nil {
+		locker = redis.NewLocker(redisClient, nil)
+	}
+
 	return &Service{
-		ctx:      ctx,
-		rp:       rp,
-		midtrans: midtrans,
-		baseURL:  baseURL,
+		ctx:            ctx,
+		rp:             rp,
+		midtrans:       midtrans,
+		whatsapp:       whatsapp,
+		publisher:      publisher,
+		locker:         locker,
+		cache:          cache.New(redisClient, nil),
+		baseURL:        baseURL,
+		waPaidTemplate: waPaidTemplate,
 	}
 }
 
 // Request/Response DTOs
 
+// PaidEvent is the message published to PaidQueue
+type PaidEvent struct {
+	OrderID string `json:"order_id"`
+}
+
 type CustomerInfo struct {
 	Name  string `json:"name"`
 	Phone string `json:"phone"`
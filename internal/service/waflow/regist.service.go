@@ -0,0 +1,80 @@
+package waflow
+
+import (
+	"context"
+	"go-boilerplate/internal/common/models"
+	types "go-boilerplate/internal/common/type"
+	"go-boilerplate/internal/pkg/metrics"
+	"go-boilerplate/internal/repository"
+	"sync"
+	"time"
+)
+
+// ActionComplete is recorded when the webhook reports a completed flow, the
+// endpoint never sees the complete action itself
+const ActionComplete = "complete"
+
+// eventQueueSize bounds the events waiting for the writer, more are dropped
+// rather than piling up goroutines while the database is slow
+const eventQueueSize = 1024
+
+var droppedEvents = metrics.NewCounter("waflow_events_dropped_total", "WA Flow events dropped because the writer queue was full.")
+
+type Service struct {
+	ctx    context.Context
+	rp     repository.IRepository
+	events chan *models.FlowEvent
+}
+
+type IService interface {
+	RecordEvent(event *models.FlowEvent)
+	RecordCompletion(flowToken string, data models.JSONB)
+	Analytics(req *AnalyticsRequest) *types.Response
+}
+
+// NewService starts the event writer, it drains the queue once ctx is done
+// and wg waits for it
+func NewService(ctx context.Context, wg *sync.WaitGroup, rp repository.IRepository) IService {
+	s := &Service{
+		ctx:    ctx,
+		rp:     rp,
+		events: make(chan *models.FlowEvent, eventQueueSize),
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.writeEvents()
+	}()
+	return s
+}
+
+// Request/Response DTOs
+
+type AnalyticsRequest struct {
+	Flow string `form:"flow"`
+	From string `form:"from"` // RFC3339 or YYYY-MM-DD, defaults to 7 days ago
+	To   string `form:"to"`   // RFC3339 or YYYY-MM-DD (inclusive), defaults to now
+}
+
+type AnalyticsResponse struct {
+	Flow           string        `json:"flow,omitempty"`
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	Starts         int           `json:"starts"`
+	Completions    int           `json:"completions"`
+	CompletionRate float64       `json:"completion_rate"`
+	Errors         int           `json:"errors"`
+	Screens        []ScreenStats `json:"screens"`
+}
+
+// ScreenStats is the funnel step of one screen. Sessions that reached the
+// screen and never left it (no later request or completion) are drop-offs.
+type ScreenStats struct {
+	Screen        string  `json:"screen"`
+	Reached       int     `json:"reached"`
+	DropOff       int     `json:"drop_off"`
+	DropOffRate   float64 `json:"drop_off_rate"`
+	MedianSeconds float64 `json:"median_seconds"`
+	Errors        int     `json:"errors"`
+}
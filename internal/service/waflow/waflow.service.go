@@ -0,0 +1,293 @@
+package waflow
+
+import (
+	"context"
+	"fmt"
+	"go-boilerplate/internal/common/models"
+	types "go-boilerplate/internal/common/type"
+	"go-boilerplate/internal/pkg/helper"
+	"go-boilerplate/internal/pkg/logger"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxAnalyticsRange bounds the events loaded by one analytics request
+const maxAnalyticsRange = 92 * 24 * time.Hour
+
+// unknownFlow is used for completions of flow tokens the endpoint never saw
+const unknownFlow = "unknown"
+
+// shutdownTimeout bounds writing the queued events once the service stops
+const shutdownTimeout = 5 * time.Second
+
+// RecordEvent queues the event for the writer so the flow endpoint does not
+// wait for the database
+func (s *Service) RecordEvent(event *models.FlowEvent) {
+	s.enqueue(event)
+}
+
+// RecordCompletion stores the complete action reported by the webhook under
+// the flow of the earlier endpoint requests with the same flow_token
+func (s *Service) RecordCompletion(flowToken string, data models.JSONB) {
+	s.enqueue(&models.FlowEvent{
+		Flow:      unknownFlow,
+		FlowToken: flowToken,
+		Action:    ActionComplete,
+		Data:      data,
+	})
+}
+
+// enqueue drops the event when the queue is full or the service stopped
+func (s *Service) enqueue(event *models.FlowEvent) {
+	if s.ctx.Err() != nil {
+		droppedEvents.Inc()
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		droppedEvents.Inc()
+	}
+}
+
+// writeEvents stores queued events one by one. Once s.ctx is done the events
+// already queued are still written, within shutdownTimeout.
+func (s *Service) writeEvents() {
+	for {
+		select {
+		case event := <-s.events:
+			s.writeEvent(s.ctx, event)
+		case <-s.ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			for {
+				select {
+				case event := <-s.events:
+					s.writeEvent(ctx, event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Service) writeEvent(parent context.Context, event *models.FlowEvent) {
+	ctx, cancel := context.WithTimeout(parent, 10*time.Second)
+	defer cancel()
+
+	if event.Action == ActionComplete && event.Flow == unknownFlow {
+		if previous, err := s.rp.WAFlow.FindLatestByFlowToken(ctx, event.FlowToken); err == nil {
+			event.Flow = previous.Flow
+			event.Screen = previous.NextScreen
+		}
+	}
+
+	if err := s.rp.WAFlow.CreateEvent(ctx, event); err != nil {
+		logger.Error.Printf("Failed to record WA Flow event action=%s screen=%s: %v", event.Action, event.Screen, err)
+	}
+}
+
+func (s *Service) Analytics(req *AnalyticsRequest) *types.Response {
+	from, to, err := parseRange(req.From, req.To)
+	if err != nil {
+		return helper.ParseResponse(&types.Response{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid date range",
+			Error:   err,
+		})
+	}
+
+	events, err := s.rp.WAFlow.FindEvents(s.ctx, req.Flow, from, to)
+	if err != nil {
+		return helper.ParseResponse(&types.Response{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to load flow events",
+			Error:   err,
+		})
+	}
+
+	result := buildFunnel(events)
+	result.Flow = req.Flow
+	result.From = from
+	result.To = to
+
+	return helper.ParseResponse(&types.Response{
+		Code: http.StatusOK,
+		Data: result,
+	})
+}
+
+// flowSession is the replay state of one flow_token
+type flowSession struct {
+	screen    string // screen the customer is on
+	arrivedAt time.Time
+	timed     bool // time on the current screen was already recorded
+	completed bool
+}
+
+// buildFunnel replays the events of every flow_token in order. A screen is
+// reached when the endpoint returns it (or a request is sent from it), and the
+// time on a screen runs from the response that showed it to the next request
+// sent from it or the completion.
+func buildFunnel(events []models.FlowEvent) *AnalyticsResponse {
+	result := &AnalyticsResponse{Screens: []ScreenStats{}}
+
+	sessions := make(map[string]*flowSession)
+	reached := make(map[string]map[string]bool) // screen -> flow tokens
+	durations := make(map[string][]float64)
+	screenErrors := make(map[string]int)
+
+	for _, event := range events {
+		if event.Error != "" {
+			result.Errors++
+			if event.Screen != "" {
+				screenErrors[event.Screen]++
+			}
+		}
+		if event.FlowToken == "" || event.Action == "ping" {
+			continue
+		}
+
+		session, ok := sessions[event.FlowToken]
+		if !ok {
+			session = &flowSession{}
+			sessions[event.FlowToken] = session
+		}
+
+		markReached := func(screen string) {
+			if reached[screen] == nil {
+				reached[screen] = make(map[string]bool)
+			}
+			reached[screen][event.FlowToken] = true
+		}
+
+		// A request sent from a screen the endpoint never returned, e.g. the
+		// first screen of a flow opened with navigate
+		if event.Screen != "" && event.Screen != session.screen {
+			session.screen = event.Screen
+			session.arrivedAt = time.Time{}
+			session.timed = false
+			markReached(event.Screen)
+		}
+
+		leaving := event.Action == ActionComplete || (event.Screen != "" && event.Screen == session.screen)
+		if leaving && session.screen != "" && !session.timed && !session.arrivedAt.IsZero() {
+			durations[session.screen] = append(durations[session.screen], event.CreatedAt.Sub(session.arrivedAt).Seconds())
+			session.timed = true
+		}
+
+		if event.Action == ActionComplete {
+			session.completed = true
+		}
+
+		if event.NextScreen != "" {
+			session.screen = event.NextScreen
+			session.arrivedAt = event.CreatedAt.Add(time.Duration(event.LatencyMs) * time.Millisecond)
+			session.timed = false
+			markReached(event.NextScreen)
+		}
+	}
+
+	dropOffs := make(map[string]int)
+	for _, session := range sessions {
+		result.Starts++
+		if session.completed {
+			result.Completions++
+		} else if session.screen != "" {
+			dropOffs[session.screen]++
+		}
+	}
+	result.CompletionRate = ratio(result.Completions, result.Starts)
+
+	for screen, tokens := range reached {
+		result.Screens = append(result.Screens, ScreenStats{
+			Screen:        screen,
+			Reached:       len(tokens),
+			DropOff:       dropOffs[screen],
+			DropOffRate:   ratio(dropOffs[screen], len(tokens)),
+			MedianSeconds: median(durations[screen]),
+			Errors:        screenErrors[screen],
+		})
+	}
+
+	// Funnel order: the most reached screen first
+	sort.Slice(result.Screens, func(i, j int) bool {
+		if result.Screens[i].Reached != result.Screens[j].Reached {
+			return result.Screens[i].Reached > result.Screens[j].Reached
+		}
+		return result.Screens[i].Screen < result.Screens[j].Screen
+	})
+
+	return result
+}
+
+func parseRange(fromValue, toValue string) (time.Time, time.Time, error) {
+	to := time.Now()
+	if toValue != "" {
+		parsed, dateOnly, err := parseTime(toValue)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = parsed
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+
+	from := to.Add(-7 * 24 * time.Hour)
+	if fromValue != "" {
+		parsed, _, err := parseTime(fromValue)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > maxAnalyticsRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must not exceed %d days", int(maxAnalyticsRange.Hours()/24))
+	}
+	return from, to, nil
+}
+
+// parseTime accepts RFC3339 or a date, reporting whether it was a date
+func parseTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected RFC3339 or YYYY-MM-DD, got %q", value)
+	}
+	return t, true, nil
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return round((sorted[mid-1] + sorted[mid]) / 2)
+	}
+	return round(sorted[mid])
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round(float64(part) / float64(total))
+}
+
+func round(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
@@ -0,0 +1,27 @@
+// Package migrations embeds the versioned SQL migrations run by cmd/migrate,
+// one directory per database driver. Files are named <version>_<name>.up.sql
+// and <version>_<name>.down.sql, create them in both directories with
+// `go run ./cmd/migrate create <name>`.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed postgres/*.sql mysql/*.sql
+var FS embed.FS
+
+// Dirs are the migration directories, named after their driver
+var Dirs = []string{"postgres", "mysql"}
+
+// For returns the migrations of driver
+func For(driver string) (fs.FS, error) {
+	for _, dir := range Dirs {
+		if dir == driver {
+			return fs.Sub(FS, dir)
+		}
+	}
+	return nil, fmt.Errorf("no migrations for driver %q", driver)
+}
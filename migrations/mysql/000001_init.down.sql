@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS flow_events;
+DROP TABLE IF EXISTS transactions;
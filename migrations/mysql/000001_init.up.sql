@@ -0,0 +1,42 @@
+-- MySQL has no CREATE INDEX IF NOT EXISTS, the indexes are declared with
+-- their tables so a database created by AutoMigrate adopts this version.
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id             CHAR(36) NOT NULL PRIMARY KEY,
+    order_id       VARCHAR(100) NOT NULL,
+    customer_name  VARCHAR(255),
+    customer_phone VARCHAR(50),
+    customer_email VARCHAR(255),
+    gross_amount   BIGINT NOT NULL,
+    payment_type   VARCHAR(50),
+    items          JSON NOT NULL,
+    metadata       JSON,
+    snap_token     VARCHAR(255),
+    snap_url       TEXT,
+    transaction_id VARCHAR(255),
+    status         VARCHAR(50) NOT NULL DEFAULT 'pending',
+    fraud_status   VARCHAR(50),
+    status_code    VARCHAR(10),
+    signature_key  TEXT,
+    created_at     DATETIME(3),
+    updated_at     DATETIME(3),
+    paid_at        DATETIME(3),
+    UNIQUE INDEX idx_transactions_order_id (order_id),
+    INDEX idx_transactions_status (status)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS flow_events (
+    id          CHAR(36) NOT NULL PRIMARY KEY,
+    flow        VARCHAR(100) NOT NULL,
+    flow_token  VARCHAR(255),
+    action      VARCHAR(50) NOT NULL,
+    screen      VARCHAR(100),
+    next_screen VARCHAR(100),
+    data        JSON,
+    response    JSON,
+    latency_ms  BIGINT,
+    error       TEXT,
+    created_at  DATETIME(3),
+    INDEX idx_flow_events_flow_created (flow, created_at),
+    INDEX idx_flow_events_flow_token (flow_token)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
@@ -0,0 +1,44 @@
+-- Tables created by AutoMigrate before versioned migrations, IF NOT EXISTS
+-- lets databases migrated that way adopt this version unchanged.
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id       VARCHAR(100) NOT NULL,
+    customer_name  VARCHAR(255),
+    customer_phone VARCHAR(50),
+    customer_email VARCHAR(255),
+    gross_amount   BIGINT NOT NULL,
+    payment_type   VARCHAR(50),
+    items          JSONB NOT NULL,
+    metadata       JSONB,
+    snap_token     VARCHAR(255),
+    snap_url       TEXT,
+    transaction_id VARCHAR(255),
+    status         VARCHAR(50) NOT NULL DEFAULT 'pending',
+    fraud_status   VARCHAR(50),
+    status_code    VARCHAR(10),
+    signature_key  TEXT,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    paid_at        TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_order_id ON transactions (order_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions (status);
+
+CREATE TABLE IF NOT EXISTS flow_events (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    flow        VARCHAR(100) NOT NULL,
+    flow_token  VARCHAR(255),
+    action      VARCHAR(50) NOT NULL,
+    screen      VARCHAR(100),
+    next_screen VARCHAR(100),
+    data        JSONB,
+    response    JSONB,
+    latency_ms  BIGINT,
+    error       TEXT,
+    created_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_flow_events_flow_created ON flow_events (flow, created_at);
+CREATE INDEX IF NOT EXISTS idx_flow_events_flow_token ON flow_events (flow_token);